@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+
+	"github.com/sakateka/lpm"
+)
+
+// aggregationBenchmarks returns the 1M datasets with a default route and
+// values drawn from 16 next hops, which is where FIB compression pays off.
+func aggregationBenchmarks() []struct {
+	name     string
+	prefixes []netip.Prefix
+	values   []string
+	addrs    []netip.Addr
+} {
+	datasets := []struct {
+		name     string
+		prefixes []netip.Prefix
+		values   []string
+		addrs    []netip.Addr
+	}{
+		{
+			name:     "ipv4_1M_prefixes",
+			prefixes: append([]netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}, randomIPv4Prefixes(1000_000)...),
+			addrs:    randomIPv4Addrs(1000),
+		},
+		{
+			name:     "ipv6_1M_prefixes",
+			prefixes: append([]netip.Prefix{netip.MustParsePrefix("::/0")}, randomIPv6Prefixes(1000_000)...),
+			addrs:    randomIPv6Addrs(1000),
+		},
+	}
+	for idx := range datasets {
+		datasets[idx].values = nextHopValues(len(datasets[idx].prefixes), 16)
+	}
+	return datasets
+}
+
+// BenchmarkCompressFIB1M benchmarks both compression modes on 1M prefixes
+func BenchmarkCompressFIB1M(b *testing.B) {
+	for _, ds := range aggregationBenchmarks() {
+		for _, mode := range []FIBCompression{CompressRedundant, CompressORTC} {
+			b.Run(ds.name+"/"+mode.String(), func(b *testing.B) {
+				b.ReportAllocs()
+				captureProfiles(b)
+
+				var compressed []netip.Prefix
+				for b.Loop() {
+					compressed, _ = CompressFIB(ds.prefixes, ds.values, mode)
+				}
+
+				b.ReportMetric(float64(len(ds.prefixes)), "prefixes-in")
+				b.ReportMetric(float64(len(compressed)), "prefixes-out")
+				b.ReportMetric(float64(len(compressed))/float64(len(ds.prefixes)), "ratio")
+			})
+		}
+	}
+}
+
+// BenchmarkCompressedFIBLookup1M loads the original and compressed tables
+// into lpm and MapTrie, reports their memory and benchmarks lookups
+func BenchmarkCompressedFIBLookup1M(b *testing.B) {
+	implementations := []struct {
+		name string
+		load func(prefixes []netip.Prefix, values []string) func(netip.Addr) (string, bool)
+	}{
+		{
+			name: "lpm",
+			load: func(prefixes []netip.Prefix, values []string) func(netip.Addr) (string, bool) {
+				table := lpm.New()
+				for i, prefix := range prefixes {
+					table.Insert(prefix, values[i])
+				}
+				return table.Lookup
+			},
+		},
+		{
+			name: "maptrie",
+			load: func(prefixes []netip.Prefix, values []string) func(netip.Addr) (string, bool) {
+				trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+				for i, prefix := range prefixes {
+					trie.InsertOrUpdate(prefix, onEmptyString(values[i]), onUpdateString(values[i]))
+				}
+				return func(addr netip.Addr) (string, bool) {
+					_, v, ok := trie.Lookup(addr)
+					return v, ok
+				}
+			},
+		},
+	}
+
+	for _, ds := range aggregationBenchmarks() {
+		// The original table is deduplicated like the compressed ones. Tables
+		// are sorted by address, so covering prefixes are inserted before
+		// the nested ones, which lpm requires (see lpmStaleEntryIssue).
+		origPrefixes, origValues := uniqueFIBEntries(ds.prefixes, ds.values)
+
+		tables := []struct {
+			name     string
+			prefixes []netip.Prefix
+			values   []string
+		}{{"original", origPrefixes, origValues}}
+		for _, mode := range []FIBCompression{CompressRedundant, CompressORTC} {
+			prefixes, values := CompressFIB(ds.prefixes, ds.values, mode)
+			tables = append(tables, struct {
+				name     string
+				prefixes []netip.Prefix
+				values   []string
+			}{mode.String(), prefixes, values})
+		}
+
+		for _, impl := range implementations {
+			for _, table := range tables {
+				b.Run(ds.name+"/"+impl.name+"/"+table.name, func(b *testing.B) {
+					// Measure memory before insertion
+					runtime.GC()
+					var memBefore runtime.MemStats
+					runtime.ReadMemStats(&memBefore)
+
+					lookup := impl.load(table.prefixes, table.values)
+
+					// Measure memory after insertion
+					runtime.GC()
+					var memAfter runtime.MemStats
+					runtime.ReadMemStats(&memAfter)
+
+					allocDiff := memAfter.Alloc - memBefore.Alloc
+					b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB)",
+						len(table.prefixes), allocDiff, float64(allocDiff)/(1024*1024))
+
+					b.ResetTimer()
+					b.ReportAllocs()
+					captureProfiles(b)
+
+					idx := 0
+					foundCount := 0
+					for b.Loop() {
+						val, ok := lookup(ds.addrs[idx])
+						if ok && val != "" {
+							foundCount++
+						}
+						idx = (idx + 1) % len(ds.addrs)
+					}
+
+					if foundCount == 0 {
+						b.Fatalf("No successful lookups in %d iterations", b.N)
+					}
+
+					b.ReportMetric(float64(len(table.prefixes)), "prefixes")
+					b.ReportMetric(float64(allocDiff), "heap-bytes")
+				})
+			}
+		}
+	}
+}
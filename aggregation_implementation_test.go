@@ -0,0 +1,422 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// FIBCompression selects the algorithm used by CompressFIB.
+type FIBCompression int
+
+const (
+	// CompressRedundant removes prefixes whose nearest covering prefix
+	// carries the same value. It never adds prefixes.
+	CompressRedundant FIBCompression = iota
+	// CompressORTC computes the smallest forwarding-equivalent table with
+	// the Optimal Routing Table Constructor ("Constructing Optimal IP
+	// Routing Tables", Draves et al.).
+	CompressORTC
+)
+
+func (c FIBCompression) String() string {
+	switch c {
+	case CompressRedundant:
+		return "redundant"
+	case CompressORTC:
+		return "ortc"
+	default:
+		return fmt.Sprintf("FIBCompression(%d)", int(c))
+	}
+}
+
+// FIBEntriesFromMap returns the entries of a flat prefix map, such as the
+// one returned by MapTrie.Dump, sorted by address and prefix length.
+func FIBEntriesFromMap[V any](m map[netip.Prefix]V) ([]netip.Prefix, []V) {
+	prefixes := make([]netip.Prefix, 0, len(m))
+	for prefix := range m {
+		prefixes = append(prefixes, prefix)
+	}
+	slices.SortFunc(prefixes, comparePrefixes)
+
+	values := make([]V, len(prefixes))
+	for idx, prefix := range prefixes {
+		values[idx] = m[prefix]
+	}
+	return prefixes, values
+}
+
+// comparePrefixes orders prefixes by address, then from shorter to longer,
+// so that covering prefixes precede the nested ones.
+func comparePrefixes(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Bits(), b.Bits())
+}
+
+// CompressFIB returns a table that forwards every address like the given
+// prefixes and values. When a prefix occurs more than once, the last
+// occurrence wins. Addresses not covered by the input stay uncovered.
+//
+// The result is sorted by address and prefix length.
+func CompressFIB[V comparable](prefixes []netip.Prefix, values []V, mode FIBCompression) ([]netip.Prefix, []V) {
+	indices, table := indexFIBValues(values)
+
+	var outPrefixes []netip.Prefix
+	var outIndices []uint32
+	switch mode {
+	case CompressRedundant:
+		outPrefixes, outIndices = removeRedundantPrefixes(prefixes, indices)
+	case CompressORTC:
+		outPrefixes, outIndices = ortc(prefixes, indices)
+	default:
+		panic(fmt.Sprintf("unknown FIB compression %v", mode))
+	}
+
+	outValues := make([]V, len(outIndices))
+	for idx, value := range outIndices {
+		outValues[idx] = table[value]
+	}
+	return outPrefixes, outValues
+}
+
+// indexFIBValues replaces values with indices of distinct values.
+func indexFIBValues[V comparable](values []V) ([]uint32, []V) {
+	indices := make([]uint32, len(values))
+	table := []V{}
+	seen := map[V]uint32{}
+	for idx, value := range values {
+		id, ok := seen[value]
+		if !ok {
+			id = uint32(len(table))
+			seen[value] = id
+			table = append(table, value)
+		}
+		indices[idx] = id
+	}
+	return indices, table
+}
+
+// uniqueFIBEntries returns masked, sorted prefixes with the last value of
+// duplicated ones.
+func uniqueFIBEntries[V any](prefixes []netip.Prefix, values []V) ([]netip.Prefix, []V) {
+	last := make(map[netip.Prefix]V, len(prefixes))
+	for idx, prefix := range prefixes {
+		last[prefix.Masked()] = values[idx]
+	}
+	return FIBEntriesFromMap(last)
+}
+
+// removeRedundantPrefixes drops every prefix whose nearest covering prefix
+// in the result carries the same value.
+func removeRedundantPrefixes(prefixes []netip.Prefix, values []uint32) ([]netip.Prefix, []uint32) {
+	prefixes, values = uniqueFIBEntries(prefixes, values)
+
+	type covering struct {
+		prefix netip.Prefix
+		value  uint32
+	}
+
+	outPrefixes := prefixes[:0:0]
+	outValues := values[:0:0]
+	stack := []covering{}
+	for idx, prefix := range prefixes {
+		for n := len(stack); n > 0 && !stack[n-1].prefix.Contains(prefix.Addr()); n-- {
+			stack = stack[:n-1]
+		}
+		// A dropped prefix does not need to be pushed: it forwards like the
+		// prefix on top of the stack.
+		if n := len(stack); n > 0 && stack[n-1].value == values[idx] {
+			continue
+		}
+		stack = append(stack, covering{prefix, values[idx]})
+		outPrefixes = append(outPrefixes, prefix)
+		outValues = append(outValues, values[idx])
+	}
+
+	return outPrefixes, outValues
+}
+
+// ortcNode is a node of the binary trie used by ORTC.
+type ortcNode struct {
+	child [2]int32
+	// value is the value index of the prefix ending at this node, or
+	// noValue.
+	value uint32
+	// setOff and setLen locate the sorted set of candidate values computed
+	// by the second pass in the trie pool.
+	setOff uint32
+	setLen uint32
+}
+
+// ortc runs the three ORTC passes over a binary trie of each family.
+//
+// The original algorithm assumes a default route. Without one, uncovered
+// addresses would need discard routes, which a plain prefix table cannot
+// express, so any subtree containing an uncovered address keeps it
+// uncovered and is only aggregated below the gaps.
+func ortc(prefixes []netip.Prefix, values []uint32) ([]netip.Prefix, []uint32) {
+	prefixes, values = uniqueFIBEntries(prefixes, values)
+
+	var outPrefixes []netip.Prefix
+	var outValues []uint32
+	for _, root := range []netip.Prefix{
+		netip.PrefixFrom(netip.IPv4Unspecified(), 0),
+		netip.PrefixFrom(netip.IPv6Unspecified(), 0),
+	} {
+		t := &ortcTrie{nodes: []ortcNode{{child: [2]int32{-1, -1}, value: noValue}}}
+		for idx, prefix := range prefixes {
+			if prefix.Addr().Is4() == root.Addr().Is4() {
+				t.insert(prefix, values[idx])
+			}
+		}
+
+		t.computeSets(0, noValue)
+		t.emit(0, root, noValue, noValue, func(prefix netip.Prefix, value uint32) {
+			outPrefixes = append(outPrefixes, prefix)
+			outValues = append(outValues, value)
+		})
+	}
+
+	order := make([]int, len(outPrefixes))
+	for idx := range order {
+		order[idx] = idx
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return comparePrefixes(outPrefixes[a], outPrefixes[b])
+	})
+
+	sortedPrefixes := make([]netip.Prefix, len(order))
+	sortedValues := make([]uint32, len(order))
+	for idx, from := range order {
+		sortedPrefixes[idx], sortedValues[idx] = outPrefixes[from], outValues[from]
+	}
+	return sortedPrefixes, sortedValues
+}
+
+type ortcTrie struct {
+	nodes []ortcNode
+	// pool holds the candidate sets of all nodes, so that the sets do not
+	// need an allocation per node.
+	pool []uint32
+}
+
+func (t *ortcTrie) insert(prefix netip.Prefix, value uint32) {
+	a := addrBytes(prefix.Addr())
+	n := int32(0)
+	for idx := range prefix.Bits() {
+		bit := addrBit(&a, idx)
+		if t.nodes[n].child[bit] < 0 {
+			t.nodes[n].child[bit] = int32(len(t.nodes))
+			t.nodes = append(t.nodes, ortcNode{child: [2]int32{-1, -1}, value: noValue})
+		}
+		n = t.nodes[n].child[bit]
+	}
+	t.nodes[n].value = value
+}
+
+// set returns the candidate set of the node.
+func (t *ortcTrie) set(n int32) []uint32 {
+	node := &t.nodes[n]
+	return t.pool[node.setOff : node.setOff+node.setLen]
+}
+
+// computeSets runs the first two ORTC passes: values are pushed down to
+// the leaves of the normalized trie, where missing children are implicit
+// leaves carrying the inherited value, and candidate sets are merged
+// bottom-up. It reports whether the subtree has uncovered addresses.
+func (t *ortcTrie) computeSets(n int32, inherited uint32) bool {
+	node := &t.nodes[n]
+	if node.value != noValue {
+		inherited = node.value
+	}
+
+	var leaves [2][1]uint32
+	var sets [2][]uint32
+	hole := false
+	for bit, child := range node.child {
+		if child < 0 {
+			leaves[bit][0] = inherited
+			sets[bit] = leaves[bit][:]
+			hole = hole || inherited == noValue
+			continue
+		}
+		hole = t.computeSets(child, inherited) || hole
+		sets[bit] = t.set(child)
+	}
+
+	// Child sets may point into the pool, appending keeps them valid since
+	// existing elements are never modified.
+	start := len(t.pool)
+	switch {
+	case hole:
+		t.pool = append(t.pool, noValue)
+	case node.child[0] < 0 && node.child[1] < 0:
+		t.pool = append(t.pool, inherited)
+	default:
+		if t.pool = appendIntersection(t.pool, sets[0], sets[1]); len(t.pool) == start {
+			t.pool = appendUnion(t.pool, sets[0], sets[1])
+		}
+	}
+
+	node = &t.nodes[n]
+	node.setOff, node.setLen = uint32(start), uint32(len(t.pool)-start)
+	return hole
+}
+
+// emit runs the third ORTC pass: every node keeps the value chosen above
+// it when possible, otherwise it picks a candidate and emits its prefix.
+func (t *ortcTrie) emit(n int32, prefix netip.Prefix, chosen, inherited uint32, fn func(netip.Prefix, uint32)) {
+	node := &t.nodes[n]
+	if node.value != noValue {
+		inherited = node.value
+	}
+
+	if set := t.set(n); !slices.Contains(set, chosen) {
+		chosen = set[0]
+		fn(prefix, chosen)
+	}
+
+	for bit, child := range node.child {
+		if child >= 0 {
+			t.emit(child, ortcChildPrefix(prefix, bit), chosen, inherited, fn)
+		} else if inherited != chosen {
+			// The implicit leaf keeps the inherited value, it is never
+			// noValue here since holes choose noValue above. Leaves always
+			// choose their inherited value, so this never happens below a
+			// full-length prefix.
+			fn(ortcChildPrefix(prefix, bit), inherited)
+		}
+	}
+}
+
+// ortcChildPrefix returns the half of the prefix selected by bit.
+func ortcChildPrefix(prefix netip.Prefix, bit int) netip.Prefix {
+	bits := prefix.Bits()
+	if bit == 0 {
+		return netip.PrefixFrom(prefix.Addr(), bits+1)
+	}
+	a := prefix.Addr().As16()
+	offset := bits
+	if prefix.Addr().Is4() {
+		offset += 96
+	}
+	a[offset/8] |= 0x80 >> (offset % 8)
+	addr := netip.AddrFrom16(a)
+	if prefix.Addr().Is4() {
+		addr = addr.Unmap()
+	}
+	return netip.PrefixFrom(addr, bits+1)
+}
+
+// appendIntersection appends the intersection of sorted sets to dst.
+func appendIntersection(dst, a, b []uint32) []uint32 {
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			dst = append(dst, a[i])
+			i++
+			j++
+		}
+	}
+	return dst
+}
+
+// appendUnion appends the union of sorted sets to dst.
+func appendUnion(dst, a, b []uint32) []uint32 {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			dst = append(dst, a[i])
+			i++
+		case a[i] > b[j]:
+			dst = append(dst, b[j])
+			j++
+		default:
+			dst = append(dst, a[i])
+			i++
+			j++
+		}
+	}
+	dst = append(dst, a[i:]...)
+	return append(dst, b[j:]...)
+}
+
+// VerifyForwardingEquivalence checks that two tables forward every address
+// to the same value, including leaving the same addresses uncovered.
+//
+// Both tables are flattened into minimal address ranges, which are equal
+// exactly when the tables are forwarding-equivalent, so the check covers
+// the whole address space rather than sampled addresses. The returned
+// error names the first address where the tables differ.
+func VerifyForwardingEquivalence[V comparable](prefixesA []netip.Prefix, valuesA []V, prefixesB []netip.Prefix, valuesB []V) error {
+	indicesA, indicesB, table := indexFIBValuePair(valuesA, valuesB)
+
+	for _, bitLen := range []int{32, 128} {
+		rangesA := flattenPrefixes(familyPrefixes(prefixesA, indicesA, bitLen))
+		rangesB := flattenPrefixes(familyPrefixes(prefixesB, indicesB, bitLen))
+
+		for idx := range max(len(rangesA), len(rangesB)) {
+			if idx < len(rangesA) && idx < len(rangesB) && rangesA[idx] == rangesB[idx] {
+				continue
+			}
+
+			var addr netip.Addr
+			switch {
+			case idx >= len(rangesA):
+				addr = rangesB[idx].Start
+			case idx >= len(rangesB):
+				addr = rangesA[idx].Start
+			case rangesA[idx].Start.Less(rangesB[idx].Start):
+				addr = rangesA[idx].Start
+			default:
+				addr = rangesB[idx].Start
+			}
+			return fmt.Errorf("tables differ at %s: %s vs %s", addr,
+				describeRangeValue(rangesA, addr, table), describeRangeValue(rangesB, addr, table))
+		}
+	}
+
+	return nil
+}
+
+// indexFIBValuePair indexes the values of two tables in a shared table.
+func indexFIBValuePair[V comparable](a, b []V) ([]uint32, []uint32, []V) {
+	indices, table := indexFIBValues(append(slices.Clip(a), b...))
+	return indices[:len(a)], indices[len(a):], table
+}
+
+// familyPrefixes returns the arguments for flattenPrefixes restricted to
+// one address family.
+func familyPrefixes(prefixes []netip.Prefix, values []uint32, bitLen int) ([]netip.Prefix, []uint32, int) {
+	var outPrefixes []netip.Prefix
+	var outValues []uint32
+	for idx, prefix := range prefixes {
+		if prefix.Addr().Is4() == (bitLen == 32) {
+			outPrefixes = append(outPrefixes, prefix)
+			outValues = append(outValues, values[idx])
+		}
+	}
+	return outPrefixes, outValues, bitLen
+}
+
+// describeRangeValue returns the value of the range containing addr.
+func describeRangeValue[V any](ranges []addrRange, addr netip.Addr, table []V) string {
+	idx, found := slices.BinarySearchFunc(ranges, addr, func(r addrRange, addr netip.Addr) int {
+		return r.Start.Compare(addr)
+	})
+	if !found {
+		idx--
+	}
+	if ranges[idx].Value == noValue {
+		return "no route"
+	}
+	return fmt.Sprint(table[ranges[idx].Value])
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseFIB converts "cidr=value" pairs into a table
+func parseFIB(entries []struct{ cidr, value string }) ([]netip.Prefix, []string) {
+	prefixes := make([]netip.Prefix, len(entries))
+	values := make([]string, len(entries))
+	for idx, e := range entries {
+		prefixes[idx] = netip.MustParsePrefix(e.cidr)
+		values[idx] = e.value
+	}
+	return prefixes, values
+}
+
+// TestCompressFIB tests both compression modes on hand-made tables
+func TestCompressFIB(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []struct{ cidr, value string }
+		redundant []string
+		ortc      []string
+	}{
+		{
+			name: "redundant more-specifics",
+			entries: []struct{ cidr, value string }{
+				{"10.0.0.0/8", "A"},
+				{"10.1.0.0/16", "A"},
+				{"10.1.1.0/24", "B"},
+				{"10.1.1.128/25", "A"},
+				{"10.1.1.192/26", "A"},
+			},
+			redundant: []string{"10.0.0.0/8", "10.1.1.0/24", "10.1.1.128/25"},
+			ortc:      []string{"10.0.0.0/8", "10.1.1.0/25"},
+		},
+		{
+			name: "sibling halves merge",
+			entries: []struct{ cidr, value string }{
+				{"10.0.0.0/9", "A"},
+				{"10.128.0.0/9", "A"},
+			},
+			redundant: []string{"10.0.0.0/9", "10.128.0.0/9"},
+			ortc:      []string{"10.0.0.0/8"},
+		},
+		{
+			name: "gap prevents merge",
+			entries: []struct{ cidr, value string }{
+				{"10.0.0.0/9", "A"},
+				{"10.192.0.0/10", "A"},
+			},
+			redundant: []string{"10.0.0.0/9", "10.192.0.0/10"},
+			ortc:      []string{"10.0.0.0/9", "10.192.0.0/10"},
+		},
+		{
+			name: "default route replaced by the majority value",
+			entries: []struct{ cidr, value string }{
+				{"0.0.0.0/0", "A"},
+				{"0.0.0.0/2", "B"},
+				{"64.0.0.0/2", "B"},
+				{"128.0.0.0/2", "B"},
+				{"192.0.0.0/2", "C"},
+			},
+			redundant: []string{"0.0.0.0/0", "0.0.0.0/2", "64.0.0.0/2", "128.0.0.0/2", "192.0.0.0/2"},
+			ortc:      []string{"0.0.0.0/0", "192.0.0.0/2"},
+		},
+		{
+			name: "IPv6 and duplicates",
+			entries: []struct{ cidr, value string }{
+				{"2001:db8::/32", "A"},
+				{"2001:db8::/33", "B"},
+				{"2001:db8::/33", "A"},
+				{"2001:db8:8000::/33", "A"},
+			},
+			redundant: []string{"2001:db8::/32"},
+			ortc:      []string{"2001:db8::/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, values := parseFIB(tt.entries)
+
+			for _, mode := range []struct {
+				mode FIBCompression
+				want []string
+			}{{CompressRedundant, tt.redundant}, {CompressORTC, tt.ortc}} {
+				gotPrefixes, gotValues := CompressFIB(prefixes, values, mode.mode)
+
+				got := make([]string, len(gotPrefixes))
+				for idx, prefix := range gotPrefixes {
+					got[idx] = prefix.String()
+				}
+				assert.Equal(t, mode.want, got, "%v", mode.mode)
+				assert.NoError(t, VerifyForwardingEquivalence(prefixes, values, gotPrefixes, gotValues), "%v", mode.mode)
+			}
+		})
+	}
+}
+
+// TestCompressFIBRandom compresses random tables with and without default
+// routes and checks equivalence both exhaustively and by lookups
+func TestCompressFIBRandom(t *testing.T) {
+	base := referencePrefixes(5000)
+	addrs := referenceAddrs(base, 5000)
+
+	withDefault := append([]netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/0"),
+		netip.MustParsePrefix("::/0"),
+	}, base...)
+
+	for _, tc := range []struct {
+		name     string
+		prefixes []netip.Prefix
+	}{
+		{"without_default", base},
+		{"with_default", withDefault},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			values := nextHopValues(len(tc.prefixes), 4)
+
+			reference := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+			for idx, prefix := range tc.prefixes {
+				reference.InsertOrUpdate(prefix, onEmptyString(values[idx]), onUpdateString(values[idx]))
+			}
+
+			redundant, _ := CompressFIB(tc.prefixes, values, CompressRedundant)
+			ortcPrefixes, _ := CompressFIB(tc.prefixes, values, CompressORTC)
+			assert.Less(t, len(redundant), reference.Len())
+			assert.LessOrEqual(t, len(ortcPrefixes), len(redundant))
+			t.Logf("prefixes: original %d, redundant %d, ortc %d", reference.Len(), len(redundant), len(ortcPrefixes))
+
+			for _, mode := range []FIBCompression{CompressRedundant, CompressORTC} {
+				gotPrefixes, gotValues := CompressFIB(tc.prefixes, values, mode)
+				require.NoError(t, VerifyForwardingEquivalence(tc.prefixes, values, gotPrefixes, gotValues), "%v", mode)
+
+				compressed := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+				for idx, prefix := range gotPrefixes {
+					compressed.InsertOrUpdate(prefix, onEmptyString(gotValues[idx]), onUpdateString(gotValues[idx]))
+				}
+				for _, addr := range addrs {
+					_, want, wantOk := reference.Lookup(addr)
+					_, got, ok := compressed.Lookup(addr)
+					require.Equal(t, wantOk, ok, "%v: Lookup(%s)", mode, addr)
+					require.Equal(t, want, got, "%v: Lookup(%s)", mode, addr)
+				}
+
+				// Compression is idempotent.
+				againPrefixes, _ := CompressFIB(gotPrefixes, gotValues, mode)
+				assert.Len(t, againPrefixes, len(gotPrefixes), "%v", mode)
+			}
+		})
+	}
+}
+
+// TestVerifyForwardingEquivalence tests that differences are reported with
+// the first differing address
+func TestVerifyForwardingEquivalence(t *testing.T) {
+	prefixes, values := parseFIB([]struct{ cidr, value string }{
+		{"10.0.0.0/8", "A"},
+		{"10.1.0.0/16", "B"},
+		{"2001:db8::/32", "C"},
+	})
+
+	tests := []struct {
+		name    string
+		entries []struct{ cidr, value string }
+		errText string
+	}{
+		{
+			name: "equivalent split",
+			entries: []struct{ cidr, value string }{
+				{"10.0.0.0/9", "A"},
+				{"10.128.0.0/9", "A"},
+				{"10.1.0.0/16", "B"},
+				{"2001:db8::/32", "C"},
+			},
+		},
+		{
+			name: "different value",
+			entries: []struct{ cidr, value string }{
+				{"10.0.0.0/8", "A"},
+				{"10.1.0.0/16", "B"},
+				{"10.1.2.3/32", "A"},
+				{"2001:db8::/32", "C"},
+			},
+			errText: "tables differ at 10.1.2.3: B vs A",
+		},
+		{
+			name: "missing route",
+			entries: []struct{ cidr, value string }{
+				{"10.0.0.0/8", "A"},
+				{"10.1.0.0/16", "B"},
+			},
+			errText: "tables differ at 2001:db8::: C vs no route",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			otherPrefixes, otherValues := parseFIB(tt.entries)
+			err := VerifyForwardingEquivalence(prefixes, values, otherPrefixes, otherValues)
+			if tt.errText == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.errText)
+		})
+	}
+}
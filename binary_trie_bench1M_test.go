@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+// BenchmarkBinaryTrieInsert1M benchmarks insertion of 1M prefixes
+func BenchmarkBinaryTrieInsert1M(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []netip.Prefix
+	}{
+		{"ipv4_1M_prefixes", randomIPv4Prefixes(1000_000)},
+		{"ipv6_1M_prefixes", randomIPv6Prefixes(1000_000)},
+	}
+	values := datacenterValues(1000_000)
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			trie := NewBinaryTrie[string]()
+			idx := 0
+
+			for b.Loop() {
+				trie.Insert(bm.prefixes[idx], values[idx])
+				idx = (idx + 1) % 1000_000
+			}
+		})
+	}
+}
+
+// BenchmarkBinaryTrieLookup1M benchmarks lookups in a BinaryTrie with 1M prefixes
+func BenchmarkBinaryTrieLookup1M(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []netip.Prefix
+		addrs    []netip.Addr
+	}{
+		{"ipv4_1M_prefixes", randomIPv4Prefixes(1000_000), randomIPv4Addrs(1000)},
+		{"ipv6_1M_prefixes", randomIPv6Prefixes(1000_000), randomIPv6Addrs(1000)},
+	}
+	values := datacenterValues(1000_000)
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			// Measure memory before insertion
+			runtime.GC()
+			var memBefore runtime.MemStats
+			runtime.ReadMemStats(&memBefore)
+
+			// Setup: Insert 1M prefixes
+			trie := NewBinaryTrie[string]()
+			for i := range 1000_000 {
+				trie.Insert(bm.prefixes[i], values[i])
+			}
+
+			// Measure memory after insertion
+			runtime.GC()
+			var memAfter runtime.MemStats
+			runtime.ReadMemStats(&memAfter)
+
+			allocDiff := memAfter.Alloc - memBefore.Alloc
+			totalAllocDiff := memAfter.TotalAlloc - memBefore.TotalAlloc
+
+			b.Logf("Memory usage after 1M inserts: Alloc=%d bytes (%.2f MB), TotalAlloc=%d bytes (%.2f MB)",
+				allocDiff, float64(allocDiff)/(1024*1024),
+				totalAllocDiff, float64(totalAllocDiff)/(1024*1024))
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			foundCount := 0
+			for b.Loop() {
+				_, val, ok := trie.Lookup(bm.addrs[idx])
+				if ok && val != "" {
+					foundCount++
+				}
+				idx = (idx + 1) % len(bm.addrs)
+			}
+
+			if foundCount == 0 {
+				b.Fatalf("No successful lookups in %d iterations", b.N)
+			}
+		})
+	}
+}
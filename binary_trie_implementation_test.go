@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/netip"
+)
+
+// addrBytes returns the address bytes, with IPv4 addresses stored in the
+// first four bytes.
+func addrBytes(addr netip.Addr) [16]byte {
+	if addr.Is4() {
+		var out [16]byte
+		a := addr.As4()
+		copy(out[:], a[:])
+		return out
+	}
+	return addr.As16()
+}
+
+// addrBit returns the bit of the address bytes at the given position,
+// counting from the most significant bit.
+func addrBit(a *[16]byte, idx int) int {
+	return int(a[idx/8]>>(7-idx%8)) & 1
+}
+
+// binaryNode is a node of the BinaryTrie.
+type binaryNode[V any] struct {
+	children [2]*binaryNode[V]
+	value    V
+	ok       bool
+}
+
+// BinaryTrie is a plain 1-bit trie over netip.Prefix.
+//
+// Every node consumes exactly one address bit, so a prefix of length L is
+// stored L levels below the root of its family. It is the simplest
+// possible LPM structure and serves as a reference model for correctness
+// tests of the other implementations.
+//
+// The type parameter V represents the value type stored for each prefix.
+type BinaryTrie[V any] struct {
+	v4   *binaryNode[V]
+	v6   *binaryNode[V]
+	size int
+}
+
+// NewBinaryTrie returns an empty BinaryTrie.
+func NewBinaryTrie[V any]() *BinaryTrie[V] {
+	return &BinaryTrie[V]{
+		v4: &binaryNode[V]{},
+		v6: &binaryNode[V]{},
+	}
+}
+
+// root returns the root node for the family of the given address.
+func (t *BinaryTrie[V]) root(addr netip.Addr) *binaryNode[V] {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// Insert adds a new prefix or replaces the value of an existing one.
+func (t *BinaryTrie[V]) Insert(prefix netip.Prefix, value V) {
+	prefix = prefix.Masked()
+	a := addrBytes(prefix.Addr())
+
+	n := t.root(prefix.Addr())
+	for idx := range prefix.Bits() {
+		bit := addrBit(&a, idx)
+		if n.children[bit] == nil {
+			n.children[bit] = &binaryNode[V]{}
+		}
+		n = n.children[bit]
+	}
+
+	if !n.ok {
+		t.size++
+	}
+	n.value = value
+	n.ok = true
+}
+
+// Get returns the value stored for exactly the given prefix.
+func (t *BinaryTrie[V]) Get(prefix netip.Prefix) (V, bool) {
+	prefix = prefix.Masked()
+	a := addrBytes(prefix.Addr())
+
+	n := t.root(prefix.Addr())
+	for idx := 0; n != nil && idx < prefix.Bits(); idx++ {
+		n = n.children[addrBit(&a, idx)]
+	}
+
+	if n == nil || !n.ok {
+		var zero V
+		return zero, false
+	}
+	return n.value, true
+}
+
+// Delete removes the prefix from the trie, pruning nodes that become
+// useless.
+//
+// Returns false if the prefix was not found.
+func (t *BinaryTrie[V]) Delete(prefix netip.Prefix) bool {
+	prefix = prefix.Masked()
+	a := addrBytes(prefix.Addr())
+
+	path := make([]*binaryNode[V], 0, prefix.Bits()+1)
+	n := t.root(prefix.Addr())
+	for idx := 0; n != nil && idx < prefix.Bits(); idx++ {
+		path = append(path, n)
+		n = n.children[addrBit(&a, idx)]
+	}
+	if n == nil || !n.ok {
+		return false
+	}
+
+	var zero V
+	n.value = zero
+	n.ok = false
+	t.size--
+
+	// Prune childless nodes without a value up to the root.
+	for idx := len(path) - 1; idx >= 0; idx-- {
+		if n.ok || n.children[0] != nil || n.children[1] != nil {
+			break
+		}
+		path[idx].children[addrBit(&a, idx)] = nil
+		n = path[idx]
+	}
+
+	return true
+}
+
+// Lookup searches the trie for a value that matches the longest possible
+// prefix for the given address.
+//
+// If no match is found, the function returns an invalid prefix, the zero
+// value and false.
+func (t *BinaryTrie[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	a := addrBytes(addr)
+
+	var best *binaryNode[V]
+	bestBits := 0
+
+	n := t.root(addr)
+	for idx := 0; ; idx++ {
+		if n.ok {
+			best, bestBits = n, idx
+		}
+		if idx == addr.BitLen() {
+			break
+		}
+		if n = n.children[addrBit(&a, idx)]; n == nil {
+			break
+		}
+	}
+
+	if best == nil {
+		var zero V
+		return netip.Prefix{}, zero, false
+	}
+
+	prefix, _ := addr.Prefix(bestBits)
+	return prefix, best.value, true
+}
+
+// Len returns the total number of prefixes stored in the trie.
+func (t *BinaryTrie[V]) Len() int {
+	return t.size
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPrefixTableOperations runs the common insert, lookup and delete
+// scenarios against a prefix table implementation.
+func testPrefixTableOperations(t *testing.T, newTable func() prefixTable[string]) {
+	t.Run("lookup empty", func(t *testing.T) {
+		table := newTable()
+		_, _, ok := table.Lookup(netip.MustParseAddr("192.168.9.1"))
+		assert.False(t, ok)
+		_, _, ok = table.Lookup(netip.MustParseAddr("2001:db8::1"))
+		assert.False(t, ok)
+	})
+
+	t.Run("longest prefix match", func(t *testing.T) {
+		table := newTable()
+		for _, cidr := range []string{
+			"10.0.0.0/8", "10.1.0.0/16", "10.1.1.0/24", "10.1.1.128/25",
+			"2001:db8::/32", "2001:db8:1::/48", "::/0",
+		} {
+			table.Insert(netip.MustParsePrefix(cidr), cidr)
+		}
+		require.Equal(t, 7, table.Len())
+
+		tests := []struct{ addr, want string }{
+			{"10.0.0.1", "10.0.0.0/8"},
+			{"10.1.0.1", "10.1.0.0/16"},
+			{"10.1.1.1", "10.1.1.0/24"},
+			{"10.1.1.129", "10.1.1.128/25"},
+			{"11.0.0.1", ""},
+			{"2001:db8:1::1", "2001:db8:1::/48"},
+			{"2001:db8:2::1", "2001:db8::/32"},
+			{"2001:db9::1", "::/0"},
+		}
+		for _, tt := range tests {
+			prefix, got, ok := table.Lookup(netip.MustParseAddr(tt.addr))
+			if tt.want == "" {
+				assert.False(t, ok, "Lookup(%s) = %q", tt.addr, got)
+				continue
+			}
+			require.True(t, ok, "Lookup(%s)", tt.addr)
+			assert.Equal(t, tt.want, got, "Lookup(%s)", tt.addr)
+			assert.Equal(t, tt.want, prefix.String(), "Lookup(%s)", tt.addr)
+		}
+	})
+
+	t.Run("update existing prefix", func(t *testing.T) {
+		table := newTable()
+		table.Insert(netip.MustParsePrefix("192.168.0.0/16"), "OLD")
+		table.Insert(netip.MustParsePrefix("192.168.0.0/16"), "NEW")
+		require.Equal(t, 1, table.Len())
+
+		_, got, ok := table.Lookup(netip.MustParseAddr("192.168.1.1"))
+		require.True(t, ok)
+		assert.Equal(t, "NEW", got)
+	})
+
+	t.Run("unmasked prefix", func(t *testing.T) {
+		table := newTable()
+		table.Insert(netip.MustParsePrefix("192.168.1.77/24"), "DC1")
+
+		prefix, got, ok := table.Lookup(netip.MustParseAddr("192.168.1.1"))
+		require.True(t, ok)
+		assert.Equal(t, "DC1", got)
+		assert.Equal(t, netip.MustParsePrefix("192.168.1.0/24"), prefix)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		table := newTable()
+		for _, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.1.0/24", "10.2.0.0/16"} {
+			table.Insert(netip.MustParsePrefix(cidr), cidr)
+		}
+
+		assert.False(t, table.Delete(netip.MustParsePrefix("10.3.0.0/16")))
+		assert.False(t, table.Delete(netip.MustParsePrefix("10.0.0.0/9")))
+
+		// Deleting an inner prefix keeps its descendants reachable.
+		require.True(t, table.Delete(netip.MustParsePrefix("10.1.0.0/16")))
+		_, got, _ := table.Lookup(netip.MustParseAddr("10.1.1.1"))
+		assert.Equal(t, "10.1.1.0/24", got)
+		_, got, _ = table.Lookup(netip.MustParseAddr("10.1.2.1"))
+		assert.Equal(t, "10.0.0.0/8", got)
+		assert.False(t, table.Delete(netip.MustParsePrefix("10.1.0.0/16")))
+
+		require.True(t, table.Delete(netip.MustParsePrefix("10.1.1.0/24")))
+		require.True(t, table.Delete(netip.MustParsePrefix("10.0.0.0/8")))
+		_, got, _ = table.Lookup(netip.MustParseAddr("10.2.0.1"))
+		assert.Equal(t, "10.2.0.0/16", got)
+
+		require.True(t, table.Delete(netip.MustParsePrefix("10.2.0.0/16")))
+		assert.Equal(t, 0, table.Len())
+		_, _, ok := table.Lookup(netip.MustParseAddr("10.2.0.1"))
+		assert.False(t, ok)
+	})
+}
+
+// testPrefixTableMatchesMapTrie inserts and deletes random prefixes in the
+// table and MapTrie and compares lookups after every phase.
+func testPrefixTableMatchesMapTrie(t *testing.T, table prefixTable[int]) {
+	prefixes := referencePrefixes(5000)
+	addrs := referenceAddrs(prefixes, 5000)
+	reference := NewMapTrie[netip.Prefix, netip.Addr, int](0)
+
+	compare := func(phase string) {
+		require.Equal(t, reference.Len(), table.Len(), phase)
+		for _, addr := range addrs {
+			wantPrefix, want, wantOk := reference.Lookup(addr)
+			gotPrefix, got, ok := table.Lookup(addr)
+			require.Equal(t, wantOk, ok, "%s: Lookup(%s)", phase, addr)
+			require.Equal(t, want, got, "%s: Lookup(%s)", phase, addr)
+			require.Equal(t, wantPrefix, gotPrefix, "%s: Lookup(%s)", phase, addr)
+		}
+	}
+
+	for idx, prefix := range prefixes {
+		table.Insert(prefix, idx)
+		reference.InsertOrUpdate(prefix, onEmpty(idx), onUpdate(idx))
+	}
+	compare("insert")
+
+	deleted := func(int) (int, bool) { return 0, true }
+	for idx, prefix := range prefixes {
+		if idx%2 == 0 {
+			table.Delete(prefix)
+			reference.UpdateOrDelete(prefix, deleted)
+		}
+	}
+	compare("delete")
+}
+
+func TestBinaryTrieOperations(t *testing.T) {
+	testPrefixTableOperations(t, func() prefixTable[string] { return NewBinaryTrie[string]() })
+}
+
+func TestBinaryTrieMatchesMapTrie(t *testing.T) {
+	testPrefixTableMatchesMapTrie(t, NewBinaryTrie[int]())
+}
+
+// TestBinaryTrieDeletePrunes verifies that deletion releases unused nodes
+func TestBinaryTrieDeletePrunes(t *testing.T) {
+	trie := NewBinaryTrie[int]()
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/8"), 1)
+	trie.Insert(netip.MustParsePrefix("10.1.1.0/24"), 2)
+
+	require.True(t, trie.Delete(netip.MustParsePrefix("10.1.1.0/24")))
+
+	// Only the path to 10.0.0.0/8 must be left.
+	n := trie.v4
+	for range 8 {
+		require.False(t, n.children[0] != nil && n.children[1] != nil)
+		if n.children[0] != nil {
+			n = n.children[0]
+		} else {
+			n = n.children[1]
+		}
+		require.NotNil(t, n)
+	}
+	assert.True(t, n.ok)
+	assert.Nil(t, n.children[0])
+	assert.Nil(t, n.children[1])
+
+	v, ok := trie.Get(netip.MustParsePrefix("10.0.0.0/8"))
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+// BenchmarkBinaryTrieLookup benchmarks lookup performance
+func BenchmarkBinaryTrieLookup(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []string
+		lookups  []string
+	}{
+		{
+			name:     "single_prefix_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"192.168.1.1"},
+		},
+		{
+			name: "100_prefixes_deep_lookup",
+			prefixes: func() []string {
+				var prefixes []string
+				for i := range 100 {
+					prefixes = append(prefixes,
+						fmt.Sprintf("10.%d.0.0/16", i%256))
+				}
+				return prefixes
+			}(),
+			lookups: []string{"10.50.0.1", "10.99.0.1", "10.0.0.1"},
+		},
+		{
+			name:     "ipv6_lookup",
+			prefixes: []string{"2001:db8::/32", "2001:db8:1::/48"},
+			lookups:  []string{"2001:db8:1::1"},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			trie := NewBinaryTrie[string]()
+			for j, cidr := range bm.prefixes {
+				trie.Insert(netip.MustParsePrefix(cidr), fmt.Sprintf("DC%d", j))
+			}
+
+			addrs := make([]netip.Addr, len(bm.lookups))
+			for i, lookup := range bm.lookups {
+				addrs[i] = netip.MustParseAddr(lookup)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for b.Loop() {
+				for _, addr := range addrs {
+					_, _, _ = trie.Lookup(addr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+// bloomMapTrieBenchmarks returns the 1M datasets together with the filter
+// configurations to compare.
+func bloomMapTrieBenchmarks() []struct {
+	name     string
+	cfg      BloomConfig
+	prefixes []netip.Prefix
+	addrs    []netip.Addr
+} {
+	v4, v6 := randomIPv4Prefixes(1000_000), randomIPv6Prefixes(1000_000)
+	v4Addrs, v6Addrs := randomIPv4Addrs(1000), randomIPv6Addrs(1000)
+
+	return []struct {
+		name     string
+		cfg      BloomConfig
+		prefixes []netip.Prefix
+		addrs    []netip.Addr
+	}{
+		{"ipv4_1M_prefixes", DefaultBloomConfig(len(v4)), v4, v4Addrs},
+		{"ipv6_1M_prefixes", DefaultBloomConfig(len(v6)), v6, v6Addrs},
+		{"ipv6_1M_prefixes_small_filter", BloomConfig{Entries: len(v6), CountersPerEntry: 4, Hashes: 3}, v6, v6Addrs},
+	}
+}
+
+// BenchmarkBloomMapTrieInsert1M benchmarks insertion of 1M prefixes
+func BenchmarkBloomMapTrieInsert1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	for _, bm := range bloomMapTrieBenchmarks() {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			trie := NewBloomMapTrie[netip.Prefix, netip.Addr, string](0, bm.cfg)
+			idx := 0
+
+			for b.Loop() {
+				trie.InsertOrUpdate(bm.prefixes[idx], onEmptyString(values[idx]), onUpdateString(values[idx]))
+				idx = (idx + 1) % len(bm.prefixes)
+			}
+		})
+	}
+}
+
+// BenchmarkBloomMapTrieChurn1M benchmarks updates of a trie holding 1M
+// prefixes: every iteration withdraws a prefix and announces it again
+func BenchmarkBloomMapTrieChurn1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+	deleted := func(string) (string, bool) { return "", true }
+
+	for _, bm := range bloomMapTrieBenchmarks() {
+		b.Run(bm.name, func(b *testing.B) {
+			trie := NewBloomMapTrie[netip.Prefix, netip.Addr, string](len(bm.prefixes)/128, bm.cfg)
+			for i, prefix := range bm.prefixes {
+				trie.InsertOrUpdate(prefix, onEmptyString(values[i]), onUpdateString(values[i]))
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			for b.Loop() {
+				trie.UpdateOrDelete(bm.prefixes[idx], deleted)
+				trie.InsertOrUpdate(bm.prefixes[idx], onEmptyString(values[idx]), onUpdateString(values[idx]))
+				idx = (idx + 1) % len(bm.prefixes)
+			}
+		})
+	}
+}
+
+// BenchmarkBloomMapTrieLookup1M benchmarks lookups in a trie with 1M
+// prefixes and reports the filter false positive rate
+func BenchmarkBloomMapTrieLookup1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	for _, bm := range bloomMapTrieBenchmarks() {
+		b.Run(bm.name, func(b *testing.B) {
+			// Measure memory before insertion
+			runtime.GC()
+			var memBefore runtime.MemStats
+			runtime.ReadMemStats(&memBefore)
+
+			// Setup: Insert 1M prefixes
+			trie := NewBloomMapTrie[netip.Prefix, netip.Addr, string](len(bm.prefixes)/128, bm.cfg)
+			for i, prefix := range bm.prefixes {
+				trie.InsertOrUpdate(prefix, onEmptyString(values[i]), onUpdateString(values[i]))
+			}
+
+			// Measure memory after insertion
+			runtime.GC()
+			var memAfter runtime.MemStats
+			runtime.ReadMemStats(&memAfter)
+
+			allocDiff := memAfter.Alloc - memBefore.Alloc
+			totalAllocDiff := memAfter.TotalAlloc - memBefore.TotalAlloc
+
+			b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB), TotalAlloc=%d bytes (%.2f MB)",
+				len(bm.prefixes), allocDiff, float64(allocDiff)/(1024*1024),
+				totalAllocDiff, float64(totalAllocDiff)/(1024*1024))
+
+			stats := trie.ProbeStats(bm.addrs)
+			b.Logf("filter counters: %d, probes: %+v, false positive rate: %.4f (expected %.4f)",
+				len(trie.filter.counters), stats, stats.FalsePositiveRate(), trie.ExpectedFalsePositiveRate())
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			foundCount := 0
+			for b.Loop() {
+				_, val, ok := trie.Lookup(bm.addrs[idx])
+				if ok && val != "" {
+					foundCount++
+				}
+				idx = (idx + 1) % len(bm.addrs)
+			}
+
+			if foundCount == 0 {
+				b.Fatalf("No successful lookups in %d iterations", b.N)
+			}
+
+			b.ReportMetric(stats.FalsePositiveRate(), "fp-rate")
+			b.ReportMetric(float64(stats.FalsePositives+stats.Hits)/float64(stats.Lookups), "map-probes/op")
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"net/netip"
+)
+
+// BloomConfig configures the counting Bloom filter of a BloomMapTrie.
+type BloomConfig struct {
+	// Entries is the expected number of prefixes.
+	Entries int
+	// CountersPerEntry is the number of filter counters per expected
+	// prefix. The filter size is rounded up to a power of two.
+	CountersPerEntry int
+	// Hashes is the number of counters touched by every prefix, at most 10.
+	Hashes int
+}
+
+// DefaultBloomConfig returns a filter configuration for the given number
+// of prefixes with a false positive rate well below 1%.
+func DefaultBloomConfig(entries int) BloomConfig {
+	return BloomConfig{
+		Entries:          entries,
+		CountersPerEntry: 16,
+		Hashes:           6,
+	}
+}
+
+// countingBloom is a blocked counting Bloom filter over 64-bit hashes.
+//
+// All counters of a hash fall into a single block of 64, and a bit array
+// mirrors which counters are non-zero, so a query reads exactly one word
+// from an array eight times smaller than the counters.
+//
+// Counters saturate at 255 and are never decremented afterwards, which
+// may only increase the false positive rate but never introduces false
+// negatives.
+type countingBloom struct {
+	counters []uint8
+	words    []uint64
+	mask     uint64
+	hashes   int
+}
+
+func newCountingBloom(cfg BloomConfig) countingBloom {
+	size := max(64, cfg.Entries*cfg.CountersPerEntry)
+	size = 1 << bits.Len(uint(size-1))
+
+	return countingBloom{
+		counters: make([]uint8, size),
+		words:    make([]uint64, size/64),
+		mask:     uint64(size/64 - 1),
+		hashes:   min(max(1, cfg.Hashes), 10),
+	}
+}
+
+// block returns the word index of the hash and the bits it sets in it.
+// The word comes from the low bits of h, the bit offsets from successive
+// 6-bit groups of the high bits of a remixed h.
+func (f *countingBloom) block(h uint64) (uint64, uint64) {
+	g := h * 0x9e3779b97f4a7c15
+	var set uint64
+	for i := range f.hashes {
+		set |= 1 << (g >> (58 - 6*i) & 63)
+	}
+	return h & f.mask, set
+}
+
+func (f *countingBloom) add(h uint64) {
+	word, set := f.block(h)
+	f.words[word] |= set
+	for ; set != 0; set &= set - 1 {
+		idx := word*64 + uint64(bits.TrailingZeros64(set))
+		if f.counters[idx] != math.MaxUint8 {
+			f.counters[idx]++
+		}
+	}
+}
+
+func (f *countingBloom) remove(h uint64) {
+	word, set := f.block(h)
+	for ; set != 0; set &= set - 1 {
+		bit := uint64(bits.TrailingZeros64(set))
+		idx := word*64 + bit
+		if f.counters[idx] == 0 || f.counters[idx] == math.MaxUint8 {
+			continue
+		}
+		if f.counters[idx]--; f.counters[idx] == 0 {
+			f.words[word] &^= 1 << bit
+		}
+	}
+}
+
+func (f *countingBloom) mayContain(h uint64) bool {
+	word, set := f.block(h)
+	return f.words[word]&set == set
+}
+
+// bloomHash hashes a prefix for the filter. netip.Prefix keys are mixed
+// directly from the address words, which is several times faster than
+// maphash.Comparable, other key types fall back to maphash.
+func bloomHash[K comparable](seed maphash.Seed, prefix K) uint64 {
+	if p, ok := any(prefix).(netip.Prefix); ok {
+		a := p.Addr().As16()
+		hi := binary.BigEndian.Uint64(a[:8])
+		lo := binary.BigEndian.Uint64(a[8:]) ^ uint64(p.Bits())<<1
+		mulHi, mulLo := bits.Mul64(hi^0xa0761d6478bd642f, lo^0xe7037ed1a0b428db)
+		return mulHi ^ mulLo
+	}
+	return maphash.Comparable(seed, prefix)
+}
+
+// BloomMapTrie is a MapTrie variant that answers most misses without
+// touching the per-length maps.
+//
+// It keeps the number of prefixes for every length, so empty lengths are
+// skipped entirely, and a single counting Bloom filter over all stored
+// prefixes that is consulted before every map probe.
+//
+// The type parameters have the same meaning as for MapTrie.
+type BloomMapTrie[K MapTrieKey[K], Q MapTrieQuery[K], V any] struct {
+	trie    MapTrie[K, Q, V]
+	filter  countingBloom
+	seed    maphash.Seed
+	lengths [129]int
+}
+
+// BloomProbeStats summarizes filter effectiveness for a set of lookups.
+type BloomProbeStats struct {
+	// Lookups is the number of lookups performed.
+	Lookups int
+	// Hits is the number of lookups that found a prefix.
+	Hits int
+	// SkippedLengths is the number of probes avoided because no prefix of
+	// that length is stored.
+	SkippedLengths int
+	// FilterChecks is the number of filter queries.
+	FilterChecks int
+	// FilterNegatives is the number of map probes avoided by the filter.
+	FilterNegatives int
+	// FalsePositives is the number of map probes that passed the filter but
+	// found nothing.
+	FalsePositives int
+}
+
+// FalsePositiveRate returns the share of absent prefixes that passed the
+// filter.
+func (s BloomProbeStats) FalsePositiveRate() float64 {
+	absent := s.FalsePositives + s.FilterNegatives
+	if absent == 0 {
+		return 0
+	}
+	return float64(s.FalsePositives) / float64(absent)
+}
+
+// NewBloomMapTrie returns a new BloomMapTrie with the specified initial map
+// capacity and filter configuration.
+func NewBloomMapTrie[K MapTrieKey[K], Q MapTrieQuery[K], V any](cap int, cfg BloomConfig) *BloomMapTrie[K, Q, V] {
+	return &BloomMapTrie[K, Q, V]{
+		trie:   NewMapTrie[K, Q, V](cap),
+		filter: newCountingBloom(cfg),
+		seed:   maphash.MakeSeed(),
+	}
+}
+
+// Lookup searches the BloomMapTrie for a value that matches the longest
+// possible prefix for the given query.
+//
+// If no match is found, the function returns the zero value and false.
+func (m *BloomMapTrie[K, Q, V]) Lookup(query Q) (K, V, bool) {
+	for bits := query.BitLen(); bits >= 0; bits-- {
+		if m.lengths[bits] == 0 {
+			continue
+		}
+
+		prefix, _ := query.Prefix(bits)
+		if !m.filter.mayContain(bloomHash(m.seed, prefix)) {
+			continue
+		}
+
+		if value, ok := m.trie[bits][prefix]; ok {
+			return prefix, value, true
+		}
+	}
+
+	var zeroPrefix K
+	var zeroValue V
+	return zeroPrefix, zeroValue, false
+}
+
+// ProbeStats runs lookups for the given queries and counts how many map
+// probes were avoided by the length counters and by the filter.
+func (m *BloomMapTrie[K, Q, V]) ProbeStats(queries []Q) BloomProbeStats {
+	stats := BloomProbeStats{}
+
+	for _, query := range queries {
+		stats.Lookups++
+		for bits := query.BitLen(); bits >= 0; bits-- {
+			if m.lengths[bits] == 0 {
+				stats.SkippedLengths++
+				continue
+			}
+
+			prefix, _ := query.Prefix(bits)
+			stats.FilterChecks++
+			if !m.filter.mayContain(bloomHash(m.seed, prefix)) {
+				stats.FilterNegatives++
+				continue
+			}
+
+			if _, ok := m.trie[bits][prefix]; ok {
+				stats.Hits++
+				break
+			}
+			stats.FalsePositives++
+		}
+	}
+
+	return stats
+}
+
+// InsertOrUpdate adds a new entry or updates an existing one in the
+// BloomMapTrie, keeping the filter in sync.
+func (m *BloomMapTrie[K, Q, V]) InsertOrUpdate(prefix K, onEmpty func() V, onUpdate func(V) V) {
+	prefix = prefix.Masked()
+	bits := prefix.Bits()
+
+	if _, ok := m.trie[bits][prefix]; !ok {
+		m.filter.add(bloomHash(m.seed, prefix))
+		m.lengths[bits]++
+	}
+
+	m.trie.InsertOrUpdate(prefix, onEmpty, onUpdate)
+}
+
+// UpdateOrDelete updates existing entry and deletes it from the
+// BloomMapTrie if update indicates that updated entry becomes empty.
+func (m *BloomMapTrie[K, Q, V]) UpdateOrDelete(prefix K, update func(V) (V, bool)) {
+	prefix = prefix.Masked()
+	bits := prefix.Bits()
+
+	if _, ok := m.trie[bits][prefix]; !ok {
+		return
+	}
+
+	m.trie.UpdateOrDelete(prefix, update)
+
+	if _, ok := m.trie[bits][prefix]; !ok {
+		m.filter.remove(bloomHash(m.seed, prefix))
+		m.lengths[bits]--
+	}
+}
+
+// Len returns the total number of prefixes stored in the BloomMapTrie.
+func (m *BloomMapTrie[K, Q, V]) Len() int {
+	return m.trie.Len()
+}
+
+// ExpectedFalsePositiveRate returns the theoretical false positive rate of
+// the filter for the current number of prefixes.
+func (m *BloomMapTrie[K, Q, V]) ExpectedFalsePositiveRate() float64 {
+	// Blocking skews the load between words, so this slightly
+	// underestimates the rate of a blocked filter.
+	k := float64(m.filter.hashes)
+	n := float64(m.Len())
+	size := float64(len(m.filter.counters))
+	return math.Pow(1-math.Exp(-k*n/size), k)
+}
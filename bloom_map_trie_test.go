@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBloomMapTrieBasicOperations tests basic insert and lookup operations
+func TestBloomMapTrieBasicOperations(t *testing.T) {
+	trie := NewBloomMapTrie[netip.Prefix, netip.Addr, string](0, DefaultBloomConfig(16))
+
+	prefixes := []struct{ cidr, value string }{
+		{"10.0.0.0/8", "DC1"},
+		{"10.1.0.0/16", "DC2"},
+		{"10.1.1.0/24", "DC3"},
+		{"2001:db8::/32", "DC4"},
+		{"2001:db8:1::/48", "DC5"},
+	}
+	for _, p := range prefixes {
+		trie.InsertOrUpdate(netip.MustParsePrefix(p.cidr), onEmptyString(p.value), onUpdateString(p.value))
+	}
+	require.Equal(t, len(prefixes), trie.Len())
+
+	lookups := []struct{ addr, prefix, want string }{
+		{"10.0.0.1", "10.0.0.0/8", "DC1"},
+		{"10.1.0.1", "10.1.0.0/16", "DC2"},
+		{"10.1.1.1", "10.1.1.0/24", "DC3"},
+		{"2001:db8::1", "2001:db8::/32", "DC4"},
+		{"2001:db8:1::1", "2001:db8:1::/48", "DC5"},
+		{"11.0.0.1", "", ""},
+		{"2001:db9::1", "", ""},
+	}
+	for _, lookup := range lookups {
+		prefix, got, found := trie.Lookup(netip.MustParseAddr(lookup.addr))
+		if lookup.want == "" {
+			assert.False(t, found, "Lookup(%s) = %q, want not found", lookup.addr, got)
+			continue
+		}
+		assert.True(t, found, "Lookup(%s) not found", lookup.addr)
+		assert.Equal(t, netip.MustParsePrefix(lookup.prefix), prefix, "Lookup(%s)", lookup.addr)
+		assert.Equal(t, lookup.want, got, "Lookup(%s)", lookup.addr)
+	}
+}
+
+// TestBloomMapTrieUpdateOrDelete tests that the filter and the length
+// counters follow updates and deletions
+func TestBloomMapTrieUpdateOrDelete(t *testing.T) {
+	trie := NewBloomMapTrie[netip.Prefix, netip.Addr, int](0, DefaultBloomConfig(16))
+	addr := netip.MustParseAddr("10.1.1.1")
+
+	trie.InsertOrUpdate(netip.MustParsePrefix("10.0.0.0/8"), onEmpty(1), onUpdate(1))
+	trie.InsertOrUpdate(netip.MustParsePrefix("10.1.0.0/16"), onEmpty(2), onUpdate(2))
+	trie.InsertOrUpdate(netip.MustParsePrefix("10.1.0.0/16"), onEmpty(0), onUpdate(3))
+	assert.Equal(t, 1, trie.lengths[16], "updates must not be counted twice")
+
+	_, got, found := trie.Lookup(addr)
+	require.True(t, found)
+	assert.Equal(t, 3, got)
+
+	// Decrement without deletion keeps the prefix.
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/16"), func(v int) (int, bool) { return v - 1, false })
+	_, got, _ = trie.Lookup(addr)
+	assert.Equal(t, 2, got)
+
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/16"), func(int) (int, bool) { return 0, true })
+	assert.Equal(t, 0, trie.lengths[16])
+	_, got, found = trie.Lookup(addr)
+	require.True(t, found)
+	assert.Equal(t, 1, got)
+
+	// Deleting an absent prefix must not touch the counters.
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/16"), func(int) (int, bool) { return 0, true })
+	assert.Equal(t, 0, trie.lengths[16])
+
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.0.0.0/8"), func(int) (int, bool) { return 0, true })
+	_, _, found = trie.Lookup(addr)
+	assert.False(t, found)
+	assert.Equal(t, 0, trie.Len())
+	for idx, c := range trie.filter.counters {
+		require.Zero(t, c, "counter %d not released", idx)
+	}
+}
+
+// TestCountingBloomSaturation tests that saturated counters are never
+// released, so removals cannot create false negatives
+func TestCountingBloomSaturation(t *testing.T) {
+	filter := newCountingBloom(BloomConfig{Entries: 1, CountersPerEntry: 1, Hashes: 1})
+	const h = 7
+
+	for range math.MaxUint8 + 10 {
+		filter.add(h)
+	}
+	filter.remove(h)
+	filter.remove(h)
+	assert.True(t, filter.mayContain(h))
+}
+
+// TestBloomMapTrieMatchesMapTrie runs random inserts and deletes against
+// BloomMapTrie and MapTrie and compares lookups after every phase
+func TestBloomMapTrieMatchesMapTrie(t *testing.T) {
+	prefixes := referencePrefixes(5000)
+	addrs := referenceAddrs(prefixes, 5000)
+
+	configs := []struct {
+		name string
+		cfg  BloomConfig
+	}{
+		{"default", DefaultBloomConfig(len(prefixes))},
+		// A tiny filter with many collisions must stay correct.
+		{"undersized", BloomConfig{Entries: 100, CountersPerEntry: 2, Hashes: 2}},
+	}
+
+	for _, c := range configs {
+		t.Run(c.name, func(t *testing.T) {
+			trie := NewBloomMapTrie[netip.Prefix, netip.Addr, int](0, c.cfg)
+			reference := NewMapTrie[netip.Prefix, netip.Addr, int](0)
+
+			compare := func(phase string) {
+				require.Equal(t, reference.Len(), trie.Len(), phase)
+				for _, addr := range addrs {
+					wantPrefix, want, wantOk := reference.Lookup(addr)
+					prefix, got, ok := trie.Lookup(addr)
+					require.Equal(t, wantOk, ok, "%s: Lookup(%s)", phase, addr)
+					require.Equal(t, wantPrefix, prefix, "%s: Lookup(%s)", phase, addr)
+					require.Equal(t, want, got, "%s: Lookup(%s)", phase, addr)
+				}
+			}
+
+			for idx, prefix := range prefixes {
+				trie.InsertOrUpdate(prefix, onEmpty(idx), onUpdate(idx))
+				reference.InsertOrUpdate(prefix, onEmpty(idx), onUpdate(idx))
+			}
+			compare("insert")
+
+			deleted := func(int) (int, bool) { return 0, true }
+			for idx, prefix := range prefixes {
+				if idx%3 != 0 {
+					trie.UpdateOrDelete(prefix, deleted)
+					reference.UpdateOrDelete(prefix, deleted)
+				}
+			}
+			compare("delete")
+
+			for idx, prefix := range prefixes {
+				if idx%3 == 1 {
+					trie.InsertOrUpdate(prefix, onEmpty(-idx), onUpdate(-idx))
+					reference.InsertOrUpdate(prefix, onEmpty(-idx), onUpdate(-idx))
+				}
+			}
+			compare("reinsert")
+		})
+	}
+}
+
+// TestBloomMapTrieProbeStats tests that the measured false positive rate
+// is in line with the theoretical one
+func TestBloomMapTrieProbeStats(t *testing.T) {
+	prefixes := randomIPv6Prefixes(20_000)
+	trie := NewBloomMapTrie[netip.Prefix, netip.Addr, int](0, DefaultBloomConfig(len(prefixes)))
+	for idx, prefix := range prefixes {
+		trie.InsertOrUpdate(prefix, onEmpty(idx), onUpdate(idx))
+	}
+
+	addrs := randomIPv6Addrs(5000)
+	stats := trie.ProbeStats(addrs)
+
+	reference := NewMapTrie[netip.Prefix, netip.Addr, int](0)
+	for idx, prefix := range prefixes {
+		reference.InsertOrUpdate(prefix, onEmpty(idx), onUpdate(idx))
+	}
+	hits := 0
+	for _, addr := range addrs {
+		if _, _, ok := reference.Lookup(addr); ok {
+			hits++
+		}
+	}
+
+	assert.Equal(t, len(addrs), stats.Lookups)
+	assert.Equal(t, hits, stats.Hits)
+	assert.Equal(t, stats.FilterChecks, stats.FilterNegatives+stats.FalsePositives+stats.Hits)
+
+	expected := trie.ExpectedFalsePositiveRate()
+	assert.Less(t, expected, 0.01)
+	assert.Less(t, stats.FalsePositiveRate(), 3*expected+0.001,
+		"measured false positive rate %.4f, expected %.4f", stats.FalsePositiveRate(), expected)
+}
+
+// BenchmarkBloomMapTrieLookup benchmarks lookup performance
+func BenchmarkBloomMapTrieLookup(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []string
+		lookups  []string
+	}{
+		{
+			name:     "single_prefix_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"192.168.1.1"},
+		},
+		{
+			name: "longest_prefix_match",
+			prefixes: []string{
+				"10.0.0.0/8",
+				"10.1.0.0/16",
+				"10.1.1.0/24",
+				"10.1.1.128/25",
+			},
+			lookups: []string{"10.1.1.129"},
+		},
+		{
+			name:     "no_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"8.8.8.8"},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			trie := NewBloomMapTrie[netip.Prefix, netip.Addr, string](0, DefaultBloomConfig(len(bm.prefixes)))
+			for j, cidr := range bm.prefixes {
+				value := fmt.Sprintf("DC%d", j)
+				trie.InsertOrUpdate(netip.MustParsePrefix(cidr), onEmptyString(value), onUpdateString(value))
+			}
+
+			addrs := make([]netip.Addr, len(bm.lookups))
+			for i, lookup := range bm.lookups {
+				addrs[i] = netip.MustParseAddr(lookup)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for b.Loop() {
+				for _, addr := range addrs {
+					_, _, _ = trie.Lookup(addr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// procsSuffix is the GOMAXPROCS suffix of benchmark names, which is not
+// compared, so that results of machines with different CPU counts match.
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// BenchmarkSamples holds the values of every run of every benchmark, as
+// printed by go test -bench with -count.
+type BenchmarkSamples struct {
+	Names  []string                        // In order of first appearance
+	Values map[string]map[string][]float64 // Values per name and unit
+}
+
+// ParseBenchmarkSamples parses go test -bench output. Lines other than
+// benchmark results are ignored.
+func ParseBenchmarkSamples(r io.Reader) (BenchmarkSamples, error) {
+	samples := BenchmarkSamples{Values: map[string]map[string][]float64{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		if len(fields)%2 != 0 {
+			return samples, fmt.Errorf("line %d: odd number of value and unit fields", line)
+		}
+
+		name := procsSuffix.ReplaceAllString(fields[0], "")
+		units, ok := samples.Values[name]
+		if !ok {
+			units = map[string][]float64{}
+			samples.Values[name] = units
+			samples.Names = append(samples.Names, name)
+		}
+		for i := 2; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return samples, fmt.Errorf("line %d: %w", line, err)
+			}
+			units[fields[i+1]] = append(units[fields[i+1]], value)
+		}
+	}
+	return samples, scanner.Err()
+}
+
+// SampleSummary is the mean of the runs of a benchmark with the half
+// width of its 95% confidence interval.
+type SampleSummary struct {
+	N    int
+	Mean float64
+	CI   float64
+}
+
+// studentT975 holds the 0.975 quantiles of the t distribution for 1 to 30
+// degrees of freedom.
+var studentT975 = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// Summarize returns the mean of the values and its 95% confidence
+// interval from the t distribution. The interval is 0 for a single value.
+func Summarize(values []float64) SampleSummary {
+	s := SampleSummary{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+	if s.N == 1 {
+		return s
+	}
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - s.Mean) * (v - s.Mean)
+	}
+	stddev := math.Sqrt(sq / float64(s.N-1))
+	t := 1.96
+	if df := s.N - 1; df <= len(studentT975) {
+		t = studentT975[df-1]
+	}
+	s.CI = t * stddev / math.Sqrt(float64(s.N))
+	return s
+}
+
+// MannWhitneyU returns the two-sided p-value of the Mann-Whitney U test
+// of the hypothesis that x and y come from the same distribution. The
+// p-value is exact for small samples without ties and approximated with
+// the normal distribution, corrected for ties, otherwise.
+func MannWhitneyU(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	// Rank the pooled values, giving tied values their average rank.
+	type sample struct {
+		value float64
+		first bool
+	}
+	pooled := make([]sample, 0, n1+n2)
+	for _, v := range x {
+		pooled = append(pooled, sample{v, true})
+	}
+	for _, v := range y {
+		pooled = append(pooled, sample{v, false})
+	}
+	slices.SortFunc(pooled, func(a, b sample) int { return cmpFloat(a.value, b.value) })
+
+	var rankSum1, tieTerm float64
+	ties := false
+	for i := 0; i < len(pooled); {
+		j := i
+		for j < len(pooled) && pooled[j].value == pooled[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if pooled[k].first {
+				rankSum1 += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+
+	u1 := rankSum1 - float64(n1*(n1+1))/2
+	u := math.Min(u1, float64(n1*n2)-u1)
+
+	if !ties && n1*n2 <= maxExactMannWhitney {
+		return math.Min(1, 2*mannWhitneyCDF(n1, n2, int(u)))
+	}
+
+	n := float64(n1 + n2)
+	variance := float64(n1*n2) / 12 * (n + 1 - tieTerm/(n*(n-1)))
+	if variance == 0 {
+		return 1
+	}
+	mean := float64(n1*n2) / 2
+	z := (mean - u - 0.5) / math.Sqrt(variance)
+	if z <= 0 {
+		return 1
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// maxExactMannWhitney is the largest product of the sample sizes for which
+// MannWhitneyU computes the exact p-value.
+const maxExactMannWhitney = 2500
+
+// mannWhitneyCDF returns the probability that U is at most u for samples
+// of n1 and n2 values without ties, counting the arrangements of the two
+// samples with each U.
+func mannWhitneyCDF(n1, n2, u int) float64 {
+	// prev[j][k] and cur[j][k] are the numbers of arrangements of i-1 and
+	// i values of the first sample and j of the second with U = k.
+	maxU := n1 * n2
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		for j := range cur {
+			cur[j] = make([]float64, maxU+1)
+			for k := range cur[j] {
+				// The largest value is from the first sample and is
+				// above all j values of the second, or from the second.
+				if k >= j {
+					cur[j][k] = prev[j][k-j]
+				}
+				if j > 0 {
+					cur[j][k] += cur[j-1][k]
+				}
+			}
+		}
+		prev = cur
+	}
+
+	var below, total float64
+	for k, count := range prev[n2] {
+		if k <= u {
+			below += count
+		}
+		total += count
+	}
+	return below / total
+}
+
+// cmpFloat compares two float64 values.
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// CompareConfig configures the regression gate of CompareBenchmarks.
+type CompareConfig struct {
+	// Threshold is the relative increase of the mean ns/op that counts as
+	// a regression, 0.05 for 5%.
+	Threshold float64
+	// Alpha is the significance level of the Mann-Whitney U test.
+	Alpha float64
+	// Gate selects the benchmarks whose regressions fail the comparison.
+	Gate *regexp.Regexp
+}
+
+// BenchmarkComparison is the change of a unit of a benchmark between the
+// baseline and the new results.
+type BenchmarkComparison struct {
+	Name string
+	Unit string
+	Old  SampleSummary
+	New  SampleSummary
+	// Delta is the relative change of the mean, 0.1 for 10% more.
+	Delta float64
+	P     float64
+	// Regression is set for gated ns/op changes above the threshold that
+	// are statistically significant.
+	Regression bool
+}
+
+// Significant reports whether the change is unlikely to be noise.
+func (c BenchmarkComparison) Significant(alpha float64) bool {
+	return c.P < alpha
+}
+
+// CompareBenchmarks compares every benchmark and unit present in both the
+// baseline and the current results, in the order of the current results
+// with ns/op first.
+func CompareBenchmarks(baseline, current BenchmarkSamples, cfg CompareConfig) []BenchmarkComparison {
+	var comparisons []BenchmarkComparison
+	for _, name := range current.Names {
+		oldUnits, ok := baseline.Values[name]
+		if !ok {
+			continue
+		}
+		newUnits := current.Values[name]
+
+		units := make([]string, 0, len(newUnits))
+		for unit := range newUnits {
+			if _, ok := oldUnits[unit]; ok {
+				units = append(units, unit)
+			}
+		}
+		slices.SortFunc(units, func(a, b string) int {
+			if (a == "ns/op") != (b == "ns/op") {
+				if a == "ns/op" {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a, b)
+		})
+
+		for _, unit := range units {
+			c := BenchmarkComparison{
+				Name: name,
+				Unit: unit,
+				Old:  Summarize(oldUnits[unit]),
+				New:  Summarize(newUnits[unit]),
+				P:    MannWhitneyU(oldUnits[unit], newUnits[unit]),
+			}
+			if c.Old.Mean != 0 {
+				c.Delta = c.New.Mean/c.Old.Mean - 1
+			}
+			c.Regression = unit == "ns/op" && cfg.Gate != nil && cfg.Gate.MatchString(name) &&
+				c.Significant(cfg.Alpha) && c.Delta > cfg.Threshold
+			comparisons = append(comparisons, c)
+		}
+	}
+	return comparisons
+}
+
+// FormatComparisons writes the comparisons as a table in the style of
+// benchstat. Changes that are not significant are shown as "~".
+func FormatComparisons(w io.Writer, comparisons []BenchmarkComparison, alpha float64) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\tunit\told\tnew\tdelta\t")
+	for _, c := range comparisons {
+		delta := "~"
+		if c.Significant(alpha) {
+			delta = fmt.Sprintf("%+.2f%%", 100*c.Delta)
+		}
+		mark := ""
+		if c.Regression {
+			mark = "REGRESSION"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s (p=%.3f n=%d+%d)\t%s\n",
+			c.Name, c.Unit, formatSummary(c.Old), formatSummary(c.New), delta, c.P, c.Old.N, c.New.N, mark)
+	}
+	return tw.Flush()
+}
+
+// formatSummary formats a mean with its confidence interval relative to
+// the mean.
+func formatSummary(s SampleSummary) string {
+	if s.Mean == 0 {
+		return strconv.FormatFloat(s.Mean, 'g', 4, 64)
+	}
+	return fmt.Sprintf("%s ±%.1f%%", strconv.FormatFloat(s.Mean, 'g', 4, 64), 100*s.CI/math.Abs(s.Mean))
+}
+
+// runBenchmarkSamples runs the benchmarks matching the pattern count times
+// in a new process of the test binary and returns the parsed results and
+// the raw output.
+func runBenchmarkSamples(pattern string, count int) (BenchmarkSamples, []byte, error) {
+	cmd := exec.Command(os.Args[0],
+		"-test.run=^$",
+		"-test.bench="+pattern,
+		"-test.benchmem",
+		"-test.count="+strconv.Itoa(count))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return BenchmarkSamples{}, out, fmt.Errorf("benchmarks %s: %w\n%s%s", pattern, err, out, stderr.Bytes())
+	}
+
+	samples, err := ParseBenchmarkSamples(bytes.NewReader(out))
+	if err == nil && len(samples.Names) == 0 {
+		err = fmt.Errorf("benchmarks %s: no results", pattern)
+	}
+	return samples, out, err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	compareBaseline  = flag.String("compare-baseline", "", "baseline go test -bench output for TestCompareBenchmarksCLI")
+	compareInput     = flag.String("compare-input", "", "go test -bench output compared to the baseline instead of running -compare-bench")
+	compareBench     = flag.String("compare-bench", "", "benchmarks run by TestCompareBenchmarksCLI, as for -bench")
+	compareCount     = flag.Int("compare-count", 10, "number of runs of every benchmark run by TestCompareBenchmarksCLI")
+	compareThreshold = flag.Float64("compare-threshold", 0.05, "relative ns/op increase failing TestCompareBenchmarksCLI")
+	compareAlpha     = flag.Float64("compare-alpha", 0.05, "significance level of the Mann-Whitney U test")
+	compareGate      = flag.String("compare-gate", "Lookup|Insert", "benchmarks whose ns/op regressions fail TestCompareBenchmarksCLI")
+	compareSave      = flag.String("compare-save", "", "file to save the output of -compare-bench to, for use as the next baseline")
+)
+
+// benchmarkOutput is go test -bench output of two runs of two benchmarks
+const benchmarkOutput = `goos: linux
+goarch: amd64
+pkg: github.com/sakateka/lpm-benchmark
+BenchmarkLPMLookup1M/ipv4_1M_prefixes-20         	224538270	         5.346 ns/op	       0 B/op	       0 allocs/op
+--- BENCH: BenchmarkLPMLookup1M/ipv4_1M_prefixes-20
+    lpm_bench1M_test.go:206: Memory usage after 1M inserts: Alloc=408613656 bytes (389.68 MB)
+BenchmarkLPMLookup1M/ipv4_1M_prefixes-20         	224538270	         5.512 ns/op	       0 B/op	       0 allocs/op
+BenchmarkMapTrieInsert1M/ipv4_1M_prefixes-20     	10594519	       111.1 ns/op	 52852080 heap-bytes	      57 B/op	       2 allocs/op
+BenchmarkMapTrieInsert1M/ipv4_1M_prefixes-20     	10594519	       113.9 ns/op	 52852080 heap-bytes	      57 B/op	       2 allocs/op
+PASS
+ok  	github.com/sakateka/lpm-benchmark	7.198s
+`
+
+// TestParseBenchmarkSamples tests parsing of go test -bench output
+func TestParseBenchmarkSamples(t *testing.T) {
+	samples, err := ParseBenchmarkSamples(strings.NewReader(benchmarkOutput))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BenchmarkLPMLookup1M/ipv4_1M_prefixes", "BenchmarkMapTrieInsert1M/ipv4_1M_prefixes"}, samples.Names)
+	assert.Equal(t, map[string][]float64{
+		"ns/op":     {5.346, 5.512},
+		"B/op":      {0, 0},
+		"allocs/op": {0, 0},
+	}, samples.Values["BenchmarkLPMLookup1M/ipv4_1M_prefixes"])
+	assert.Equal(t, []float64{52852080, 52852080}, samples.Values["BenchmarkMapTrieInsert1M/ipv4_1M_prefixes"]["heap-bytes"])
+
+	_, err = ParseBenchmarkSamples(strings.NewReader("BenchmarkX-8 100 5.0 ns/op 3\n"))
+	assert.Error(t, err)
+	_, err = ParseBenchmarkSamples(strings.NewReader("BenchmarkX-8 100 fast ns/op\n"))
+	assert.Error(t, err)
+}
+
+// TestSummarize tests means and confidence intervals
+func TestSummarize(t *testing.T) {
+	assert.Equal(t, SampleSummary{}, Summarize(nil))
+	assert.Equal(t, SampleSummary{N: 1, Mean: 7}, Summarize([]float64{7}))
+
+	// The standard deviation is sqrt(10/6), the interval is t(6) times
+	// the standard error.
+	s := Summarize([]float64{9, 10, 10, 10, 11, 8, 12})
+	assert.Equal(t, 7, s.N)
+	assert.InDelta(t, 10, s.Mean, 1e-9)
+	assert.InDelta(t, 2.447*math.Sqrt(10.0/6)/math.Sqrt(7), s.CI, 1e-9)
+}
+
+// TestMannWhitneyU tests p-values against known values
+func TestMannWhitneyU(t *testing.T) {
+	// Completely separated samples of 5 have the smallest exact p-value,
+	// 2 / C(10, 5).
+	assert.InDelta(t, 2.0/252, MannWhitneyU([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}), 1e-12)
+	assert.InDelta(t, 2.0/252, MannWhitneyU([]float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}), 1e-12)
+	// U = 1 of 25: P(U <= 1) = 2 / 252.
+	assert.InDelta(t, 4.0/252, MannWhitneyU([]float64{1, 2, 3, 4, 6}, []float64{5, 7, 8, 9, 10}), 1e-12)
+	assert.Equal(t, 1.0, MannWhitneyU([]float64{1, 4, 5, 8}, []float64{2, 3, 6, 7}))
+
+	assert.Equal(t, 1.0, MannWhitneyU([]float64{3, 3, 3}, []float64{3, 3, 3}), "identical samples")
+	assert.Equal(t, 1.0, MannWhitneyU(nil, []float64{1}))
+
+	// With ties the normal approximation is used.
+	p := MannWhitneyU([]float64{1, 1, 2, 2, 3, 3}, []float64{4, 4, 5, 5, 6, 6})
+	assert.Less(t, p, 0.01)
+	assert.Greater(t, p, 0.001)
+
+	// Large samples use the normal approximation as well.
+	x, y := make([]float64, 60), make([]float64, 60)
+	for i := range x {
+		x[i], y[i] = float64(2*i), float64(2*i+1)
+	}
+	assert.Greater(t, MannWhitneyU(x, y), 0.5)
+}
+
+// TestCompareBenchmarks tests that only significant gated ns/op increases
+// beyond the threshold are regressions
+func TestCompareBenchmarks(t *testing.T) {
+	samples := func(values map[string][]float64) BenchmarkSamples {
+		s := BenchmarkSamples{Values: map[string]map[string][]float64{}}
+		for name, v := range values {
+			s.Names = append(s.Names, name)
+			s.Values[name] = map[string][]float64{"ns/op": v, "B/op": {0, 0, 0, 0, 0}}
+		}
+		return s
+	}
+	baseline := samples(map[string][]float64{
+		"BenchmarkLookup/slower": {10, 10.1, 9.9, 10.2, 9.8},
+		"BenchmarkLookup/noisy":  {10, 14, 8, 12, 9},
+		"BenchmarkLookup/small":  {10, 10.1, 9.9, 10.2, 9.8},
+		"BenchmarkDiff/slower":   {10, 10.1, 9.9, 10.2, 9.8},
+		"BenchmarkLookup/only":   {10, 10.1, 9.9, 10.2, 9.8},
+	})
+	current := samples(map[string][]float64{
+		"BenchmarkLookup/slower": {12, 12.1, 11.9, 12.2, 11.8},
+		"BenchmarkLookup/noisy":  {11, 15, 9, 13, 10},
+		"BenchmarkLookup/small":  {10.3, 10.4, 10.2, 10.5, 10.35},
+		"BenchmarkDiff/slower":   {12, 12.1, 11.9, 12.2, 11.8},
+		"BenchmarkLookup/new":    {1, 1, 1, 1, 1},
+	})
+	cfg := CompareConfig{Threshold: 0.05, Alpha: 0.05, Gate: regexp.MustCompile("Lookup")}
+
+	byName := map[string]BenchmarkComparison{}
+	for _, c := range CompareBenchmarks(baseline, current, cfg) {
+		if c.Unit == "ns/op" {
+			byName[c.Name] = c
+		}
+	}
+	require.Len(t, byName, 4, "benchmarks missing from either side are skipped")
+
+	assert.True(t, byName["BenchmarkLookup/slower"].Regression)
+	assert.InDelta(t, 0.2, byName["BenchmarkLookup/slower"].Delta, 1e-9)
+	assert.False(t, byName["BenchmarkLookup/noisy"].Regression, "not significant")
+	assert.False(t, byName["BenchmarkLookup/small"].Regression, "below the threshold")
+	assert.True(t, byName["BenchmarkLookup/small"].Significant(cfg.Alpha))
+	assert.False(t, byName["BenchmarkDiff/slower"].Regression, "not gated")
+
+	var out bytes.Buffer
+	require.NoError(t, FormatComparisons(&out, CompareBenchmarks(baseline, current, cfg), cfg.Alpha))
+	assert.Contains(t, out.String(), "+20.00%")
+	assert.Contains(t, out.String(), "REGRESSION")
+	assert.Contains(t, out.String(), "~ (p=")
+}
+
+// TestCompareBenchmarksCLI compares benchmark results to the baseline
+// given with -compare-baseline and fails on regressions. The results are
+// either read from -compare-input or produced by running -compare-bench
+// -compare-count times:
+//
+//	go test -v -run '^TestCompareBenchmarksCLI$' ./... -args -compare-bench=Lookup1M -compare-save=baseline.txt
+//	go test -v -run '^TestCompareBenchmarksCLI$' ./... -args -compare-bench=Lookup1M -compare-baseline=baseline.txt
+func TestCompareBenchmarksCLI(t *testing.T) {
+	if *compareBench == "" && *compareInput == "" {
+		t.Skip("set -compare-bench or -compare-input to compare benchmark results")
+	}
+
+	var current BenchmarkSamples
+	if *compareInput != "" {
+		data, err := os.ReadFile(*compareInput)
+		require.NoError(t, err)
+		current, err = ParseBenchmarkSamples(bytes.NewReader(data))
+		require.NoError(t, err)
+	} else {
+		var out []byte
+		var err error
+		current, out, err = runBenchmarkSamples(*compareBench, *compareCount)
+		require.NoError(t, err)
+		if *compareSave != "" {
+			require.NoError(t, os.WriteFile(*compareSave, out, 0o644))
+			t.Logf("saved results of %d benchmarks to %s", len(current.Names), *compareSave)
+		}
+	}
+
+	if *compareBaseline == "" {
+		t.Skip("set -compare-baseline to compare the results")
+	}
+	data, err := os.ReadFile(*compareBaseline)
+	require.NoError(t, err)
+	baseline, err := ParseBenchmarkSamples(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	cfg := CompareConfig{Threshold: *compareThreshold, Alpha: *compareAlpha, Gate: regexp.MustCompile(*compareGate)}
+	comparisons := CompareBenchmarks(baseline, current, cfg)
+	require.NotEmpty(t, comparisons, "no benchmarks in both results")
+	require.NoError(t, FormatComparisons(os.Stdout, comparisons, cfg.Alpha))
+
+	for _, c := range comparisons {
+		if c.Regression {
+			t.Errorf("%s: %s regressed by %+.2f%% (p=%.3f), threshold %.2f%%",
+				c.Name, c.Unit, 100*c.Delta, c.P, 100*cfg.Threshold)
+		}
+	}
+}
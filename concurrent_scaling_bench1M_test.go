@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+var (
+	scalingMaxProcs   = flag.Int("scaling-max-procs", runtime.NumCPU(), "largest GOMAXPROCS of BenchmarkConcurrentLookupScaling1M")
+	scalingMaxReaders = flag.Int("scaling-max-readers", runtime.NumCPU(), "largest number of reader goroutines of BenchmarkConcurrentLookupScaling1M")
+)
+
+// scalingBatch is the number of lookups of every reader per iteration of
+// BenchmarkConcurrentLookupScaling1M, large enough to hide the cost of
+// starting the readers.
+const scalingBatch = 4096
+
+// BenchmarkConcurrentLookupScaling1M benchmarks lookups by 1 to
+// -scaling-max-readers reader goroutines with GOMAXPROCS from 1 to
+// -scaling-max-procs, in powers of two, on 1M prefixes loaded into every
+// implementation. An iteration is a batch of 4096 lookups per reader.
+//
+// ns/lookup is the wall time per lookup of all readers together,
+// lookups/s/core the throughput per core in use and efficiency the
+// throughput per core relative to a single reader with GOMAXPROCS 1 on
+// the same table. An efficiency well below 1 with as many readers as
+// cores shows contention or false sharing in the implementation.
+func BenchmarkConcurrentLookupScaling1M(b *testing.B) {
+	for _, ds := range prefixDatasets() {
+		prefixes := ds.prefixes(1000_000)
+		addrs := sweepAddrs(prefixes)
+		ipv4 := prefixes[0].Addr().Is4()
+
+		for _, impl := range stringTableImplementations() {
+			if impl.ipv4Only && !ipv4 {
+				continue
+			}
+
+			var lookup func(netip.Addr) bool
+			var base *ScalingResult
+			for _, procs := range ReaderCounts(*scalingMaxProcs) {
+				for _, readers := range ReaderCounts(*scalingMaxReaders) {
+					b.Run(fmt.Sprintf("%s/%s/procs=%d/readers=%d", ds.name, impl.name, procs, readers), func(b *testing.B) {
+						if lookup == nil {
+							lookup, _ = loadTable(b, impl, prefixes)
+						}
+						defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+						b.ResetTimer()
+						b.ReportAllocs()
+						captureProfiles(b)
+
+						var hits int64
+						for b.Loop() {
+							hits += runLookupBatch(lookup, addrs, readers, scalingBatch)
+						}
+
+						if hits == 0 {
+							b.Fatalf("No successful lookups in %d iterations", b.N)
+						}
+
+						result := ScalingResult{
+							Readers: readers,
+							Procs:   procs,
+							Lookups: int64(b.N) * int64(readers) * scalingBatch,
+							Elapsed: b.Elapsed(),
+						}
+						if procs == 1 && readers == 1 {
+							base = &result
+						}
+
+						b.ReportMetric(float64(result.Elapsed.Nanoseconds())/float64(result.Lookups), "ns/lookup")
+						b.ReportMetric(result.PerCore(), "lookups/s/core")
+						if base != nil {
+							b.ReportMetric(result.Efficiency(*base), "efficiency")
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// loadTable loads the prefixes with datacenterValues into impl and returns
+// the lookup and the heap growth of the load, which is logged.
+func loadTable(b *testing.B, impl tableImplementation[string], prefixes []netip.Prefix) (func(netip.Addr) bool, uint64) {
+	// Measure memory before insertion
+	runtime.GC()
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+
+	lookup, err := impl.load(prefixes, datacenterValues(len(prefixes)))
+	if err != nil {
+		b.Fatalf("load: %v", err)
+	}
+
+	// Measure memory after insertion
+	runtime.GC()
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
+
+	allocDiff := memAfter.Alloc - memBefore.Alloc
+	b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB)",
+		len(prefixes), allocDiff, float64(allocDiff)/(1024*1024))
+	return lookup, allocDiff
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// ReaderCounts returns the reader counts of a scaling curve: powers of two
+// below maxReaders and maxReaders itself.
+func ReaderCounts(maxReaders int) []int {
+	var counts []int
+	for n := 1; n < maxReaders; n *= 2 {
+		counts = append(counts, n)
+	}
+	return append(counts, max(maxReaders, 1))
+}
+
+// scalingCounter is a per-reader counter padded to a cache line, so that
+// the harness itself does not cause false sharing between readers.
+type scalingCounter struct {
+	hits int64
+	_    [56]byte
+}
+
+// runLookupBatch runs perReader lookups in each of readers goroutines and
+// returns the number of hits. Every reader walks the addresses from its
+// own offset, so that the readers do not look up the same address at the
+// same time.
+func runLookupBatch(lookup func(netip.Addr) bool, addrs []netip.Addr, readers, perReader int) int64 {
+	counters := make([]scalingCounter, readers)
+	var wg sync.WaitGroup
+	for r := range readers {
+		wg.Go(func() {
+			idx := r * len(addrs) / readers
+			var hits int64
+			for range perReader {
+				if lookup(addrs[idx]) {
+					hits++
+				}
+				idx++
+				if idx == len(addrs) {
+					idx = 0
+				}
+			}
+			counters[r].hits = hits
+		})
+	}
+	wg.Wait()
+
+	var hits int64
+	for _, c := range counters {
+		hits += c.hits
+	}
+	return hits
+}
+
+// ScalingResult is the lookup throughput of a number of readers with a
+// GOMAXPROCS value.
+type ScalingResult struct {
+	Readers int
+	Procs   int
+	Lookups int64
+	Elapsed time.Duration
+}
+
+// Throughput returns the lookups per second of all readers together.
+func (r ScalingResult) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Lookups) / r.Elapsed.Seconds()
+}
+
+// Cores returns the number of cores the readers can run on at the same
+// time, the smaller of the readers and GOMAXPROCS.
+func (r ScalingResult) Cores() int {
+	return max(min(r.Readers, r.Procs), 1)
+}
+
+// PerCore returns the throughput per core in use.
+func (r ScalingResult) PerCore() float64 {
+	return r.Throughput() / float64(r.Cores())
+}
+
+// Efficiency returns the throughput per core relative to the throughput
+// of the single reader base, 1 for linear scaling. Contention and false
+// sharing lower it below 1.
+func (r ScalingResult) Efficiency(base ScalingResult) float64 {
+	if base.PerCore() == 0 {
+		return 0
+	}
+	return r.PerCore() / base.PerCore()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReaderCounts tests the reader counts of scaling curves
+func TestReaderCounts(t *testing.T) {
+	assert.Equal(t, []int{1}, ReaderCounts(1))
+	assert.Equal(t, []int{1, 2, 4, 8}, ReaderCounts(8))
+	assert.Equal(t, []int{1, 2, 4, 8, 12}, ReaderCounts(12))
+	assert.Equal(t, []int{1}, ReaderCounts(0))
+}
+
+// TestRunLookupBatch tests that every reader runs its lookups from its own
+// offset
+func TestRunLookupBatch(t *testing.T) {
+	addrs := []netip.Addr{
+		netip.MustParseAddr("10.0.0.1"),
+		netip.MustParseAddr("10.0.0.2"),
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("192.0.2.2"),
+	}
+	var mu sync.Mutex
+	seen := map[netip.Addr]int{}
+	lookup := func(addr netip.Addr) bool {
+		mu.Lock()
+		seen[addr]++
+		mu.Unlock()
+		return addr.As4()[0] == 10
+	}
+
+	// Two readers of 2 lookups start at 10.0.0.1 and 192.0.2.1.
+	assert.Equal(t, int64(2), runLookupBatch(lookup, addrs, 2, 2))
+	assert.Equal(t, map[netip.Addr]int{addrs[0]: 1, addrs[1]: 1, addrs[2]: 1, addrs[3]: 1}, seen)
+
+	// A reader wraps around the addresses.
+	clear(seen)
+	assert.Equal(t, int64(6), runLookupBatch(lookup, addrs, 3, 4))
+	total := 0
+	for _, n := range seen {
+		total += n
+	}
+	assert.Equal(t, 12, total)
+}
+
+// TestScalingResult tests throughput per core and efficiency
+func TestScalingResult(t *testing.T) {
+	base := ScalingResult{Readers: 1, Procs: 1, Lookups: 1000, Elapsed: time.Millisecond}
+	assert.InDelta(t, 1e6, base.Throughput(), 1e-6)
+	assert.InDelta(t, 1, base.Efficiency(base), 1e-12)
+
+	// 4 readers on 4 cores with 3 times the throughput scale at 75%.
+	r := ScalingResult{Readers: 4, Procs: 4, Lookups: 3000, Elapsed: time.Millisecond}
+	assert.Equal(t, 4, r.Cores())
+	assert.InDelta(t, 0.75e6, r.PerCore(), 1e-6)
+	assert.InDelta(t, 0.75, r.Efficiency(base), 1e-12)
+
+	// Readers beyond GOMAXPROCS do not add cores.
+	r = ScalingResult{Readers: 8, Procs: 2, Lookups: 2000, Elapsed: time.Millisecond}
+	assert.Equal(t, 2, r.Cores())
+	assert.InDelta(t, 1, r.Efficiency(base), 1e-12)
+
+	assert.Zero(t, ScalingResult{Readers: 1, Procs: 1}.Throughput())
+	assert.Zero(t, r.Efficiency(ScalingResult{}))
+}
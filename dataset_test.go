@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+)
+
+// randomIPv4Prefixes generates n IPv4 prefixes with random masks (8-32).
+//
+// The generator matches the one used by the 1M benchmarks, so the first
+// 1M prefixes are identical to those inserted by BenchmarkLPMInsert1M and
+// friends.
+func randomIPv4Prefixes(n int) []netip.Prefix {
+	rng := rand.New(rand.NewSource(42))
+	prefixes := make([]netip.Prefix, n)
+	for i := range prefixes {
+		addr := netip.AddrFrom4([4]byte{
+			byte((i >> 16) & 0xff),
+			byte((i >> 8) & 0xff),
+			byte(i & 0xff),
+			byte(rng.Intn(256)),
+		})
+		prefixLen := 8 + rng.Intn(25)
+		prefixes[i] = netip.PrefixFrom(addr, prefixLen).Masked()
+	}
+	return prefixes
+}
+
+// randomIPv6Prefixes generates n IPv6 prefixes with random masks (32-128)
+// inside 2001:db8::/32, matching the 1M benchmarks generator.
+func randomIPv6Prefixes(n int) []netip.Prefix {
+	rng := rand.New(rand.NewSource(42))
+	prefixes := make([]netip.Prefix, n)
+	for i := range prefixes {
+		addr := netip.AddrFrom16([16]byte{
+			0x20, 0x01, 0x0d, 0xb8,
+			byte((i >> 24) & 0xff), byte((i >> 16) & 0xff),
+			byte((i >> 8) & 0xff), byte(i & 0xff),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+		})
+		prefixLen := 32 + rng.Intn(97)
+		prefixes[i] = netip.PrefixFrom(addr, prefixLen).Masked()
+	}
+	return prefixes
+}
+
+// randomIPv4Addrs generates n uniformly random IPv4 lookup addresses.
+func randomIPv4Addrs(n int) []netip.Addr {
+	rng := rand.New(rand.NewSource(43))
+	addrs := make([]netip.Addr, n)
+	for i := range addrs {
+		addrs[i] = netip.AddrFrom4([4]byte{
+			byte(rng.Intn(256)),
+			byte(rng.Intn(256)),
+			byte(rng.Intn(256)),
+			byte(rng.Intn(256)),
+		})
+	}
+	return addrs
+}
+
+// randomIPv6Addrs generates n random IPv6 lookup addresses inside
+// 2001:db8::/32.
+func randomIPv6Addrs(n int) []netip.Addr {
+	rng := rand.New(rand.NewSource(43))
+	addrs := make([]netip.Addr, n)
+	for i := range addrs {
+		addrs[i] = netip.AddrFrom16([16]byte{
+			0x20, 0x01, 0x0d, 0xb8,
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+			byte(rng.Intn(256)), byte(rng.Intn(256)),
+		})
+	}
+	return addrs
+}
+
+// datacenterValues generates n values in the "DC%d" format used across
+// the benchmarks.
+func datacenterValues(n int) []string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = fmt.Sprintf("DC%d", i)
+	}
+	return values
+}
+
+// nextHopValues returns n values drawn from k next hops ("NH0" to
+// "NH<k-1>"), like a FIB where many prefixes share a few next hops.
+func nextHopValues(n, k int) []string {
+	rng := rand.New(rand.NewSource(45))
+	values := make([]string, n)
+	for i := range values {
+		values[i] = fmt.Sprintf("NH%d", rng.Intn(k))
+	}
+	return values
+}
+
+// ecmpMemberSets returns n next hop member sets of one to four next hops
+// drawn from k next hops (192.0.2.0 to 192.0.2.<k-1>), like a FIB with
+// ECMP routes. One set in eight gives its first next hop weight 2.
+func ecmpMemberSets(n, k int) [][]NextHopMember {
+	rng := rand.New(rand.NewSource(51))
+	sets := make([][]NextHopMember, n)
+	for i := range sets {
+		hops := rng.Perm(k)[:1+rng.Intn(min(4, k))]
+		members := make([]NextHopMember, len(hops))
+		for idx, hop := range hops {
+			members[idx] = NextHopMember{NextHop: netip.AddrFrom4([4]byte{192, 0, 2, byte(hop)}), Weight: 1}
+		}
+		if rng.Intn(8) == 0 {
+			members[0].Weight = 2
+		}
+		sets[i] = members
+	}
+	return sets
+}
+
+// prefixDatasets returns the IPv4 and IPv6 1M datasets as generator
+// functions, so that benchmarks can pick the size and measure the
+// generation cost.
+func prefixDatasets() []struct {
+	name     string
+	prefixes func(n int) []netip.Prefix
+} {
+	return []struct {
+		name     string
+		prefixes func(n int) []netip.Prefix
+	}{
+		{"ipv4_1M_prefixes", randomIPv4Prefixes},
+		{"ipv6_1M_prefixes", randomIPv6Prefixes},
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// BenchmarkDiff1M benchmarks diffs of two tables with 1M prefixes where
+// 1% of the prefixes were withdrawn, announced or changed
+func BenchmarkDiff1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	for _, ds := range prefixDatasets() {
+		prefixes := ds.prefixes(1000_000)
+
+		oldTrie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+		newTrie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+		for idx, prefix := range prefixes {
+			value := values[idx]
+			if idx%300 != 0 {
+				oldTrie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+			}
+			if idx%300 == 1 {
+				value += "-changed"
+			}
+			if idx%300 != 2 {
+				newTrie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+			}
+		}
+
+		benchmarks := []struct {
+			name string
+			diff func() int
+		}{
+			{
+				name: "maptrie",
+				diff: func() int {
+					n := 0
+					for range oldTrie.Diff(&newTrie, comparePrefixes, equalStrings) {
+						n++
+					}
+					return n
+				},
+			},
+			{
+				name: "iteration",
+				diff: func() int {
+					n := 0
+					for range DiffTables(oldTrie.All(), newTrie.All(), comparePrefixes, equalStrings) {
+						n++
+					}
+					return n
+				},
+			},
+		}
+
+		for _, bm := range benchmarks {
+			b.Run(ds.name+"/"+bm.name, func(b *testing.B) {
+				b.ReportAllocs()
+				captureProfiles(b)
+
+				changes := 0
+				for b.Loop() {
+					changes = bm.diff()
+				}
+
+				if changes == 0 {
+					b.Fatalf("No changes found in %d iterations", b.N)
+				}
+				b.ReportMetric(float64(changes), "changes")
+			})
+		}
+	}
+}
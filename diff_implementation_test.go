@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"iter"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// DiffKind describes how a prefix differs between two tables.
+type DiffKind uint8
+
+const (
+	// DiffAdded marks a prefix that is only in the new table.
+	DiffAdded DiffKind = iota
+	// DiffRemoved marks a prefix that is only in the old table.
+	DiffRemoved
+	// DiffChanged marks a prefix with different values in both tables.
+	DiffChanged
+)
+
+// String returns the name of the change kind.
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", uint8(k))
+	}
+}
+
+// PrefixChange is a single difference between two tables. Old is the
+// zero value for added prefixes and New for removed ones.
+type PrefixChange[K any, V any] struct {
+	Kind   DiffKind
+	Prefix K
+	Old    V
+	New    V
+}
+
+// All returns an iterator over all entries of the MapTrie, in ascending
+// order of prefix length and in no particular order within a length.
+func (m *MapTrie[K, Q, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, entries := range m {
+			for prefix, value := range entries {
+				if !yield(prefix, value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Diff returns the changes from m to other ordered by compare, for
+// example comparePrefixes for netip.Prefix keys.
+//
+// The prefixes of every length are sorted when iteration starts, the
+// changes are then produced by merging the lengths, so that the first
+// change is yielded without comparing the whole tables.
+func (m *MapTrie[K, Q, V]) Diff(other *MapTrie[K, Q, V], compare func(a, b K) int, equal func(a, b V) bool) iter.Seq[PrefixChange[K, V]] {
+	return func(yield func(PrefixChange[K, V]) bool) {
+		h := &diffHeap[K, V]{compare: compare}
+		for bits := range m {
+			if len(m[bits]) == 0 && len(other[bits]) == 0 {
+				continue
+			}
+			d := &sortedDiff[K, V]{compare: compare, equal: equal}
+			d.oldKeys, d.oldValues = sortedEntries(m[bits], compare)
+			d.newKeys, d.newValues = sortedEntries(other[bits], compare)
+			if d.advance() {
+				h.diffs = append(h.diffs, d)
+			}
+		}
+		heap.Init(h)
+
+		for h.Len() > 0 {
+			d := h.diffs[0]
+			if !yield(d.change) {
+				return
+			}
+			if d.advance() {
+				heap.Fix(h, 0)
+			} else {
+				heap.Pop(h)
+			}
+		}
+	}
+}
+
+// DiffTables returns the changes from the old to the current table
+// ordered by compare. The tables may come from any adapter that can
+// iterate its entries, in any order. When a prefix occurs more than once
+// in a table, the last occurrence wins.
+//
+// Both tables are collected and sorted when iteration starts, the changes
+// are then produced by merging them.
+func DiffTables[K comparable, V any](old, current iter.Seq2[K, V], compare func(a, b K) int, equal func(a, b V) bool) iter.Seq[PrefixChange[K, V]] {
+	return func(yield func(PrefixChange[K, V]) bool) {
+		d := &sortedDiff[K, V]{compare: compare, equal: equal}
+		d.oldKeys, d.oldValues = sortedTable(old, compare)
+		d.newKeys, d.newValues = sortedTable(current, compare)
+
+		for d.advance() {
+			if !yield(d.change) {
+				return
+			}
+		}
+	}
+}
+
+// sortedDiff merges two tables sorted by compare into their changes.
+type sortedDiff[K any, V any] struct {
+	oldKeys   []K
+	oldValues []V
+	newKeys   []K
+	newValues []V
+	i, j      int
+
+	compare func(a, b K) int
+	equal   func(a, b V) bool
+
+	// change is the current change, set by advance.
+	change PrefixChange[K, V]
+}
+
+// advance moves to the next change and reports whether there is one.
+func (d *sortedDiff[K, V]) advance() bool {
+	for d.i < len(d.oldKeys) || d.j < len(d.newKeys) {
+		c := 0
+		switch {
+		case d.i == len(d.oldKeys):
+			c = 1
+		case d.j == len(d.newKeys):
+			c = -1
+		default:
+			c = d.compare(d.oldKeys[d.i], d.newKeys[d.j])
+		}
+
+		switch {
+		case c < 0:
+			d.change = PrefixChange[K, V]{Kind: DiffRemoved, Prefix: d.oldKeys[d.i], Old: d.oldValues[d.i]}
+			d.i++
+			return true
+		case c > 0:
+			d.change = PrefixChange[K, V]{Kind: DiffAdded, Prefix: d.newKeys[d.j], New: d.newValues[d.j]}
+			d.j++
+			return true
+		}
+
+		oldValue, newValue := d.oldValues[d.i], d.newValues[d.j]
+		prefix := d.oldKeys[d.i]
+		d.i++
+		d.j++
+		if !d.equal(oldValue, newValue) {
+			d.change = PrefixChange[K, V]{Kind: DiffChanged, Prefix: prefix, Old: oldValue, New: newValue}
+			return true
+		}
+	}
+	return false
+}
+
+// diffHeap orders the per-length diffs of MapTrie.Diff by their current
+// change, implementing heap.Interface.
+type diffHeap[K any, V any] struct {
+	diffs   []*sortedDiff[K, V]
+	compare func(a, b K) int
+}
+
+func (h *diffHeap[K, V]) Len() int { return len(h.diffs) }
+func (h *diffHeap[K, V]) Less(i, j int) bool {
+	return h.compare(h.diffs[i].change.Prefix, h.diffs[j].change.Prefix) < 0
+}
+func (h *diffHeap[K, V]) Swap(i, j int) { h.diffs[i], h.diffs[j] = h.diffs[j], h.diffs[i] }
+func (h *diffHeap[K, V]) Push(x any)    { h.diffs = append(h.diffs, x.(*sortedDiff[K, V])) }
+func (h *diffHeap[K, V]) Pop() any {
+	d := h.diffs[len(h.diffs)-1]
+	h.diffs = h.diffs[:len(h.diffs)-1]
+	return d
+}
+
+// sortedTable collects a table into keys and values sorted by compare.
+func sortedTable[K comparable, V any](table iter.Seq2[K, V], compare func(a, b K) int) ([]K, []V) {
+	last := make(map[K]V)
+	for key, value := range table {
+		last[key] = value
+	}
+	return sortedEntries(last, compare)
+}
+
+// sortedEntries returns the keys and values of a map sorted by compare.
+func sortedEntries[K comparable, V any](entries map[K]V, compare func(a, b K) int) ([]K, []V) {
+	keys := make([]K, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compare)
+
+	values := make([]V, len(keys))
+	for idx, key := range keys {
+		values[idx] = entries[key]
+	}
+	return keys, values
+}
+
+// ReadDatasetFile reads a prefix table from a file.
+//
+// Files starting with the MapTrie snapshot magic are read as snapshots
+// with string values. Otherwise every line holds a prefix optionally
+// followed by whitespace and a value, as in "10.0.0.0/8 DC1". Empty lines
+// and lines starting with '#' are ignored. Prefixes are masked.
+func ReadDatasetFile(path string) (MapTrie[netip.Prefix, netip.Addr, string], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MapTrie[netip.Prefix, netip.Addr, string]{}, err
+	}
+
+	if bytes.HasPrefix(data, []byte(snapshotMagic)) {
+		snapshot := MapTrieSnapshot[string]{Values: StringCodec{}}
+		if _, err := snapshot.ReadFrom(bytes.NewReader(data)); err != nil {
+			return MapTrie[netip.Prefix, netip.Addr, string]{}, fmt.Errorf("%s: %w", path, err)
+		}
+		return snapshot.Trie, nil
+	}
+
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		cidr, value := text, ""
+		if idx := strings.IndexFunc(text, unicode.IsSpace); idx >= 0 {
+			cidr, value = text[:idx], strings.TrimSpace(text[idx:])
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return MapTrie[netip.Prefix, netip.Addr, string]{}, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		trie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return MapTrie[netip.Prefix, netip.Addr, string]{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return trie, nil
+}
+
+// DiffSummary counts the changes written by WriteTableDiff.
+type DiffSummary struct {
+	Added   int
+	Removed int
+	Changed int
+}
+
+// WriteTableDiff writes one line per change: "+ prefix value" for added
+// prefixes, "- prefix value" for removed ones and "~ prefix old -> new"
+// for changed values. Empty values of added and removed prefixes are
+// omitted.
+func WriteTableDiff(w io.Writer, changes iter.Seq[PrefixChange[netip.Prefix, string]]) (DiffSummary, error) {
+	bw := bufio.NewWriter(w)
+
+	var summary DiffSummary
+	for change := range changes {
+		var err error
+		switch change.Kind {
+		case DiffAdded:
+			summary.Added++
+			_, err = fmt.Fprintln(bw, strings.TrimSpace("+ "+change.Prefix.String()+" "+change.New))
+		case DiffRemoved:
+			summary.Removed++
+			_, err = fmt.Fprintln(bw, strings.TrimSpace("- "+change.Prefix.String()+" "+change.Old))
+		case DiffChanged:
+			summary.Changed++
+			_, err = fmt.Fprintf(bw, "~ %s %s -> %s\n", change.Prefix, change.Old, change.New)
+		}
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, bw.Flush()
+}
+
+// DiffDatasetFiles writes the changes from the old to the new dataset
+// file, see ReadDatasetFile for the formats.
+func DiffDatasetFiles(w io.Writer, oldPath, newPath string) (DiffSummary, error) {
+	oldTrie, err := ReadDatasetFile(oldPath)
+	if err != nil {
+		return DiffSummary{}, err
+	}
+	newTrie, err := ReadDatasetFile(newPath)
+	if err != nil {
+		return DiffSummary{}, err
+	}
+
+	equal := func(a, b string) bool { return a == b }
+	return WriteTableDiff(w, oldTrie.Diff(&newTrie, comparePrefixes, equal))
+}
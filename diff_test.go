@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	diffOld = flag.String("diff-old", "", "old dataset file for TestDiffDatasetFilesCLI")
+	diffNew = flag.String("diff-new", "", "new dataset file for TestDiffDatasetFilesCLI")
+)
+
+// equalStrings compares string values
+func equalStrings(a, b string) bool {
+	return a == b
+}
+
+// TestMapTrieDiff tests the changes between two small tries
+func TestMapTrieDiff(t *testing.T) {
+	oldTrie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	newTrie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for _, p := range []struct{ cidr, value string }{
+		{"10.0.0.0/8", "DC1"},
+		{"10.1.0.0/16", "DC2"},
+		{"192.168.0.0/16", "DC3"},
+		{"2001:db8::/32", "DC4"},
+	} {
+		oldTrie.InsertOrUpdate(netip.MustParsePrefix(p.cidr), onEmptyString(p.value), onUpdateString(p.value))
+	}
+	for _, p := range []struct{ cidr, value string }{
+		{"10.0.0.0/8", "DC1"},
+		{"10.1.0.0/16", "DC5"},
+		{"10.1.1.0/24", "DC6"},
+		{"2001:db8::/32", "DC4"},
+		{"::/0", "DC7"},
+	} {
+		newTrie.InsertOrUpdate(netip.MustParsePrefix(p.cidr), onEmptyString(p.value), onUpdateString(p.value))
+	}
+
+	want := []PrefixChange[netip.Prefix, string]{
+		{Kind: DiffChanged, Prefix: netip.MustParsePrefix("10.1.0.0/16"), Old: "DC2", New: "DC5"},
+		{Kind: DiffAdded, Prefix: netip.MustParsePrefix("10.1.1.0/24"), New: "DC6"},
+		{Kind: DiffRemoved, Prefix: netip.MustParsePrefix("192.168.0.0/16"), Old: "DC3"},
+		{Kind: DiffAdded, Prefix: netip.MustParsePrefix("::/0"), New: "DC7"},
+	}
+	assert.Equal(t, want, slices.Collect(oldTrie.Diff(&newTrie, comparePrefixes, equalStrings)))
+	assert.Equal(t, want, slices.Collect(DiffTables(oldTrie.All(), newTrie.All(), comparePrefixes, equalStrings)))
+
+	assert.Empty(t, slices.Collect(oldTrie.Diff(&oldTrie, comparePrefixes, equalStrings)))
+	assert.Equal(t, "changed", DiffChanged.String())
+	assert.Equal(t, "DiffKind(7)", DiffKind(7).String())
+}
+
+// TestDiffTablesRandom compares MapTrie.Diff with DiffTables over
+// RadixTrie iteration on random tables
+func TestDiffTablesRandom(t *testing.T) {
+	prefixes := referencePrefixes(5000)
+	values := datacenterValues(len(prefixes))
+
+	oldTrie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	newTrie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	newRadix := NewRadixTrie[string]()
+	for idx, prefix := range prefixes {
+		value := values[idx]
+		if idx%7 != 0 {
+			oldTrie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+		}
+		if idx%5 == 0 {
+			value += "-changed"
+		}
+		if idx%11 != 0 {
+			newTrie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+			newRadix.Insert(prefix, value)
+		}
+	}
+
+	// RadixTrie already iterates in prefix order.
+	radixPrefixes := []netip.Prefix{}
+	for prefix := range newRadix.All() {
+		radixPrefixes = append(radixPrefixes, prefix)
+	}
+	require.Len(t, radixPrefixes, newRadix.Len())
+	assert.True(t, slices.IsSortedFunc(radixPrefixes, comparePrefixes))
+
+	want := slices.Collect(oldTrie.Diff(&newTrie, comparePrefixes, equalStrings))
+	got := slices.Collect(DiffTables(oldTrie.All(), newRadix.All(), comparePrefixes, equalStrings))
+	require.Equal(t, want, got)
+	require.True(t, slices.IsSortedFunc(got, func(a, b PrefixChange[netip.Prefix, string]) int {
+		return comparePrefixes(a.Prefix, b.Prefix)
+	}))
+
+	counts := map[DiffKind]int{}
+	for _, change := range got {
+		counts[change.Kind]++
+	}
+	assert.Positive(t, counts[DiffAdded])
+	assert.Positive(t, counts[DiffRemoved])
+	assert.Positive(t, counts[DiffChanged])
+
+	// Applying the changes to the old trie yields the new one.
+	for _, change := range got {
+		switch change.Kind {
+		case DiffRemoved:
+			oldTrie.UpdateOrDelete(change.Prefix, func(string) (string, bool) { return "", true })
+		default:
+			oldTrie.InsertOrUpdate(change.Prefix, onEmptyString(change.New), onUpdateString(change.New))
+		}
+	}
+	assert.Equal(t, newTrie.Dump(), oldTrie.Dump())
+
+	// Iteration stops early.
+	taken := 0
+	for range DiffTables(newTrie.All(), newRadix.All(), comparePrefixes, func(a, b string) bool { return false }) {
+		taken++
+		if taken == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, taken)
+}
+
+// TestDiffDatasetFiles tests reading text and snapshot dataset files and
+// the diff output
+func TestDiffDatasetFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	oldPath := filepath.Join(dir, "old.txt")
+	require.NoError(t, os.WriteFile(oldPath, []byte(`# old table
+10.0.0.0/8 DC1
+10.1.2.3/16	DC2
+
+2001:db8::/32   DC4
+192.168.0.0/16
+`), 0o644))
+
+	newTrie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for _, p := range []struct{ cidr, value string }{
+		{"10.0.0.0/8", "DC1"},
+		{"10.1.0.0/16", "DC5"},
+		{"2001:db8::/32", "DC4"},
+		{"2001:db8:1::/48", "DC6"},
+	} {
+		newTrie.InsertOrUpdate(netip.MustParsePrefix(p.cidr), onEmptyString(p.value), onUpdateString(p.value))
+	}
+	var snapshot bytes.Buffer
+	_, err := (&MapTrieSnapshot[string]{Trie: newTrie, Values: StringCodec{}}).WriteTo(&snapshot)
+	require.NoError(t, err)
+	newPath := filepath.Join(dir, "new.snapshot")
+	require.NoError(t, os.WriteFile(newPath, snapshot.Bytes(), 0o644))
+
+	var out bytes.Buffer
+	summary, err := DiffDatasetFiles(&out, oldPath, newPath)
+	require.NoError(t, err)
+	assert.Equal(t, DiffSummary{Added: 1, Removed: 1, Changed: 1}, summary)
+	assert.Equal(t, `~ 10.1.0.0/16 DC2 -> DC5
+- 192.168.0.0/16
++ 2001:db8:1::/48 DC6
+`, out.String())
+
+	t.Run("invalid line", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.txt")
+		require.NoError(t, os.WriteFile(path, []byte("10.0.0.0/8 DC1\n10.0.0.0/33 DC2\n"), 0o644))
+		_, err := ReadDatasetFile(path)
+		assert.ErrorContains(t, err, "invalid.txt:2:")
+	})
+
+	t.Run("corrupted snapshot", func(t *testing.T) {
+		data := bytes.Clone(snapshot.Bytes())
+		data[len(data)-1] ^= 0xff
+		path := filepath.Join(dir, "corrupted.snapshot")
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		_, err := ReadDatasetFile(path)
+		assert.ErrorIs(t, err, ErrSnapshotChecksum)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := DiffDatasetFiles(&out, filepath.Join(dir, "missing.txt"), newPath)
+		assert.Error(t, err)
+	})
+}
+
+// TestDiffDatasetFilesCLI diffs the files given with -diff-old and
+// -diff-new and writes the changes to stdout:
+//
+//	go test -v -run '^TestDiffDatasetFilesCLI$' -args -diff-old=old.txt -diff-new=new.txt
+func TestDiffDatasetFilesCLI(t *testing.T) {
+	if *diffOld == "" || *diffNew == "" {
+		t.Skip("set -diff-old and -diff-new to diff two dataset files")
+	}
+
+	summary, err := DiffDatasetFiles(os.Stdout, *diffOld, *diffNew)
+	require.NoError(t, err)
+	t.Logf("added %d, removed %d, changed %d", summary.Added, summary.Removed, summary.Changed)
+}
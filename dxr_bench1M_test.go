@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// dxrDirectBits lists the direct table sizes measured by the DXR
+// benchmarks.
+var dxrDirectBits = []int{16, 18, 20}
+
+// BenchmarkDXRBuild1M benchmarks building a DXR from 1M IPv4 prefixes
+func BenchmarkDXRBuild1M(b *testing.B) {
+	prefixes := randomIPv4Prefixes(1000_000)
+	values := datacenterValues(1000_000)
+
+	for _, k := range dxrDirectBits {
+		b.Run(fmt.Sprintf("ipv4_1M_prefixes_k%d", k), func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			for b.Loop() {
+				if _, err := NewDXR(k, prefixes, values); err != nil {
+					b.Fatalf("NewDXR: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDXRLookup1M benchmarks lookups in a DXR built from 1M IPv4
+// prefixes
+func BenchmarkDXRLookup1M(b *testing.B) {
+	prefixes := randomIPv4Prefixes(1000_000)
+	values := datacenterValues(1000_000)
+	addrs := randomIPv4Addrs(1000)
+
+	for _, k := range dxrDirectBits {
+		b.Run(fmt.Sprintf("ipv4_1M_prefixes_k%d", k), func(b *testing.B) {
+			// Measure memory before the build
+			runtime.GC()
+			var memBefore runtime.MemStats
+			runtime.ReadMemStats(&memBefore)
+
+			dxr, err := NewDXR(k, prefixes, values)
+			if err != nil {
+				b.Fatalf("NewDXR: %v", err)
+			}
+
+			// Measure memory after the build
+			runtime.GC()
+			var memAfter runtime.MemStats
+			runtime.ReadMemStats(&memAfter)
+
+			allocDiff := memAfter.Alloc - memBefore.Alloc
+			totalAllocDiff := memAfter.TotalAlloc - memBefore.TotalAlloc
+
+			b.Logf("Memory usage after 1M inserts: Alloc=%d bytes (%.2f MB), TotalAlloc=%d bytes (%.2f MB)",
+				allocDiff, float64(allocDiff)/(1024*1024),
+				totalAllocDiff, float64(totalAllocDiff)/(1024*1024))
+			stats := dxr.Stats()
+			b.Logf("dxr.directEntries: %d, dxr.rangeChunks: %d, dxr.ranges: %d, tables size: %d",
+				stats.DirectEntries, stats.RangeChunks, stats.Ranges, stats.SizeBytes)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			foundCount := 0
+			for b.Loop() {
+				val, ok := dxr.Lookup(addrs[idx])
+				if ok && val != "" {
+					foundCount++
+				}
+				idx = (idx + 1) % len(addrs)
+			}
+
+			if foundCount == 0 {
+				b.Fatalf("No successful lookups in %d iterations", b.N)
+			}
+
+			b.ReportMetric(float64(stats.SizeBytes), "table-bytes")
+			b.ReportMetric(float64(allocDiff), "heap-bytes")
+			runtime.KeepAlive(dxr)
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// noValue marks an address range that is not covered by any prefix.
+const noValue = ^uint32(0)
+
+// addrRange is a single element of a flattened prefix table.
+//
+// Ranges produced by flattenPrefixes are sorted, non-overlapping and
+// contiguous: a range spans from its Start up to the Start of the next
+// range minus one, or up to the last address of the family for the final
+// range.
+type addrRange struct {
+	// Start is the first address of the range.
+	Start netip.Addr
+	// Value is an index of the value assigned to the range, or noValue
+	// when no prefix covers it.
+	Value uint32
+}
+
+// prefixLastAddr returns the last address covered by the given prefix.
+func prefixLastAddr(prefix netip.Prefix) netip.Addr {
+	prefix = prefix.Masked()
+	bits := prefix.Bits()
+
+	if prefix.Addr().Is4() {
+		a := prefix.Addr().As4()
+		for i := bits; i < 32; i++ {
+			a[i/8] |= 0x80 >> (i % 8)
+		}
+		return netip.AddrFrom4(a)
+	}
+
+	a := prefix.Addr().As16()
+	for i := bits; i < 128; i++ {
+		a[i/8] |= 0x80 >> (i % 8)
+	}
+	return netip.AddrFrom16(a)
+}
+
+// flattenPrefixes converts a set of possibly overlapping prefixes into a
+// list of disjoint address ranges, where each range carries the value of
+// the longest prefix that covers it.
+//
+// The values slice holds a value index for each prefix. When the same
+// prefix occurs more than once, the last occurrence wins. All prefixes
+// must belong to the family selected by bitLen (32 or 128).
+//
+// Adjacent ranges with equal values are merged, so the result is the
+// minimal range representation of the table.
+func flattenPrefixes(prefixes []netip.Prefix, values []uint32, bitLen int) []addrRange {
+	type entry struct {
+		prefix netip.Prefix
+		value  uint32
+		order  int
+	}
+
+	entries := make([]entry, 0, len(prefixes))
+	for idx, prefix := range prefixes {
+		entries = append(entries, entry{prefix.Masked(), values[idx], idx})
+	}
+
+	// Sort by start address, then from shorter to longer prefixes so that
+	// covering prefixes are always visited before the nested ones.
+	slices.SortFunc(entries, func(a, b entry) int {
+		if c := a.prefix.Addr().Compare(b.prefix.Addr()); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.prefix.Bits(), b.prefix.Bits()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.order, b.order)
+	})
+
+	// Keep only the last occurrence of duplicated prefixes.
+	uniq := entries[:0]
+	for _, e := range entries {
+		if n := len(uniq); n > 0 && uniq[n-1].prefix == e.prefix {
+			uniq[n-1] = e
+			continue
+		}
+		uniq = append(uniq, e)
+	}
+
+	type active struct {
+		last  netip.Addr
+		value uint32
+	}
+
+	var first, last netip.Addr
+	if bitLen == 32 {
+		first = netip.IPv4Unspecified()
+		last = netip.AddrFrom4([4]byte{0xff, 0xff, 0xff, 0xff})
+	} else {
+		first = netip.IPv6Unspecified()
+		last = netip.AddrFrom16([16]byte{
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		})
+	}
+
+	out := []addrRange{}
+	emit := func(start netip.Addr, value uint32) {
+		// A later event at the same address overrides the earlier one.
+		if n := len(out); n > 0 && out[n-1].Start == start {
+			out = out[:n-1]
+		}
+		if n := len(out); n > 0 && out[n-1].Value == value {
+			return
+		}
+		out = append(out, addrRange{Start: start, Value: value})
+	}
+
+	// The stack holds the chain of prefixes covering the current position,
+	// with the sentinel covering the whole address space at the bottom.
+	stack := []active{{last: last, value: noValue}}
+	pop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if next := top.last.Next(); next.IsValid() {
+			emit(next, stack[len(stack)-1].value)
+		}
+	}
+
+	emit(first, noValue)
+	for _, e := range uniq {
+		start := e.prefix.Addr()
+		for stack[len(stack)-1].last.Less(start) {
+			pop()
+		}
+		stack = append(stack, active{last: prefixLastAddr(e.prefix), value: e.value})
+		emit(start, e.value)
+	}
+	for len(stack) > 1 {
+		pop()
+	}
+
+	return out
+}
+
+// DXR is a read-only IPv4 lookup structure based on the DXR algorithm
+// ("Towards a Billion Routing Lookups per Second in Software", Zec et al.).
+//
+// The prefix table is flattened into disjoint address ranges. The top k
+// bits of an address index a direct table. Each direct entry either
+// carries the value for the whole chunk, or points to a sorted slice of
+// ranges inside the chunk that is binary searched on the remaining bits.
+//
+// The type parameter V represents the value type stored for each prefix.
+type DXR[V any] struct {
+	bits   int
+	shift  uint32
+	mask   uint32
+	direct []dxrChunk
+	ranges []dxrRange
+	values []V
+}
+
+// dxrChunk is an entry of the DXR direct table.
+type dxrChunk struct {
+	// base is either the value index (when count is zero) or the offset
+	// of the first chunk range in the ranges table.
+	base uint32
+	// count is the number of ranges in the chunk, zero for chunks covered
+	// by a single value.
+	count uint32
+}
+
+// dxrRange is a range inside a DXR chunk.
+type dxrRange struct {
+	// start is the offset of the range from the start of the chunk.
+	start uint32
+	// value is the value index, or noValue.
+	value uint32
+}
+
+// DXRStats describes the memory layout of a DXR instance.
+type DXRStats struct {
+	// DirectBits is the number of address bits indexing the direct table.
+	DirectBits int
+	// DirectEntries is the size of the direct table.
+	DirectEntries int
+	// RangeChunks is the number of chunks that need a range search.
+	RangeChunks int
+	// Ranges is the total number of ranges stored.
+	Ranges int
+	// SizeBytes is the size of the lookup tables, excluding values.
+	SizeBytes int
+}
+
+// NewDXR builds a DXR with a direct table indexed by the top k bits from
+// the given IPv4 prefixes and their values.
+//
+// When the same prefix occurs more than once, the last value wins.
+// Returns an error if k is out of the supported 1..24 range or a prefix is
+// not an IPv4 one.
+func NewDXR[V any](k int, prefixes []netip.Prefix, values []V) (*DXR[V], error) {
+	if k < 1 || k > 24 {
+		return nil, fmt.Errorf("direct table bits must be in 1..24, got %d", k)
+	}
+	if len(prefixes) != len(values) {
+		return nil, fmt.Errorf("got %d prefixes but %d values", len(prefixes), len(values))
+	}
+
+	indices := make([]uint32, len(prefixes))
+	for idx, prefix := range prefixes {
+		if !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("prefix %s is not an IPv4 prefix", prefix)
+		}
+		indices[idx] = uint32(idx)
+	}
+
+	shift := uint32(32 - k)
+	d := &DXR[V]{
+		bits:   k,
+		shift:  shift,
+		mask:   1<<shift - 1,
+		direct: make([]dxrChunk, 1<<k),
+		values: slices.Clone(values),
+	}
+
+	flat := flattenPrefixes(prefixes, indices, 32)
+	starts := make([]uint32, len(flat))
+	for idx, r := range flat {
+		a := r.Start.As4()
+		starts[idx] = binary.BigEndian.Uint32(a[:])
+	}
+
+	// cur is the index of the range containing the start of the chunk.
+	cur := 0
+	for chunk := range d.direct {
+		chunkStart := uint64(chunk) << shift
+		chunkEnd := chunkStart + 1<<shift
+
+		next := cur + 1
+		for next < len(flat) && uint64(starts[next]) < chunkEnd {
+			next++
+		}
+
+		if next == cur+1 {
+			d.direct[chunk] = dxrChunk{base: flat[cur].Value}
+		} else {
+			d.direct[chunk] = dxrChunk{
+				base:  uint32(len(d.ranges)),
+				count: uint32(next - cur),
+			}
+			d.ranges = append(d.ranges, dxrRange{start: 0, value: flat[cur].Value})
+			for idx := cur + 1; idx < next; idx++ {
+				d.ranges = append(d.ranges, dxrRange{
+					start: starts[idx] - uint32(chunkStart),
+					value: flat[idx].Value,
+				})
+			}
+		}
+
+		// The last range of this chunk may continue into the next one.
+		cur = next - 1
+		if next < len(flat) && uint64(starts[next]) == chunkEnd {
+			cur = next
+		}
+	}
+
+	return d, nil
+}
+
+// Lookup searches the DXR for the value of the longest prefix matching
+// the given address.
+//
+// If no match is found or the address is not an IPv4 one, the function
+// returns the zero value and false.
+func (d *DXR[V]) Lookup(addr netip.Addr) (V, bool) {
+	if !addr.Is4() {
+		var zero V
+		return zero, false
+	}
+
+	a4 := addr.As4()
+	a := binary.BigEndian.Uint32(a4[:])
+
+	chunk := d.direct[a>>d.shift]
+	value := chunk.base
+	if chunk.count != 0 {
+		ranges := d.ranges[chunk.base : chunk.base+chunk.count]
+		offset := a & d.mask
+
+		// Find the last range starting at or before the offset. The first
+		// range of a chunk always starts at zero.
+		lo, hi := 0, len(ranges)
+		for hi-lo > 1 {
+			mid := int(uint(lo+hi) >> 1)
+			if ranges[mid].start <= offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		value = ranges[lo].value
+	}
+
+	if value == noValue {
+		var zero V
+		return zero, false
+	}
+
+	return d.values[value], true
+}
+
+// Stats returns the memory layout statistics of the DXR.
+func (d *DXR[V]) Stats() DXRStats {
+	rangeChunks := 0
+	for _, chunk := range d.direct {
+		if chunk.count != 0 {
+			rangeChunks++
+		}
+	}
+
+	return DXRStats{
+		DirectBits:    d.bits,
+		DirectEntries: len(d.direct),
+		RangeChunks:   rangeChunks,
+		Ranges:        len(d.ranges),
+		SizeBytes:     len(d.direct)*8 + len(d.ranges)*8,
+	}
+}
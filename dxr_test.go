@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+// TestDXRBasicOperations tests lookups in small DXR tables
+func TestDXRBasicOperations(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []struct{ cidr, value string }
+		lookups  []struct{ addr, want string }
+	}{
+		{
+			name: "single IPv4 prefix",
+			prefixes: []struct{ cidr, value string }{
+				{"192.168.1.0/24", "DC1"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"192.168.1.1", "DC1"},
+				{"192.168.1.255", "DC1"},
+				{"192.168.0.255", ""},
+				{"192.168.2.1", ""},
+			},
+		},
+		{
+			name: "overlapping IPv4 prefixes - more specific wins",
+			prefixes: []struct{ cidr, value string }{
+				{"10.0.0.0/8", "DC1"},
+				{"10.1.0.0/16", "DC2"},
+				{"10.1.1.0/24", "DC3"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"10.0.0.1", "DC1"},
+				{"10.1.0.1", "DC2"},
+				{"10.1.1.1", "DC3"},
+				{"10.1.2.1", "DC2"},
+				{"10.2.0.1", "DC1"},
+				{"11.0.0.1", ""},
+			},
+		},
+		{
+			name: "reverse insertion order - should still work",
+			prefixes: []struct{ cidr, value string }{
+				{"10.1.1.0/24", "DC3"},
+				{"10.1.0.0/16", "DC2"},
+				{"10.0.0.0/8", "DC1"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"10.0.0.1", "DC1"},
+				{"10.1.0.1", "DC2"},
+				{"10.1.1.1", "DC3"},
+			},
+		},
+		{
+			name: "default route and host routes at the edges",
+			prefixes: []struct{ cidr, value string }{
+				{"0.0.0.0/0", "DEFAULT"},
+				{"0.0.0.0/32", "FIRST"},
+				{"255.255.255.255/32", "LAST"},
+				{"255.255.255.0/24", "TAIL"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"0.0.0.0", "FIRST"},
+				{"0.0.0.1", "DEFAULT"},
+				{"8.8.8.8", "DEFAULT"},
+				{"255.255.255.254", "TAIL"},
+				{"255.255.255.255", "LAST"},
+			},
+		},
+		{
+			name: "duplicate prefix - last value wins",
+			prefixes: []struct{ cidr, value string }{
+				{"172.16.0.0/12", "OLD"},
+				{"172.16.0.0/12", "NEW"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"172.16.0.1", "NEW"},
+				{"172.31.255.255", "NEW"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, k := range []int{1, 8, 16, 20, 24} {
+			t.Run(fmt.Sprintf("%s/k=%d", tt.name, k), func(t *testing.T) {
+				var prefixes []netip.Prefix
+				var values []string
+				for _, p := range tt.prefixes {
+					prefixes = append(prefixes, netip.MustParsePrefix(p.cidr))
+					values = append(values, p.value)
+				}
+
+				dxr, err := NewDXR(k, prefixes, values)
+				if err != nil {
+					t.Fatalf("NewDXR: %v", err)
+				}
+
+				for _, lookup := range tt.lookups {
+					got, found := dxr.Lookup(netip.MustParseAddr(lookup.addr))
+					if lookup.want == "" {
+						if found {
+							t.Errorf("Lookup(%s) = %q, want not found", lookup.addr, got)
+						}
+						continue
+					}
+					if !found {
+						t.Errorf("Lookup(%s) not found, want %q", lookup.addr, lookup.want)
+					} else if got != lookup.want {
+						t.Errorf("Lookup(%s) = %q, want %q", lookup.addr, got, lookup.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestDXRInvalidInput tests that invalid parameters are rejected
+func TestDXRInvalidInput(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	values := []string{"DC1"}
+
+	for _, k := range []int{0, 25, 32} {
+		if _, err := NewDXR(k, prefixes, values); err == nil {
+			t.Errorf("NewDXR(%d) succeeded, want error", k)
+		}
+	}
+
+	if _, err := NewDXR(16, []netip.Prefix{netip.MustParsePrefix("2001:db8::/32")}, values); err == nil {
+		t.Errorf("NewDXR with IPv6 prefix succeeded, want error")
+	}
+
+	if _, err := NewDXR[string](16, prefixes, nil); err == nil {
+		t.Errorf("NewDXR with mismatched values succeeded, want error")
+	}
+
+	dxr, err := NewDXR(16, prefixes, values)
+	if err != nil {
+		t.Fatalf("NewDXR: %v", err)
+	}
+	if _, found := dxr.Lookup(netip.MustParseAddr("2001:db8::1")); found {
+		t.Errorf("IPv6 lookup in IPv4 DXR succeeded")
+	}
+}
+
+// TestDXRMatchesMapTrie compares DXR lookups against MapTrie on random data
+func TestDXRMatchesMapTrie(t *testing.T) {
+	prefixes := randomIPv4Prefixes(20_000)
+	values := datacenterValues(len(prefixes))
+
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for i, prefix := range prefixes {
+		trie.InsertOrUpdate(prefix, onEmptyString(values[i]), onUpdateString(values[i]))
+	}
+
+	// Probe random addresses and addresses around prefix boundaries.
+	addrs := randomIPv4Addrs(20_000)
+	for _, prefix := range prefixes[:2000] {
+		last := prefixLastAddr(prefix)
+		addrs = append(addrs, prefix.Addr(), prefix.Addr().Prev(), last, last.Next())
+	}
+
+	for _, k := range []int{1, 8, 12, 16, 18, 20, 24} {
+		t.Run(fmt.Sprintf("k=%d", k), func(t *testing.T) {
+			dxr, err := NewDXR(k, prefixes, values)
+			if err != nil {
+				t.Fatalf("NewDXR: %v", err)
+			}
+
+			for _, addr := range addrs {
+				if !addr.IsValid() {
+					continue
+				}
+				_, want, wantFound := trie.Lookup(addr)
+				got, found := dxr.Lookup(addr)
+				if found != wantFound || got != want {
+					t.Fatalf("Lookup(%s) = %q, %v; want %q, %v", addr, got, found, want, wantFound)
+				}
+			}
+		})
+	}
+}
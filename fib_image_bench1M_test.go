@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sakateka/lpm"
+)
+
+// writeFIBImage compiles the 1M dataset into a file in a temporary
+// directory and returns its path.
+func writeFIBImage(b *testing.B, name string, generate func(n int) []netip.Prefix) string {
+	b.Helper()
+
+	trie := loadMapTrie(b, name, generate, 1000_000)
+	path := filepath.Join(b.TempDir(), name+".fib")
+
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatalf("create image: %v", err)
+	}
+	if _, err := CompileFIB(f, trie, StringCodec{}); err != nil {
+		_ = f.Close()
+		b.Fatalf("compile image: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatalf("close image: %v", err)
+	}
+
+	return path
+}
+
+// BenchmarkFIBImageCompile1M benchmarks compilation of a MapTrie with 1M
+// prefixes into an image
+func BenchmarkFIBImageCompile1M(b *testing.B) {
+	for _, ds := range prefixDatasets() {
+		b.Run(ds.name, func(b *testing.B) {
+			trie := loadMapTrie(b, ds.name, ds.prefixes, 1000_000)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			var size int64
+			for b.Loop() {
+				n, err := CompileFIB(io.Discard, trie, StringCodec{})
+				if err != nil {
+					b.Fatalf("CompileFIB: %v", err)
+				}
+				size = n
+			}
+
+			b.ReportMetric(float64(size), "image-bytes")
+		})
+	}
+}
+
+// BenchmarkFIBImageLoad1M compares the time to a first answer from a
+// memory-mapped image against rebuilding MapTrie or lpm from the 1M
+// prefixes. Every iteration loads the table and performs one lookup, the
+// first lookup latency is reported separately. The image file stays in
+// the page cache between iterations, so mmap faults are minor ones.
+func BenchmarkFIBImageLoad1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	for _, ds := range prefixDatasets() {
+		prefixes := ds.prefixes(1000_000)
+		addr := prefixes[len(prefixes)/2].Addr()
+
+		// firstLookup runs load and reports the average latency of the
+		// lookup that follows it.
+		firstLookup := func(b *testing.B, load func() func(netip.Addr) bool) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			var total time.Duration
+			for b.Loop() {
+				lookup := load()
+				start := time.Now()
+				if !lookup(addr) {
+					b.Fatalf("Lookup(%s) not found", addr)
+				}
+				total += time.Since(start)
+			}
+
+			b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "first-lookup-ns")
+		}
+
+		b.Run(ds.name+"/mmap_image", func(b *testing.B) {
+			path := writeFIBImage(b, ds.name, ds.prefixes)
+			var img *FIBImage
+
+			firstLookup(b, func() func(netip.Addr) bool {
+				if img != nil {
+					_ = img.Close()
+				}
+				var err error
+				if img, err = OpenFIBImage(path); err != nil {
+					b.Fatalf("OpenFIBImage: %v", err)
+				}
+				return func(addr netip.Addr) bool {
+					_, ok := img.Lookup(addr)
+					return ok
+				}
+			})
+			_ = img.Close()
+		})
+
+		b.Run(ds.name+"/maptrie_rebuild", func(b *testing.B) {
+			firstLookup(b, func() func(netip.Addr) bool {
+				trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+				for i, prefix := range prefixes {
+					trie.InsertOrUpdate(prefix, onEmptyString(values[i]), onUpdateString(values[i]))
+				}
+				return func(addr netip.Addr) bool {
+					_, _, ok := trie.Lookup(addr)
+					return ok
+				}
+			})
+		})
+
+		b.Run(ds.name+"/lpm_rebuild", func(b *testing.B) {
+			firstLookup(b, func() func(netip.Addr) bool {
+				table := lpm.New()
+				for i, prefix := range prefixes {
+					table.Insert(prefix, values[i])
+				}
+				return func(addr netip.Addr) bool {
+					_, ok := table.Lookup(addr)
+					return ok
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkFIBImageLookup1M benchmarks lookups in a memory-mapped image
+// compiled from 1M prefixes
+func BenchmarkFIBImageLookup1M(b *testing.B) {
+	for _, ds := range prefixDatasets() {
+		b.Run(ds.name, func(b *testing.B) {
+			img, err := OpenFIBImage(writeFIBImage(b, ds.name, ds.prefixes))
+			if err != nil {
+				b.Fatalf("OpenFIBImage: %v", err)
+			}
+			defer img.Close()
+
+			var addrs []netip.Addr
+			if ds.name == "ipv4_1M_prefixes" {
+				addrs = randomIPv4Addrs(1000)
+			} else {
+				addrs = randomIPv6Addrs(1000)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			foundCount := 0
+			for b.Loop() {
+				val, ok := img.Lookup(addrs[idx])
+				if ok && len(val) != 0 {
+					foundCount++
+				}
+				idx = (idx + 1) % len(addrs)
+			}
+
+			if foundCount == 0 {
+				b.Fatalf("No successful lookups in %d iterations", b.N)
+			}
+
+			b.ReportMetric(float64(img.Size()), "image-bytes")
+		})
+	}
+}
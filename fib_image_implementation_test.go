@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/netip"
+)
+
+// Compiled FIB image format, all integers are little endian:
+//
+//	header:  64 bytes, see fibHeader
+//	family:  for IPv4, then for IPv6
+//	         direct  (1<<16 + 1) x uint32, range index per top 16 bits
+//	         starts  ranges x uint32 (IPv4) or ranges x 2 x uint64 (IPv6)
+//	         values  ranges x uint32, value index or noValue
+//	values:  (count + 1) x uint32 offsets into the blob, blob bytes
+//
+// The image holds no pointers and needs no decoding: lookups read the
+// sections directly, so a memory-mapped file is usable right after the
+// header is validated.
+const (
+	fibMagic      = "LPMF"
+	fibVersion    = 1
+	fibHeaderSize = 64
+	fibDirectBits = 16
+)
+
+// ErrFIBImageClosed is returned when verifying a closed image.
+var ErrFIBImageClosed = errors.New("FIB image is closed")
+
+// fibHeader describes the sizes of the image sections.
+type fibHeader struct {
+	v4Ranges uint32
+	v6Ranges uint32
+	values   uint32
+	blobSize uint32
+	// checksum is the CRC-32C of everything after the header. It is only
+	// checked by FIBImage.Verify, because it requires reading the whole
+	// image.
+	checksum uint32
+}
+
+func (h fibHeader) size() int {
+	direct := (1<<fibDirectBits + 1) * 4
+	return fibHeaderSize +
+		direct + int(h.v4Ranges)*(4+4) +
+		direct + int(h.v6Ranges)*(16+4) +
+		(int(h.values)+1)*4 + int(h.blobSize)
+}
+
+func (h fibHeader) append(dst []byte) []byte {
+	dst = append(dst, fibMagic...)
+	dst = binary.LittleEndian.AppendUint16(dst, fibVersion)
+	dst = binary.LittleEndian.AppendUint16(dst, fibDirectBits)
+	dst = binary.LittleEndian.AppendUint32(dst, h.v4Ranges)
+	dst = binary.LittleEndian.AppendUint32(dst, h.v6Ranges)
+	dst = binary.LittleEndian.AppendUint32(dst, h.values)
+	dst = binary.LittleEndian.AppendUint32(dst, h.blobSize)
+	dst = binary.LittleEndian.AppendUint32(dst, h.checksum)
+	return append(dst, make([]byte, fibHeaderSize-28)...)
+}
+
+// fibFamily holds the sections of a single address family.
+type fibFamily struct {
+	direct []byte
+	starts []byte
+	values []byte
+}
+
+// FIBImage is a compiled, immutable prefix table that is queried in place.
+type FIBImage struct {
+	data     []byte
+	header   fibHeader
+	v4, v6   fibFamily
+	offsets  []byte
+	blob     []byte
+	release  func() error
+	released bool
+}
+
+// CompileFIB writes the compiled image of the trie to w. Values are
+// encoded with the codec and stored once per distinct encoding, in the
+// order of their first prefix, so that a table always compiles to the same
+// image.
+func CompileFIB[V any](w io.Writer, trie MapTrie[netip.Prefix, netip.Addr, V], codec ValueCodec[V]) (int64, error) {
+	var v4, v6 []netip.Prefix
+	var v4Values, v6Values []uint32
+
+	blob := []byte{}
+	offsets := []uint32{0}
+	seen := map[string]uint32{}
+	var encoded []byte
+
+	for bits := range trie {
+		prefixes, values := sortedEntries(trie[bits], comparePrefixes)
+		for idx, prefix := range prefixes {
+			value := values[idx]
+			encoded = codec.AppendValue(encoded[:0], value)
+			idx, ok := seen[string(encoded)]
+			if !ok {
+				idx = uint32(len(offsets) - 1)
+				seen[string(encoded)] = idx
+				blob = append(blob, encoded...)
+				offsets = append(offsets, uint32(len(blob)))
+			}
+
+			if prefix.Addr().Is4() {
+				v4, v4Values = append(v4, prefix), append(v4Values, idx)
+			} else {
+				v6, v6Values = append(v6, prefix), append(v6Values, idx)
+			}
+		}
+	}
+
+	v4Ranges := flattenPrefixes(v4, v4Values, 32)
+	v6Ranges := flattenPrefixes(v6, v6Values, 128)
+
+	header := fibHeader{
+		v4Ranges: uint32(len(v4Ranges)),
+		v6Ranges: uint32(len(v6Ranges)),
+		values:   uint32(len(offsets) - 1),
+		blobSize: uint32(len(blob)),
+	}
+
+	// The checksum goes to the header, so the body is built in memory
+	// first. It is a small fraction of the trie being compiled.
+	body := make([]byte, 0, header.size()-fibHeaderSize)
+	body = appendFIBFamily(body, v4Ranges, 32)
+	body = appendFIBFamily(body, v6Ranges, 128)
+	for _, offset := range offsets {
+		body = binary.LittleEndian.AppendUint32(body, offset)
+	}
+	body = append(body, blob...)
+	header.checksum = crc32.Checksum(body, snapshotCRCTable)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	if _, err := bw.Write(header.append(nil)); err != nil {
+		return cw.n, err
+	}
+	if _, err := bw.Write(body); err != nil {
+		return cw.n, err
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// appendFIBFamily appends the direct table, range starts and range values
+// of one family.
+func appendFIBFamily(dst []byte, ranges []addrRange, bitLen int) []byte {
+	// cur is the index of the range containing the start of the chunk.
+	cur := 0
+	for chunk := range 1 << fibDirectBits {
+		chunkStart := fibChunkStart(chunk, bitLen)
+		for cur+1 < len(ranges) && !chunkStart.Less(ranges[cur+1].Start) {
+			cur++
+		}
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(cur))
+	}
+	// The sentinel lets the last chunk search up to the last range.
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(ranges)-1))
+
+	for _, r := range ranges {
+		if bitLen == 32 {
+			a := r.Start.As4()
+			dst = binary.LittleEndian.AppendUint32(dst, binary.BigEndian.Uint32(a[:]))
+			continue
+		}
+		a := r.Start.As16()
+		dst = binary.LittleEndian.AppendUint64(dst, binary.BigEndian.Uint64(a[:8]))
+		dst = binary.LittleEndian.AppendUint64(dst, binary.BigEndian.Uint64(a[8:]))
+	}
+
+	for _, r := range ranges {
+		dst = binary.LittleEndian.AppendUint32(dst, r.Value)
+	}
+
+	return dst
+}
+
+// fibChunkStart returns the first address of the direct table chunk.
+func fibChunkStart(chunk int, bitLen int) netip.Addr {
+	if bitLen == 32 {
+		return netip.AddrFrom4([4]byte{byte(chunk >> 8), byte(chunk)})
+	}
+	return netip.AddrFrom16([16]byte{byte(chunk >> 8), byte(chunk)})
+}
+
+// ParseFIBImage validates the header of a compiled image and returns a
+// FIBImage reading directly from data. The data must not be modified
+// while the image is in use.
+//
+// Only the section sizes are checked. Lookups in a corrupted image may
+// panic unless it passed Verify.
+func ParseFIBImage(data []byte) (*FIBImage, error) {
+	if len(data) < fibHeaderSize {
+		return nil, fmt.Errorf("FIB image is %d bytes, shorter than its header", len(data))
+	}
+	if string(data[:4]) != fibMagic {
+		return nil, fmt.Errorf("invalid FIB image magic %q", data[:4])
+	}
+	if version := binary.LittleEndian.Uint16(data[4:]); version != fibVersion {
+		return nil, fmt.Errorf("unsupported FIB image version %d", version)
+	}
+	if bits := binary.LittleEndian.Uint16(data[6:]); bits != fibDirectBits {
+		return nil, fmt.Errorf("unsupported FIB direct table bits %d", bits)
+	}
+
+	header := fibHeader{
+		v4Ranges: binary.LittleEndian.Uint32(data[8:]),
+		v6Ranges: binary.LittleEndian.Uint32(data[12:]),
+		values:   binary.LittleEndian.Uint32(data[16:]),
+		blobSize: binary.LittleEndian.Uint32(data[20:]),
+		checksum: binary.LittleEndian.Uint32(data[24:]),
+	}
+	if header.v4Ranges == 0 || header.v6Ranges == 0 {
+		return nil, errors.New("FIB image must cover both address families")
+	}
+	if size := header.size(); size != len(data) {
+		return nil, fmt.Errorf("FIB image is %d bytes, header describes %d", len(data), size)
+	}
+
+	img := &FIBImage{data: data, header: header}
+	rest := data[fibHeaderSize:]
+	take := func(n int) []byte {
+		section := rest[:n:n]
+		rest = rest[n:]
+		return section
+	}
+
+	direct := (1<<fibDirectBits + 1) * 4
+	img.v4 = fibFamily{take(direct), take(int(header.v4Ranges) * 4), take(int(header.v4Ranges) * 4)}
+	img.v6 = fibFamily{take(direct), take(int(header.v6Ranges) * 16), take(int(header.v6Ranges) * 4)}
+	img.offsets = take((int(header.values) + 1) * 4)
+	img.blob = take(int(header.blobSize))
+
+	return img, nil
+}
+
+// Verify checks the image checksum and that every section index stays in
+// bounds. It reads the whole image.
+func (img *FIBImage) Verify() error {
+	if img.data == nil {
+		return ErrFIBImageClosed
+	}
+	if crc32.Checksum(img.data[fibHeaderSize:], snapshotCRCTable) != img.header.checksum {
+		return ErrSnapshotChecksum
+	}
+
+	for _, f := range []struct {
+		family *fibFamily
+		ranges uint32
+	}{{&img.v4, img.header.v4Ranges}, {&img.v6, img.header.v6Ranges}} {
+		prev := uint32(0)
+		for off := 0; off < len(f.family.direct); off += 4 {
+			idx := binary.LittleEndian.Uint32(f.family.direct[off:])
+			if idx >= f.ranges || idx < prev {
+				return fmt.Errorf("FIB direct entry %d points to range %d of %d", off/4, idx, f.ranges)
+			}
+			prev = idx
+		}
+		for off := 0; off < len(f.family.values); off += 4 {
+			if value := binary.LittleEndian.Uint32(f.family.values[off:]); value != noValue && value >= img.header.values {
+				return fmt.Errorf("FIB range %d points to value %d of %d", off/4, value, img.header.values)
+			}
+		}
+	}
+
+	prev := uint32(0)
+	for off := 0; off < len(img.offsets); off += 4 {
+		offset := binary.LittleEndian.Uint32(img.offsets[off:])
+		if offset < prev || offset > img.header.blobSize {
+			return fmt.Errorf("FIB value %d has invalid offset %d", off/4, offset)
+		}
+		prev = offset
+	}
+
+	return nil
+}
+
+// Lookup returns the encoded value of the longest prefix matching the
+// address. The returned slice points into the image.
+//
+// If no match is found or the image is closed, the function returns nil
+// and false.
+func (img *FIBImage) Lookup(addr netip.Addr) ([]byte, bool) {
+	if img.data == nil {
+		return nil, false
+	}
+
+	var value uint32
+	if addr.Is4() {
+		a4 := addr.As4()
+		value = img.v4.lookup4(binary.BigEndian.Uint32(a4[:]))
+	} else {
+		a16 := addr.As16()
+		value = img.v6.lookup6(binary.BigEndian.Uint64(a16[:8]), binary.BigEndian.Uint64(a16[8:]))
+	}
+
+	if value == noValue {
+		return nil, false
+	}
+
+	start := binary.LittleEndian.Uint32(img.offsets[value*4:])
+	end := binary.LittleEndian.Uint32(img.offsets[value*4+4:])
+	return img.blob[start:end:end], true
+}
+
+// bounds returns the inclusive range index interval of the chunk.
+func (f *fibFamily) bounds(chunk uint32) (int, int) {
+	return int(binary.LittleEndian.Uint32(f.direct[chunk*4:])),
+		int(binary.LittleEndian.Uint32(f.direct[chunk*4+4:]))
+}
+
+func (f *fibFamily) lookup4(a uint32) uint32 {
+	// Find the last range starting at or before the address. The first
+	// candidate always contains the start of the chunk.
+	lo, hi := f.bounds(a >> (32 - fibDirectBits))
+	for lo < hi {
+		mid := int(uint(lo+hi+1) >> 1)
+		if binary.LittleEndian.Uint32(f.starts[mid*4:]) <= a {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return binary.LittleEndian.Uint32(f.values[lo*4:])
+}
+
+func (f *fibFamily) lookup6(aHi, aLo uint64) uint32 {
+	lo, hi := f.bounds(uint32(aHi >> (64 - fibDirectBits)))
+	for lo < hi {
+		mid := int(uint(lo+hi+1) >> 1)
+		sHi := binary.LittleEndian.Uint64(f.starts[mid*16:])
+		sLo := binary.LittleEndian.Uint64(f.starts[mid*16+8:])
+		if sHi < aHi || sHi == aHi && sLo <= aLo {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return binary.LittleEndian.Uint32(f.values[lo*4:])
+}
+
+// Size returns the image size in bytes.
+func (img *FIBImage) Size() int {
+	return len(img.data)
+}
+
+// Close releases the memory mapping of an image opened with OpenFIBImage.
+// The image is empty afterwards: lookups find nothing and Verify fails
+// with ErrFIBImageClosed.
+func (img *FIBImage) Close() error {
+	img.data, img.v4, img.v6, img.offsets, img.blob = nil, fibFamily{}, fibFamily{}, nil, nil
+	if img.release == nil || img.released {
+		return nil
+	}
+	img.released = true
+	return img.release()
+}
+
+// OpenFIBImage maps the compiled image file into memory and validates its
+// header. The image must be closed to release the mapping.
+func OpenFIBImage(path string) (*FIBImage, error) {
+	data, release, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := ParseFIBImage(data)
+	if err != nil {
+		_ = release()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	img.release = release
+
+	return img, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compileFIB compiles the trie into an in-memory image
+func compileFIB[V any](t *testing.T, trie MapTrie[netip.Prefix, netip.Addr, V], codec ValueCodec[V]) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	n, err := CompileFIB(&buf, trie, codec)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+	return buf.Bytes()
+}
+
+// requireFIBMatchesMapTrie compares image lookups against the trie
+func requireFIBMatchesMapTrie(t *testing.T, img *FIBImage, trie MapTrie[netip.Prefix, netip.Addr, string], addrs []netip.Addr) {
+	t.Helper()
+
+	for _, addr := range addrs {
+		_, want, wantOk := trie.Lookup(addr)
+		got, ok := img.Lookup(addr)
+		require.Equal(t, wantOk, ok, "Lookup(%s)", addr)
+		require.Equal(t, want, string(got), "Lookup(%s)", addr)
+	}
+}
+
+// TestFIBImageBasicOperations tests lookups in a small compiled image
+func TestFIBImageBasicOperations(t *testing.T) {
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for _, p := range []struct{ cidr, value string }{
+		{"0.0.0.0/0", "DEFAULT"},
+		{"10.0.0.0/8", "DC1"},
+		{"10.1.0.0/16", "DC2"},
+		{"10.1.1.0/24", "DC1"},
+		{"255.255.255.255/32", "DC3"},
+		{"2001:db8::/32", "DC4"},
+		{"2001:db8:1::/48", "DC5"},
+		{"ffff::/16", "DC6"},
+	} {
+		trie.InsertOrUpdate(netip.MustParsePrefix(p.cidr), onEmptyString(p.value), onUpdateString(p.value))
+	}
+
+	img, err := ParseFIBImage(compileFIB(t, trie, StringCodec{}))
+	require.NoError(t, err)
+	require.NoError(t, img.Verify())
+	assert.Equal(t, uint32(7), img.header.values, "equal values must be stored once")
+
+	lookups := []struct{ addr, want string }{
+		{"8.8.8.8", "DEFAULT"},
+		{"10.0.0.1", "DC1"},
+		{"10.1.0.1", "DC2"},
+		{"10.1.1.1", "DC1"},
+		{"255.255.255.254", "DEFAULT"},
+		{"255.255.255.255", "DC3"},
+		{"2001:db8::1", "DC4"},
+		{"2001:db8:1::1", "DC5"},
+		{"ffff:ffff::1", "DC6"},
+		{"2001:db9::1", ""},
+		{"::", ""},
+	}
+	for _, lookup := range lookups {
+		got, found := img.Lookup(netip.MustParseAddr(lookup.addr))
+		if lookup.want == "" {
+			assert.False(t, found, "Lookup(%s) = %q, want not found", lookup.addr, got)
+			continue
+		}
+		assert.True(t, found, "Lookup(%s) not found", lookup.addr)
+		assert.Equal(t, lookup.want, string(got), "Lookup(%s)", lookup.addr)
+	}
+
+	// Closing an image that is not mapped is a no-op.
+	assert.NoError(t, img.Close())
+}
+
+// TestFIBImageEmpty tests that an empty table compiles to a valid image
+func TestFIBImageEmpty(t *testing.T) {
+	img, err := ParseFIBImage(compileFIB(t, NewMapTrie[netip.Prefix, netip.Addr, string](0), StringCodec{}))
+	require.NoError(t, err)
+	require.NoError(t, img.Verify())
+
+	_, found := img.Lookup(netip.MustParseAddr("10.0.0.1"))
+	assert.False(t, found)
+	_, found = img.Lookup(netip.MustParseAddr("2001:db8::1"))
+	assert.False(t, found)
+}
+
+// TestFIBImageMatchesMapTrie compares a memory-mapped image against the
+// MapTrie it was compiled from
+func TestFIBImageMatchesMapTrie(t *testing.T) {
+	prefixes := referencePrefixes(5000)
+	values := datacenterValues(len(prefixes))
+	addrs := referenceAddrs(prefixes, 5000)
+
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for idx, prefix := range prefixes {
+		// Repeat values so that ranges of distinct prefixes share them.
+		value := values[idx%300]
+		trie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+	}
+
+	path := filepath.Join(t.TempDir(), "fib.img")
+	require.NoError(t, os.WriteFile(path, compileFIB(t, trie, StringCodec{}), 0o644))
+
+	img, err := OpenFIBImage(path)
+	require.NoError(t, err)
+	require.NoError(t, img.Verify())
+	requireFIBMatchesMapTrie(t, img, trie, addrs)
+
+	require.NoError(t, img.Close())
+	assert.NoError(t, img.Close(), "second Close must be a no-op")
+	_, found := img.Lookup(addrs[0])
+	assert.False(t, found, "lookups in a closed image find nothing")
+	assert.ErrorIs(t, img.Verify(), ErrFIBImageClosed)
+	assert.Zero(t, img.Size())
+}
+
+// TestCompileFIBReproducible tests that a table always compiles to the
+// same image
+func TestCompileFIBReproducible(t *testing.T) {
+	prefixes := referencePrefixes(1000)
+	values := datacenterValues(len(prefixes))
+
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for idx, prefix := range prefixes {
+		value := values[idx%100]
+		trie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+	}
+
+	want := compileFIB(t, trie, StringCodec{})
+	for range 5 {
+		require.Equal(t, want, compileFIB(t, trie, StringCodec{}))
+	}
+}
+
+// TestFIBImageCorruption tests header validation and checksum verification
+func TestFIBImageCorruption(t *testing.T) {
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for idx, prefix := range referencePrefixes(100) {
+		trie.InsertOrUpdate(prefix, onEmptyString("DC"), onUpdateString(string(rune('A'+idx%26))))
+	}
+	data := compileFIB(t, trie, StringCodec{})
+
+	modify := func(fn func([]byte) []byte) []byte {
+		return fn(bytes.Clone(data))
+	}
+
+	parseErrors := []struct {
+		name    string
+		data    []byte
+		errText string
+	}{
+		{"short header", data[:10], "shorter than its header"},
+		{"bad magic", modify(func(b []byte) []byte { copy(b, "LPMX"); return b }), "invalid FIB image magic"},
+		{"unsupported version", modify(func(b []byte) []byte { binary.LittleEndian.PutUint16(b[4:], 2); return b }), "unsupported FIB image version 2"},
+		{"unsupported direct bits", modify(func(b []byte) []byte { binary.LittleEndian.PutUint16(b[6:], 8); return b }), "direct table bits 8"},
+		{"truncated", data[:len(data)-1], "header describes"},
+		{"range count mismatch", modify(func(b []byte) []byte { b[8]++; return b }), "header describes"},
+	}
+	for _, tt := range parseErrors {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFIBImage(tt.data)
+			assert.ErrorContains(t, err, tt.errText)
+		})
+	}
+
+	t.Run("flipped body byte", func(t *testing.T) {
+		img, err := ParseFIBImage(modify(func(b []byte) []byte { b[len(b)/2] ^= 0x01; return b }))
+		require.NoError(t, err, "body corruption is only detected by Verify")
+		assert.ErrorIs(t, img.Verify(), ErrSnapshotChecksum)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := OpenFIBImage(filepath.Join(t.TempDir(), "missing.img"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+// convertKeys converts a dataset with the given conversion, which must
+// not fail for it.
+func convertKeys[K any](tb testing.TB, prefixes []netip.Prefix, convert func(netip.Prefix) (K, error)) []K {
+	tb.Helper()
+
+	keys := make([]K, len(prefixes))
+	for idx, prefix := range prefixes {
+		key, err := convert(prefix)
+		if err != nil {
+			tb.Fatalf("convert %s: %v", prefix, err)
+		}
+		keys[idx] = key
+	}
+	return keys
+}
+
+// convertQueries converts lookup addresses with the given conversion.
+func convertQueries[Q any](addrs []netip.Addr, convert func(netip.Addr) Q) []Q {
+	queries := make([]Q, len(addrs))
+	for idx, addr := range addrs {
+		queries[idx] = convert(addr)
+	}
+	return queries
+}
+
+// benchmarkMapTrieInsert inserts the keys in a loop.
+func benchmarkMapTrieInsert[K MapTrieKey[K], Q MapTrieQuery[K]](b *testing.B, keys []K, values []string) {
+	b.ReportAllocs()
+	captureProfiles(b)
+
+	trie := NewMapTrie[K, Q, string](0)
+	idx := 0
+
+	for b.Loop() {
+		trie.InsertOrUpdate(keys[idx], onEmptyString(values[idx]), onUpdateString(values[idx]))
+		idx = (idx + 1) % len(keys)
+	}
+}
+
+// benchmarkMapTrieLookup loads the keys, reports the memory used by the
+// trie and benchmarks lookups of the queries.
+func benchmarkMapTrieLookup[K MapTrieKey[K], Q MapTrieQuery[K]](b *testing.B, keys []K, values []string, queries []Q) {
+	// Measure memory before insertion
+	runtime.GC()
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+
+	trie := NewMapTrie[K, Q, string](0)
+	for i, key := range keys {
+		trie.InsertOrUpdate(key, onEmptyString(values[i]), onUpdateString(values[i]))
+	}
+
+	// Measure memory after insertion
+	runtime.GC()
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
+
+	allocDiff := memAfter.Alloc - memBefore.Alloc
+	stats := trie.Stats()
+	b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB), estimated table size: %d",
+		len(keys), allocDiff, float64(allocDiff)/(1024*1024), stats.Maps.Bytes)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	captureProfiles(b)
+
+	idx := 0
+	foundCount := 0
+	for b.Loop() {
+		_, val, ok := trie.Lookup(queries[idx])
+		if ok && val != "" {
+			foundCount++
+		}
+		idx = (idx + 1) % len(queries)
+	}
+
+	if foundCount == 0 {
+		b.Fatalf("No successful lookups in %d iterations", b.N)
+	}
+
+	b.ReportMetric(float64(stats.Maps.Bytes), "table-bytes")
+	b.ReportMetric(float64(allocDiff), "heap-bytes")
+}
+
+// BenchmarkFixedKeyMapTrieInsert1M compares insertion of 1M prefixes with
+// netip and fixed width keys
+func BenchmarkFixedKeyMapTrieInsert1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	v4 := randomIPv4Prefixes(1000_000)
+	b.Run("ipv4_1M_prefixes/netip", func(b *testing.B) {
+		benchmarkMapTrieInsert[netip.Prefix, netip.Addr](b, v4, values)
+	})
+	b.Run("ipv4_1M_prefixes/fixed", func(b *testing.B) {
+		benchmarkMapTrieInsert[IPv4Prefix, IPv4Addr](b, convertKeys(b, v4, IPv4PrefixFromNetip), values)
+	})
+
+	v6 := randomIPv6Prefixes(1000_000)
+	b.Run("ipv6_1M_prefixes/netip", func(b *testing.B) {
+		benchmarkMapTrieInsert[netip.Prefix, netip.Addr](b, v6, values)
+	})
+	b.Run("ipv6_1M_prefixes/fixed", func(b *testing.B) {
+		benchmarkMapTrieInsert[IPv6Prefix, IPv6Addr](b, convertKeys(b, v6, IPv6PrefixFromNetip), values)
+	})
+}
+
+// BenchmarkFixedKeyMapTrieLookup1M compares lookups and memory of MapTrie
+// with 1M prefixes for netip and fixed width keys. Queries are converted
+// before the benchmark loop.
+func BenchmarkFixedKeyMapTrieLookup1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	v4, v4Addrs := randomIPv4Prefixes(1000_000), randomIPv4Addrs(1000)
+	b.Run("ipv4_1M_prefixes/netip", func(b *testing.B) {
+		benchmarkMapTrieLookup(b, v4, values, v4Addrs)
+	})
+	b.Run("ipv4_1M_prefixes/fixed", func(b *testing.B) {
+		benchmarkMapTrieLookup(b, convertKeys(b, v4, IPv4PrefixFromNetip), values, convertQueries(v4Addrs, IPv4AddrFromNetip))
+	})
+
+	v6, v6Addrs := randomIPv6Prefixes(1000_000), randomIPv6Addrs(1000)
+	b.Run("ipv6_1M_prefixes/netip", func(b *testing.B) {
+		benchmarkMapTrieLookup(b, v6, values, v6Addrs)
+	})
+	b.Run("ipv6_1M_prefixes/fixed", func(b *testing.B) {
+		benchmarkMapTrieLookup(b, convertKeys(b, v6, IPv6PrefixFromNetip), values, convertQueries(v6Addrs, IPv6AddrFromNetip))
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+// IPv4Prefix is a compact MapTrie key for IPv4 prefixes.
+//
+// Unlike netip.Prefix it carries neither a zone nor an address family, so
+// it is 8 bytes and hashes as plain memory. The length is as wide as the
+// address to leave no padding, which would need field-wise hashing.
+type IPv4Prefix struct {
+	addr uint32
+	bits uint32
+}
+
+// IPv4PrefixFrom returns the IPv4Prefix of an address in host byte order
+// and a prefix length.
+func IPv4PrefixFrom(addr uint32, bits int) (IPv4Prefix, error) {
+	if bits < 0 || bits > 32 {
+		return IPv4Prefix{}, fmt.Errorf("prefix length %d out of range for IPv4", bits)
+	}
+	return IPv4Prefix{addr: addr, bits: uint32(bits)}, nil
+}
+
+// IPv4PrefixFromNetip converts an IPv4 netip.Prefix.
+func IPv4PrefixFromNetip(prefix netip.Prefix) (IPv4Prefix, error) {
+	if !prefix.IsValid() || !prefix.Addr().Is4() {
+		return IPv4Prefix{}, fmt.Errorf("%s is not an IPv4 prefix", prefix)
+	}
+	return IPv4PrefixFrom(uint32(IPv4AddrFromNetip(prefix.Addr())), prefix.Bits())
+}
+
+// Masked returns the prefix with the host bits cleared.
+func (p IPv4Prefix) Masked() IPv4Prefix {
+	p.addr &= ipv4Mask(int(p.bits))
+	return p
+}
+
+// Bits returns the prefix length.
+func (p IPv4Prefix) Bits() int {
+	return int(p.bits)
+}
+
+// Netip converts the prefix back to a netip.Prefix.
+func (p IPv4Prefix) Netip() netip.Prefix {
+	return netip.PrefixFrom(IPv4Addr(p.addr).Netip(), int(p.bits))
+}
+
+// String returns the CIDR notation of the prefix.
+func (p IPv4Prefix) String() string {
+	return p.Netip().String()
+}
+
+// ipv4Mask returns the network mask of a prefix length.
+func ipv4Mask(bits int) uint32 {
+	// Shifting by 32 yields zero, which is the /0 mask.
+	return ^uint32(0) << (32 - bits)
+}
+
+// IPv4Addr is a compact MapTrie query for IPv4 addresses in host byte
+// order.
+type IPv4Addr uint32
+
+// IPv4AddrFromNetip converts an IPv4 netip.Addr. The result is undefined
+// for other addresses.
+func IPv4AddrFromNetip(addr netip.Addr) IPv4Addr {
+	a := addr.As4()
+	return IPv4Addr(binary.BigEndian.Uint32(a[:]))
+}
+
+// BitLen returns 32.
+func (a IPv4Addr) BitLen() int {
+	return 32
+}
+
+// Prefix returns the prefix of the given length containing the address.
+func (a IPv4Addr) Prefix(bits int) (IPv4Prefix, error) {
+	if bits < 0 || bits > 32 {
+		return IPv4Prefix{}, fmt.Errorf("prefix length %d out of range for IPv4", bits)
+	}
+	return IPv4Prefix{addr: uint32(a) & ipv4Mask(bits), bits: uint32(bits)}, nil
+}
+
+// Netip converts the address back to a netip.Addr.
+func (a IPv4Addr) Netip() netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(a))
+	return netip.AddrFrom4(b)
+}
+
+// IPv6Prefix is a compact MapTrie key for IPv6 prefixes.
+//
+// The address is stored as two 64-bit words, most significant first. The
+// key is 24 bytes against 32 for netip.Prefix and has no zone pointer. As
+// in IPv4Prefix the length fills the last word to leave no padding.
+type IPv6Prefix struct {
+	addr [2]uint64
+	bits uint64
+}
+
+// IPv6PrefixFrom returns the IPv6Prefix of an address and a prefix
+// length.
+func IPv6PrefixFrom(addr [2]uint64, bits int) (IPv6Prefix, error) {
+	if bits < 0 || bits > 128 {
+		return IPv6Prefix{}, fmt.Errorf("prefix length %d out of range for IPv6", bits)
+	}
+	return IPv6Prefix{addr: addr, bits: uint64(bits)}, nil
+}
+
+// IPv6PrefixFromNetip converts an IPv6 netip.Prefix. IPv4-mapped
+// prefixes are kept in their IPv6 form.
+func IPv6PrefixFromNetip(prefix netip.Prefix) (IPv6Prefix, error) {
+	if !prefix.IsValid() || !prefix.Addr().Is6() {
+		return IPv6Prefix{}, fmt.Errorf("%s is not an IPv6 prefix", prefix)
+	}
+	return IPv6PrefixFrom(IPv6AddrFromNetip(prefix.Addr()), prefix.Bits())
+}
+
+// Masked returns the prefix with the host bits cleared.
+func (p IPv6Prefix) Masked() IPv6Prefix {
+	p.addr = ipv6Masked(p.addr, int(p.bits))
+	return p
+}
+
+// Bits returns the prefix length.
+func (p IPv6Prefix) Bits() int {
+	return int(p.bits)
+}
+
+// Netip converts the prefix back to a netip.Prefix.
+func (p IPv6Prefix) Netip() netip.Prefix {
+	return netip.PrefixFrom(IPv6Addr(p.addr).Netip(), int(p.bits))
+}
+
+// String returns the CIDR notation of the prefix.
+func (p IPv6Prefix) String() string {
+	return p.Netip().String()
+}
+
+// ipv6Masked clears all but the first bits of the address.
+func ipv6Masked(addr [2]uint64, bits int) [2]uint64 {
+	if bits <= 64 {
+		return [2]uint64{addr[0] & (^uint64(0) << (64 - bits)), 0}
+	}
+	return [2]uint64{addr[0], addr[1] & (^uint64(0) << (128 - bits))}
+}
+
+// IPv6Addr is a compact MapTrie query for IPv6 addresses.
+type IPv6Addr [2]uint64
+
+// IPv6AddrFromNetip converts a netip.Addr. IPv4 addresses are converted
+// to their IPv4-mapped form.
+func IPv6AddrFromNetip(addr netip.Addr) IPv6Addr {
+	a := addr.As16()
+	return IPv6Addr{binary.BigEndian.Uint64(a[:8]), binary.BigEndian.Uint64(a[8:])}
+}
+
+// BitLen returns 128.
+func (a IPv6Addr) BitLen() int {
+	return 128
+}
+
+// Prefix returns the prefix of the given length containing the address.
+func (a IPv6Addr) Prefix(bits int) (IPv6Prefix, error) {
+	if bits < 0 || bits > 128 {
+		return IPv6Prefix{}, fmt.Errorf("prefix length %d out of range for IPv6", bits)
+	}
+	return IPv6Prefix{addr: ipv6Masked(a, bits), bits: uint64(bits)}, nil
+}
+
+// Netip converts the address back to a netip.Addr.
+func (a IPv6Addr) Netip() netip.Addr {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], a[0])
+	binary.BigEndian.PutUint64(b[8:], a[1])
+	return netip.AddrFrom16(b)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFixedKeyConversions tests round trips between netip and the fixed
+// width keys
+func TestFixedKeyConversions(t *testing.T) {
+	for _, cidr := range []string{"0.0.0.0/0", "10.1.2.0/24", "255.255.255.255/32"} {
+		prefix := netip.MustParsePrefix(cidr)
+		key, err := IPv4PrefixFromNetip(prefix)
+		require.NoError(t, err)
+		assert.Equal(t, prefix, key.Netip())
+		assert.Equal(t, cidr, key.String())
+		assert.Equal(t, prefix.Addr(), IPv4AddrFromNetip(prefix.Addr()).Netip())
+	}
+
+	for _, cidr := range []string{"::/0", "2001:db8::/32", "2001:db8::1:0/112", "ffff::1/128"} {
+		prefix := netip.MustParsePrefix(cidr)
+		key, err := IPv6PrefixFromNetip(prefix)
+		require.NoError(t, err)
+		assert.Equal(t, prefix, key.Netip())
+		assert.Equal(t, cidr, key.String())
+		assert.Equal(t, prefix.Addr(), IPv6AddrFromNetip(prefix.Addr()).Netip())
+	}
+
+	_, err := IPv4PrefixFromNetip(netip.MustParsePrefix("2001:db8::/32"))
+	assert.ErrorContains(t, err, "not an IPv4 prefix")
+	_, err = IPv6PrefixFromNetip(netip.MustParsePrefix("10.0.0.0/8"))
+	assert.ErrorContains(t, err, "not an IPv6 prefix")
+	_, err = IPv4PrefixFromNetip(netip.Prefix{})
+	assert.Error(t, err)
+
+	assert.Equal(t, uintptr(8), unsafe.Sizeof(IPv4Prefix{}))
+	assert.Equal(t, uintptr(24), unsafe.Sizeof(IPv6Prefix{}))
+}
+
+// TestFixedKeyMasking tests that Masked and Prefix agree with netip
+func TestFixedKeyMasking(t *testing.T) {
+	v4 := netip.MustParseAddr("192.168.171.205")
+	v6 := netip.MustParseAddr("2001:db8:dead:beef:cafe:babe:f00d:1234")
+
+	for bits := 0; bits <= 128; bits++ {
+		if bits <= 32 {
+			want := netip.PrefixFrom(v4, bits).Masked()
+			got, err := IPv4AddrFromNetip(v4).Prefix(bits)
+			require.NoError(t, err)
+			assert.Equal(t, want, got.Netip(), "/%d", bits)
+			prefix, err := IPv4PrefixFrom(uint32(IPv4AddrFromNetip(v4)), bits)
+			require.NoError(t, err)
+			assert.Equal(t, got, prefix.Masked(), "/%d", bits)
+		}
+
+		want := netip.PrefixFrom(v6, bits).Masked()
+		got, err := IPv6AddrFromNetip(v6).Prefix(bits)
+		require.NoError(t, err)
+		assert.Equal(t, want, got.Netip(), "/%d", bits)
+		prefix, err := IPv6PrefixFrom(IPv6AddrFromNetip(v6), bits)
+		require.NoError(t, err)
+		assert.Equal(t, got, prefix.Masked(), "/%d", bits)
+	}
+
+	_, err := IPv4AddrFromNetip(v4).Prefix(33)
+	assert.ErrorContains(t, err, "out of range")
+	_, err = IPv6AddrFromNetip(v6).Prefix(-1)
+	assert.ErrorContains(t, err, "out of range")
+	_, err = IPv4PrefixFrom(0, 33)
+	assert.ErrorContains(t, err, "out of range")
+	_, err = IPv4PrefixFrom(0, -1)
+	assert.ErrorContains(t, err, "out of range")
+	_, err = IPv6PrefixFrom([2]uint64{}, 129)
+	assert.ErrorContains(t, err, "out of range")
+}
+
+// TestFixedKeyMapTrieMatchesNetip compares MapTrie instantiated with the
+// fixed width keys against the netip instantiation
+func TestFixedKeyMapTrieMatchesNetip(t *testing.T) {
+	prefixes := referencePrefixes(5000)
+	addrs := referenceAddrs(prefixes, 5000)
+	values := datacenterValues(len(prefixes))
+
+	reference := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	v4 := NewMapTrie[IPv4Prefix, IPv4Addr, string](0)
+	v6 := NewMapTrie[IPv6Prefix, IPv6Addr, string](0)
+	for idx, prefix := range prefixes {
+		reference.InsertOrUpdate(prefix, onEmptyString(values[idx]), onUpdateString(values[idx]))
+		if prefix.Addr().Is4() {
+			key, err := IPv4PrefixFromNetip(prefix)
+			require.NoError(t, err)
+			v4.InsertOrUpdate(key, onEmptyString(values[idx]), onUpdateString(values[idx]))
+		} else {
+			key, err := IPv6PrefixFromNetip(prefix)
+			require.NoError(t, err)
+			v6.InsertOrUpdate(key, onEmptyString(values[idx]), onUpdateString(values[idx]))
+		}
+	}
+	require.Equal(t, reference.Len(), v4.Len()+v6.Len())
+
+	for _, addr := range addrs {
+		wantPrefix, want, wantOk := reference.Lookup(addr)
+
+		var gotPrefix netip.Prefix
+		var got string
+		var ok bool
+		if addr.Is4() {
+			var key IPv4Prefix
+			key, got, ok = v4.Lookup(IPv4AddrFromNetip(addr))
+			gotPrefix = key.Netip()
+		} else {
+			var key IPv6Prefix
+			key, got, ok = v6.Lookup(IPv6AddrFromNetip(addr))
+			gotPrefix = key.Netip()
+		}
+
+		require.Equal(t, wantOk, ok, "Lookup(%s)", addr)
+		if ok {
+			require.Equal(t, wantPrefix, gotPrefix, "Lookup(%s)", addr)
+			require.Equal(t, want, got, "Lookup(%s)", addr)
+		}
+	}
+}
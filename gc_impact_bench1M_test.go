@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/sakateka/lpm"
+)
+
+// stringTableImplementations returns lpm and the implementations of
+// valueTypeImplementations with string values.
+func stringTableImplementations() []tableImplementation[string] {
+	return slices.Insert(valueTypeImplementations[string](), 0, tableImplementation[string]{
+		name: "lpm",
+		load: func(prefixes []netip.Prefix, values []string) (func(netip.Addr) bool, error) {
+			table := lpm.New()
+			for i, prefix := range prefixes {
+				table.Insert(prefix, values[i])
+			}
+			return func(addr netip.Addr) bool {
+				_, ok := table.Lookup(addr)
+				return ok
+			}, nil
+		},
+	})
+}
+
+// BenchmarkGCImpact1M benchmarks forced GC cycles with 1M prefixes loaded
+// into every implementation, with string values as in the other
+// benchmarks. ns/op is the wall time of one cycle.
+//
+// The metrics come from runtime/metrics: mark-cpu-ns is the mark CPU time
+// per cycle, gc-pause-p50-ns and gc-pause-max-ns are the stop-the-world
+// pauses, gc-cpu-fraction is the share of the available CPU time used by
+// the GC during the cycles and load-gc-cpu-fraction during the load.
+// gc-scan-bytes is the growth of the heap the collector has to scan.
+func BenchmarkGCImpact1M(b *testing.B) {
+	datasets := []struct {
+		name     string
+		ipv4     bool
+		prefixes []netip.Prefix
+	}{
+		{"ipv4_1M_prefixes", true, randomIPv4Prefixes(1000_000)},
+		{"ipv6_1M_prefixes", false, randomIPv6Prefixes(1000_000)},
+	}
+
+	for _, ds := range datasets {
+		for _, impl := range stringTableImplementations() {
+			if impl.ipv4Only && !ds.ipv4 {
+				continue
+			}
+			b.Run(ds.name+"/"+impl.name, func(b *testing.B) {
+				// Measure memory before insertion
+				runtime.GC()
+				var memBefore runtime.MemStats
+				runtime.ReadMemStats(&memBefore)
+				loadBefore := ReadGCSample()
+
+				lookup, err := func() (func(netip.Addr) bool, error) {
+					values := make([]string, len(ds.prefixes))
+					for i := range values {
+						values[i] = fmt.Sprintf("DC%d", i)
+					}
+					return impl.load(ds.prefixes, values)
+				}()
+				if err != nil {
+					b.Fatalf("load: %v", err)
+				}
+
+				// Measure memory after insertion
+				runtime.GC()
+				var memAfter runtime.MemStats
+				runtime.ReadMemStats(&memAfter)
+				load := ReadGCSample().Since(loadBefore)
+
+				allocDiff := memAfter.Alloc - memBefore.Alloc
+				b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB), scannable: %d bytes, load GC cycles: %d, load GC CPU: %v (%.1f%%)",
+					len(ds.prefixes), allocDiff, float64(allocDiff)/(1024*1024), load.ScanHeap, load.Cycles, load.GCCPU, 100*load.CPUFraction())
+
+				b.ResetTimer()
+				b.ReportAllocs()
+				captureProfiles(b)
+
+				before := ReadGCSample()
+				for b.Loop() {
+					runtime.GC()
+				}
+				impact := ReadGCSample().Since(before)
+				runtime.KeepAlive(lookup)
+
+				b.Logf("GC cycles: %d, mark CPU per cycle: %v, pauses: %d, p50 pause: %v, max pause: %v, GC CPU: %.1f%%",
+					impact.Cycles, impact.MarkCPUPerCycle(), impact.Pauses(), impact.PauseQuantile(0.5), impact.MaxPause(),
+					100*impact.CPUFraction())
+
+				b.ReportMetric(float64(allocDiff), "heap-bytes")
+				b.ReportMetric(float64(load.ScanHeap), "gc-scan-bytes")
+				b.ReportMetric(float64(impact.MarkCPUPerCycle().Nanoseconds()), "mark-cpu-ns")
+				b.ReportMetric(float64(impact.PauseQuantile(0.5).Nanoseconds()), "gc-pause-p50-ns")
+				b.ReportMetric(float64(impact.MaxPause().Nanoseconds()), "gc-pause-max-ns")
+				b.ReportMetric(impact.CPUFraction(), "gc-cpu-fraction")
+				b.ReportMetric(load.CPUFraction(), "load-gc-cpu-fraction")
+			})
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+// gcMetricNames are the runtime/metrics samples read by ReadGCSample, in
+// the order of the fields of GCSample.
+var gcMetricNames = []string{
+	"/gc/cycles/total:gc-cycles",
+	"/cpu/classes/gc/mark/assist:cpu-seconds",
+	"/cpu/classes/gc/mark/dedicated:cpu-seconds",
+	"/cpu/classes/gc/mark/idle:cpu-seconds",
+	"/cpu/classes/gc/pause:cpu-seconds",
+	"/cpu/classes/gc/total:cpu-seconds",
+	"/cpu/classes/total:cpu-seconds",
+	"/gc/scan/heap:bytes",
+	"/sched/pauses/total/gc:seconds",
+}
+
+// GCSample is a snapshot of the cumulative GC metrics of the runtime.
+//
+// The CPU metrics are estimates the runtime updates when a GC cycle ends,
+// so samples are only comparable when taken right after a collection.
+type GCSample struct {
+	Cycles   uint64
+	MarkCPU  float64 // CPU seconds of mark assists and mark workers
+	PauseCPU float64 // CPU seconds of stop-the-world GC pauses
+	GCCPU    float64 // CPU seconds of all GC work
+	TotalCPU float64 // CPU seconds available, GOMAXPROCS times the wall time
+	ScanHeap uint64  // Scannable heap bytes of the last cycle
+	Pauses   *metrics.Float64Histogram
+}
+
+// ReadGCSample reads the current GC metrics.
+func ReadGCSample() GCSample {
+	samples := make([]metrics.Sample, len(gcMetricNames))
+	for i, name := range gcMetricNames {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	return GCSample{
+		Cycles:   samples[0].Value.Uint64(),
+		MarkCPU:  samples[1].Value.Float64() + samples[2].Value.Float64() + samples[3].Value.Float64(),
+		PauseCPU: samples[4].Value.Float64(),
+		GCCPU:    samples[5].Value.Float64(),
+		TotalCPU: samples[6].Value.Float64(),
+		ScanHeap: samples[7].Value.Uint64(),
+		Pauses:   samples[8].Value.Float64Histogram(),
+	}
+}
+
+// GCImpact is the GC work done between two samples.
+type GCImpact struct {
+	Cycles   uint64
+	MarkCPU  time.Duration
+	PauseCPU time.Duration
+	GCCPU    time.Duration
+	TotalCPU time.Duration
+	ScanHeap int64 // Change of the scannable heap bytes
+	// PauseCounts are the stop-the-world pauses between the samples per
+	// bucket of PauseBuckets, in seconds, as in metrics.Float64Histogram.
+	PauseCounts  []uint64
+	PauseBuckets []float64
+}
+
+// Since returns the GC work done since the earlier sample.
+func (s GCSample) Since(before GCSample) GCImpact {
+	counts := make([]uint64, len(s.Pauses.Counts))
+	for i, count := range s.Pauses.Counts {
+		counts[i] = count - before.Pauses.Counts[i]
+	}
+
+	return GCImpact{
+		Cycles:       s.Cycles - before.Cycles,
+		MarkCPU:      secondsDuration(s.MarkCPU - before.MarkCPU),
+		PauseCPU:     secondsDuration(s.PauseCPU - before.PauseCPU),
+		GCCPU:        secondsDuration(s.GCCPU - before.GCCPU),
+		TotalCPU:     secondsDuration(s.TotalCPU - before.TotalCPU),
+		ScanHeap:     int64(s.ScanHeap) - int64(before.ScanHeap),
+		PauseCounts:  counts,
+		PauseBuckets: s.Pauses.Buckets,
+	}
+}
+
+// CPUFraction returns the share of the available CPU time used by the GC.
+func (g GCImpact) CPUFraction() float64 {
+	if g.TotalCPU <= 0 {
+		return 0
+	}
+	return float64(g.GCCPU) / float64(g.TotalCPU)
+}
+
+// MarkCPUPerCycle returns the mark CPU time of an average cycle.
+func (g GCImpact) MarkCPUPerCycle() time.Duration {
+	if g.Cycles == 0 {
+		return 0
+	}
+	return g.MarkCPU / time.Duration(g.Cycles)
+}
+
+// Pauses returns the number of stop-the-world pauses. A cycle has two.
+func (g GCImpact) Pauses() uint64 {
+	var total uint64
+	for _, count := range g.PauseCounts {
+		total += count
+	}
+	return total
+}
+
+// PauseQuantile returns the upper bound of the bucket holding the q-th
+// quantile of the pauses, or the lower bound for the last, unbounded
+// bucket. It returns 0 without pauses.
+func (g GCImpact) PauseQuantile(q float64) time.Duration {
+	total := g.Pauses()
+	if total == 0 {
+		return 0
+	}
+
+	rank := max(uint64(math.Ceil(q*float64(total))), 1)
+	var seen uint64
+	for i, count := range g.PauseCounts {
+		if seen += count; seen >= rank {
+			if upper := g.PauseBuckets[i+1]; !math.IsInf(upper, 1) {
+				return secondsDuration(upper)
+			}
+			return secondsDuration(g.PauseBuckets[i])
+		}
+	}
+	return 0
+}
+
+// MaxPause returns the upper bound of the bucket of the longest pause.
+func (g GCImpact) MaxPause() time.Duration {
+	return g.PauseQuantile(1)
+}
+
+// secondsDuration converts seconds as reported by runtime/metrics to a
+// duration.
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"net/netip"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGCSampleSince tests that forced collections of a loaded table show
+// up as cycles, pauses and mark CPU time
+func TestGCSampleSince(t *testing.T) {
+	runtime.GC()
+	before := ReadGCSample()
+
+	prefixes := referencePrefixes(10_000)
+	values := datacenterValues(len(prefixes))
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for i, prefix := range prefixes {
+		trie.InsertOrUpdate(prefix, onEmptyString(values[i]), onUpdateString(values[i]))
+	}
+	runtime.GC()
+	runtime.GC()
+	impact := ReadGCSample().Since(before)
+	runtime.KeepAlive(trie)
+
+	assert.GreaterOrEqual(t, impact.Cycles, uint64(2))
+	assert.GreaterOrEqual(t, impact.Pauses(), impact.Cycles)
+	assert.Positive(t, impact.MarkCPU)
+	assert.Positive(t, impact.ScanHeap)
+	assert.LessOrEqual(t, impact.MarkCPU, impact.GCCPU)
+	assert.LessOrEqual(t, impact.PauseCPU, impact.GCCPU)
+	assert.Greater(t, impact.CPUFraction(), 0.0)
+	assert.LessOrEqual(t, impact.CPUFraction(), 1.0)
+	assert.Positive(t, impact.MaxPause())
+	assert.LessOrEqual(t, impact.PauseQuantile(0.5), impact.MaxPause())
+}
+
+// TestGCImpactPauseQuantile tests quantiles of a pause histogram
+func TestGCImpactPauseQuantile(t *testing.T) {
+	impact := GCImpact{
+		Cycles:       2,
+		MarkCPU:      3 * time.Millisecond,
+		PauseCounts:  []uint64{1, 0, 2, 1},
+		PauseBuckets: []float64{math.Inf(-1), 0.001, 0.002, 0.004, math.Inf(1)},
+	}
+	require.Equal(t, uint64(4), impact.Pauses())
+	assert.Equal(t, time.Millisecond, impact.PauseQuantile(0))
+	assert.Equal(t, time.Millisecond, impact.PauseQuantile(0.25))
+	assert.Equal(t, 4*time.Millisecond, impact.PauseQuantile(0.5))
+	assert.Equal(t, 4*time.Millisecond, impact.PauseQuantile(0.75))
+	assert.Equal(t, 4*time.Millisecond, impact.MaxPause(), "the unbounded bucket reports its lower bound")
+	assert.Equal(t, 1500*time.Microsecond, impact.MarkCPUPerCycle())
+
+	assert.Zero(t, GCImpact{PauseCounts: []uint64{0}}.PauseQuantile(0.5))
+	assert.Zero(t, GCImpact{}.MarkCPUPerCycle())
+	assert.Zero(t, GCImpact{}.CPUFraction())
+}
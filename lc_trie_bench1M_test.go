@@ -0,0 +1,137 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+// lcTrieBenchConfigs lists the resize thresholds measured by the LC-trie
+// benchmarks.
+var lcTrieBenchConfigs = []struct {
+	name string
+	cfg  LCTrieConfig
+}{
+	{"fib_trie", DefaultLCTrieConfig()},
+	{"wide", LCTrieConfig{InflateThreshold: 25, HalveThreshold: 10, RootInflateThreshold: 15, RootHalveThreshold: 5}},
+}
+
+// reportLCTrieStats logs the LC-trie shape and reports it as benchmark
+// metrics.
+func reportLCTrieStats[V any](b *testing.B, trie *LCTrie[V]) {
+	stats := trie.Stats()
+	b.Logf("lctrie.prefixes: %d, lctrie.leaves: %d, lctrie.internalNodes: %d, lctrie.nullPointers: %d",
+		stats.Prefixes, stats.Leaves, stats.InternalNodes, stats.NullPointers)
+	b.Logf("lctrie.maxDepth: %d, lctrie.avgDepth: %.2f, lctrie.rootBits: %d",
+		stats.MaxDepth, stats.AvgDepth, trie.root.bits)
+
+	b.ReportMetric(float64(stats.InternalNodes), "internal-nodes")
+	b.ReportMetric(float64(stats.Leaves), "leaves")
+	b.ReportMetric(float64(stats.MaxDepth), "max-depth")
+	b.ReportMetric(stats.AvgDepth, "avg-depth")
+}
+
+// BenchmarkLCTrieInsert1M benchmarks insertion of 1M prefixes
+func BenchmarkLCTrieInsert1M(b *testing.B) {
+	prefixes := randomIPv4Prefixes(1000_000)
+	values := datacenterValues(1000_000)
+
+	for _, bc := range lcTrieBenchConfigs {
+		b.Run("ipv4_1M_prefixes_"+bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			trie := NewLCTrie[string](bc.cfg)
+			idx := 0
+
+			for b.Loop() {
+				trie.InsertOrUpdate(prefixes[idx], onEmptyString(values[idx]), onUpdateString(values[idx]))
+				idx = (idx + 1) % 1000_000
+			}
+
+			reportLCTrieStats(b, trie)
+		})
+	}
+}
+
+// BenchmarkLCTrieDelete1M benchmarks deletion and reinsertion of prefixes
+// in an LC-trie holding 1M prefixes, so that every iteration triggers
+// halving and inflation on the way to the root
+func BenchmarkLCTrieDelete1M(b *testing.B) {
+	prefixes := randomIPv4Prefixes(1000_000)
+	values := datacenterValues(1000_000)
+	deleted := func(string) (string, bool) { return "", true }
+
+	for _, bc := range lcTrieBenchConfigs {
+		b.Run("ipv4_1M_prefixes_"+bc.name, func(b *testing.B) {
+			trie := NewLCTrie[string](bc.cfg)
+			for i := range 1000_000 {
+				trie.InsertOrUpdate(prefixes[i], onEmptyString(values[i]), onUpdateString(values[i]))
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			for b.Loop() {
+				trie.UpdateOrDelete(prefixes[idx], deleted)
+				trie.InsertOrUpdate(prefixes[idx], onEmptyString(values[idx]), onUpdateString(values[idx]))
+				idx = (idx + 1) % 1000_000
+			}
+		})
+	}
+}
+
+// BenchmarkLCTrieLookup1M benchmarks lookups in an LC-trie with 1M
+// prefixes
+func BenchmarkLCTrieLookup1M(b *testing.B) {
+	prefixes := randomIPv4Prefixes(1000_000)
+	values := datacenterValues(1000_000)
+	addrs := randomIPv4Addrs(1000)
+
+	for _, bc := range lcTrieBenchConfigs {
+		b.Run("ipv4_1M_prefixes_"+bc.name, func(b *testing.B) {
+			// Measure memory before insertion
+			runtime.GC()
+			var memBefore runtime.MemStats
+			runtime.ReadMemStats(&memBefore)
+
+			// Setup: Insert 1M prefixes
+			trie := NewLCTrie[string](bc.cfg)
+			for i := range 1000_000 {
+				trie.InsertOrUpdate(prefixes[i], onEmptyString(values[i]), onUpdateString(values[i]))
+			}
+
+			// Measure memory after insertion
+			runtime.GC()
+			var memAfter runtime.MemStats
+			runtime.ReadMemStats(&memAfter)
+
+			allocDiff := memAfter.Alloc - memBefore.Alloc
+			totalAllocDiff := memAfter.TotalAlloc - memBefore.TotalAlloc
+
+			b.Logf("Memory usage after 1M inserts: Alloc=%d bytes (%.2f MB), TotalAlloc=%d bytes (%.2f MB)",
+				allocDiff, float64(allocDiff)/(1024*1024),
+				totalAllocDiff, float64(totalAllocDiff)/(1024*1024))
+			reportLCTrieStats(b, trie)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			foundCount := 0
+			for b.Loop() {
+				_, val, ok := trie.Lookup(addrs[idx])
+				if ok && val != "" {
+					foundCount++
+				}
+				idx = (idx + 1) % len(addrs)
+			}
+
+			if foundCount == 0 {
+				b.Fatalf("No successful lookups in %d iterations", b.N)
+			}
+		})
+	}
+}
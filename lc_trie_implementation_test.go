@@ -0,0 +1,541 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net/netip"
+	"slices"
+)
+
+// LCTrieConfig controls when LC-trie nodes are inflated (doubled) or
+// halved during updates.
+//
+// The thresholds are percentages with the same meaning as in the Linux
+// fib_trie implementation: a node is inflated when its non-empty children,
+// counting full children twice, occupy at least InflateThreshold percent
+// of the doubled node, and halved when its non-empty children occupy less
+// than HalveThreshold percent of the node. The root node uses its own,
+// usually lower, thresholds to keep it wide.
+type LCTrieConfig struct {
+	InflateThreshold     int
+	HalveThreshold       int
+	RootInflateThreshold int
+	RootHalveThreshold   int
+}
+
+// DefaultLCTrieConfig returns the thresholds used by the Linux fib_trie.
+func DefaultLCTrieConfig() LCTrieConfig {
+	return LCTrieConfig{
+		InflateThreshold:     50,
+		HalveThreshold:       25,
+		RootInflateThreshold: 30,
+		RootHalveThreshold:   15,
+	}
+}
+
+// lcMaxResizeWork bounds the number of inflate or halve steps done for a
+// single node during one resize, as MAX_WORK does in fib_trie.
+const lcMaxResizeWork = 10
+
+// lcNode is either an internal node (bits > 0) or a leaf (bits == 0) of
+// the LC-trie.
+type lcNode[V any] struct {
+	// key holds the significant bits of the node. For internal nodes all
+	// bits below pos+bits are zero, for leaves it is the network address
+	// shared by all leaf prefixes.
+	key uint32
+	// pos is the position of the lowest bit of the child index.
+	pos uint8
+	// bits is the number of key bits used as the child index.
+	bits uint8
+	// emptyChildren is the number of nil children of an internal node.
+	emptyChildren int
+	// fullChildren is the number of internal children that have no
+	// skipped bits between them and this node.
+	fullChildren int
+	children     []*lcNode[V]
+	// prefixes holds the leaf prefixes sorted from the longest to the
+	// shortest one.
+	prefixes []lcPrefix[V]
+}
+
+// lcPrefix is a prefix stored in an LC-trie leaf.
+type lcPrefix[V any] struct {
+	bits  uint8
+	value V
+}
+
+// LCTrie is an IPv4 level-compressed trie modelled after the Linux FIB
+// trie (fib_trie).
+//
+// Internal nodes skip the bits shared by all of their descendants (path
+// compression) and index 2^bits children at once (level compression).
+// Prefixes that share a network address are kept together in one leaf.
+// Nodes are inflated and halved on every update according to the
+// configured thresholds, so the trie stays balanced under incremental
+// inserts and deletes.
+//
+// The type parameter V represents the value type stored for each prefix.
+type LCTrie[V any] struct {
+	root *lcNode[V]
+	cfg  LCTrieConfig
+	size int
+}
+
+// LCTrieStats describes the shape of an LC-trie.
+type LCTrieStats struct {
+	// Prefixes is the number of stored prefixes.
+	Prefixes int
+	// Leaves is the number of leaves.
+	Leaves int
+	// InternalNodes is the number of internal nodes.
+	InternalNodes int
+	// NullPointers is the number of empty child slots.
+	NullPointers int
+	// MaxDepth is the depth of the deepest leaf, the root has depth zero.
+	MaxDepth int
+	// AvgDepth is the average depth of leaves.
+	AvgDepth float64
+	// NodeSizes counts internal nodes by the number of index bits.
+	NodeSizes [33]int
+}
+
+// NewLCTrie returns an empty LC-trie using the given thresholds.
+func NewLCTrie[V any](cfg LCTrieConfig) *LCTrie[V] {
+	return &LCTrie[V]{cfg: cfg}
+}
+
+// lcKey returns the prefix network address as an integer.
+func lcKey(addr netip.Addr) uint32 {
+	a := addr.As4()
+	return binary.BigEndian.Uint32(a[:])
+}
+
+// lcMask returns the key with only the given number of upper bits kept.
+func lcMask(key uint32, bits int) uint32 {
+	if bits == 0 {
+		return 0
+	}
+	return key &^ (1<<(32-bits) - 1)
+}
+
+// isLeaf reports whether the node is a leaf.
+func (n *lcNode[V]) isLeaf() bool {
+	return n.bits == 0
+}
+
+// index returns the child index for the key, which may overflow the
+// children array if the key differs from the node key above pos+bits.
+func (n *lcNode[V]) index(key uint32) uint64 {
+	return uint64(key^n.key) >> n.pos
+}
+
+// isFull reports whether the child is an internal node with no skipped
+// bits between it and the node.
+func (n *lcNode[V]) isFull(child *lcNode[V]) bool {
+	return child != nil && !child.isLeaf() && int(child.pos)+int(child.bits) == int(n.pos)
+}
+
+// newLCInternal returns an internal node with empty children.
+func newLCInternal[V any](key uint32, pos, nbits int) *lcNode[V] {
+	shift := pos + nbits
+	if shift >= 32 {
+		key = 0
+	} else {
+		key = key >> shift << shift
+	}
+
+	return &lcNode[V]{
+		key:           key,
+		pos:           uint8(pos),
+		bits:          uint8(nbits),
+		emptyChildren: 1 << nbits,
+		children:      make([]*lcNode[V], 1<<nbits),
+	}
+}
+
+// setChild replaces a child keeping the empty and full children counters
+// up to date.
+func (n *lcNode[V]) setChild(idx uint64, child *lcNode[V]) {
+	old := n.children[idx]
+
+	if old == nil && child != nil {
+		n.emptyChildren--
+	} else if old != nil && child == nil {
+		n.emptyChildren++
+	}
+
+	if n.isFull(old) {
+		n.fullChildren--
+	}
+	if n.isFull(child) {
+		n.fullChildren++
+	}
+
+	n.children[idx] = child
+}
+
+// Lookup searches the LC-trie for a value that matches the longest
+// possible prefix for the given address.
+//
+// If no match is found, the function returns an invalid prefix, the zero
+// value and false.
+func (t *LCTrie[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	if t.root != nil && addr.Is4() {
+		if leaf, p := lcLookup(t.root, lcKey(addr)); leaf != nil {
+			return netip.PrefixFrom(addr, int(p.bits)).Masked(), p.value, true
+		}
+	}
+
+	var zero V
+	return netip.Prefix{}, zero, false
+}
+
+// lcLookup returns the leaf and the longest of its prefixes covering the
+// key in the subtree rooted at n.
+func lcLookup[V any](n *lcNode[V], key uint32) (*lcNode[V], *lcPrefix[V]) {
+	if n.isLeaf() {
+		for idx := range n.prefixes {
+			p := &n.prefixes[idx]
+			if lcMask(key, int(p.bits)) == n.key {
+				return n, p
+			}
+		}
+		return nil, nil
+	}
+
+	// Bits that are set in the node key must match, while a mismatch in
+	// the trailing zero bits may still be covered by a shorter prefix.
+	if (key^n.key)&(n.key|-n.key) != 0 {
+		return nil, nil
+	}
+
+	cidx := n.index(key)
+	if cidx >= uint64(len(n.children)) {
+		// The key has ones where all node descendants have zeros, so only
+		// prefixes stored under the all-zero child can cover it.
+		cidx = 0
+	}
+
+	// Children reached by clearing the lowest set bits of the index hold
+	// prefixes that are shorter than those in the original child, so the
+	// first match found is the longest one.
+	for {
+		if child := n.children[cidx]; child != nil {
+			if leaf, p := lcLookup(child, key); leaf != nil {
+				return leaf, p
+			}
+		}
+		if cidx == 0 {
+			return nil, nil
+		}
+		cidx &= cidx - 1
+	}
+}
+
+// lcStep is a node visited on the way down to the updated leaf together
+// with the child index that was followed.
+type lcStep[V any] struct {
+	node *lcNode[V]
+	idx  uint64
+}
+
+// InsertOrUpdate adds a new prefix or updates an existing one in the
+// LC-trie.
+//
+// The onEmpty callback provides the value for a new prefix, while
+// onUpdate maps the current value of an existing prefix. Non-IPv4 prefixes
+// are ignored.
+func (t *LCTrie[V]) InsertOrUpdate(prefix netip.Prefix, onEmpty func() V, onUpdate func(V) V) {
+	if !prefix.Addr().Is4() {
+		return
+	}
+
+	prefix = prefix.Masked()
+	key := lcKey(prefix.Addr())
+	plen := uint8(prefix.Bits())
+
+	if t.root == nil {
+		t.root = t.newLeaf(key, plen, onEmpty())
+		return
+	}
+
+	var path []lcStep[V]
+	n := t.root
+	for !n.isLeaf() {
+		cidx := n.index(key)
+		if cidx >= uint64(len(n.children)) {
+			// Mismatch above the node index bits.
+			break
+		}
+
+		child := n.children[cidx]
+		if child == nil {
+			n.setChild(cidx, t.newLeaf(key, plen, onEmpty()))
+			t.rebalance(path, n)
+			return
+		}
+
+		path = append(path, lcStep[V]{n, cidx})
+		n = child
+	}
+
+	if n.isLeaf() && n.key == key {
+		idx, found := slices.BinarySearchFunc(n.prefixes, plen, func(p lcPrefix[V], bits uint8) int {
+			// Prefixes are sorted in descending order.
+			return int(bits) - int(p.bits)
+		})
+		if found {
+			n.prefixes[idx].value = onUpdate(n.prefixes[idx].value)
+			return
+		}
+		n.prefixes = slices.Insert(n.prefixes, idx, lcPrefix[V]{plen, onEmpty()})
+		t.size++
+		return
+	}
+
+	// Split at the highest bit where the keys differ.
+	pos := 31 - bits.LeadingZeros32(key^n.key)
+	tn := newLCInternal[V](key, pos, 1)
+	leaf := t.newLeaf(key, plen, onEmpty())
+	tn.setChild(tn.index(key), leaf)
+	tn.setChild(tn.index(n.key), n)
+
+	if len(path) == 0 {
+		t.root = tn
+		return
+	}
+
+	parent := path[len(path)-1]
+	parent.node.setChild(parent.idx, tn)
+	t.rebalance(path[:len(path)-1], parent.node)
+}
+
+// newLeaf returns a leaf holding a single prefix.
+func (t *LCTrie[V]) newLeaf(key uint32, plen uint8, value V) *lcNode[V] {
+	t.size++
+	return &lcNode[V]{
+		key:      key,
+		prefixes: []lcPrefix[V]{{plen, value}},
+	}
+}
+
+// UpdateOrDelete updates an existing prefix and deletes it from the
+// LC-trie if update indicates that the updated entry becomes empty.
+func (t *LCTrie[V]) UpdateOrDelete(prefix netip.Prefix, update func(V) (V, bool)) {
+	if t.root == nil || !prefix.Addr().Is4() {
+		return
+	}
+
+	prefix = prefix.Masked()
+	key := lcKey(prefix.Addr())
+	plen := uint8(prefix.Bits())
+
+	var path []lcStep[V]
+	n := t.root
+	for !n.isLeaf() {
+		cidx := n.index(key)
+		if cidx >= uint64(len(n.children)) || n.children[cidx] == nil {
+			return
+		}
+		path = append(path, lcStep[V]{n, cidx})
+		n = n.children[cidx]
+	}
+	if n.key != key {
+		return
+	}
+
+	idx := slices.IndexFunc(n.prefixes, func(p lcPrefix[V]) bool { return p.bits == plen })
+	if idx < 0 {
+		return
+	}
+
+	value, zero := update(n.prefixes[idx].value)
+	if !zero {
+		n.prefixes[idx].value = value
+		return
+	}
+
+	n.prefixes = slices.Delete(n.prefixes, idx, idx+1)
+	t.size--
+	if len(n.prefixes) != 0 {
+		return
+	}
+
+	if len(path) == 0 {
+		t.root = nil
+		return
+	}
+
+	parent := path[len(path)-1]
+	parent.node.setChild(parent.idx, nil)
+	t.rebalance(path[:len(path)-1], parent.node)
+}
+
+// rebalance resizes the given node and then every node on the path up to
+// the root, linking each resized node back into its parent.
+func (t *LCTrie[V]) rebalance(path []lcStep[V], n *lcNode[V]) {
+	for i := len(path) - 1; i >= 0; i-- {
+		resized := t.resize(n, false)
+		path[i].node.setChild(path[i].idx, resized)
+		n = path[i].node
+	}
+	t.root = t.resize(n, true)
+}
+
+// resize inflates, halves or collapses the internal node according to
+// the configured thresholds and returns the node that replaces it.
+func (t *LCTrie[V]) resize(n *lcNode[V], isRoot bool) *lcNode[V] {
+	if n == nil || n.isLeaf() {
+		return n
+	}
+
+	inflate, halve := t.cfg.InflateThreshold, t.cfg.HalveThreshold
+	if isRoot {
+		inflate, halve = t.cfg.RootInflateThreshold, t.cfg.RootHalveThreshold
+	}
+
+	for work := 0; work < lcMaxResizeWork && t.shouldInflate(n, inflate); work++ {
+		n = t.inflate(n)
+	}
+	for work := 0; work < lcMaxResizeWork && t.shouldHalve(n, halve); work++ {
+		n = t.halve(n)
+	}
+
+	// Path compression: a node with a single child is replaced by it.
+	switch used := len(n.children) - n.emptyChildren; used {
+	case 0:
+		return nil
+	case 1:
+		for _, child := range n.children {
+			if child != nil {
+				return child
+			}
+		}
+	}
+
+	return n
+}
+
+// shouldInflate reports whether doubling the node keeps at least
+// threshold percent of its children used.
+func (t *LCTrie[V]) shouldInflate(n *lcNode[V], threshold int) bool {
+	size := len(n.children)
+	used := size - n.emptyChildren + n.fullChildren
+	// The doubled node has 2*size children, hence 50 instead of 100.
+	return used > 1 && n.pos > 0 && 50*used >= threshold*size
+}
+
+// shouldHalve reports whether less than threshold percent of the node
+// children are used.
+func (t *LCTrie[V]) shouldHalve(n *lcNode[V], threshold int) bool {
+	size := len(n.children)
+	used := size - n.emptyChildren
+	return used > 1 && n.bits > 1 && 100*used < threshold*size
+}
+
+// inflate doubles the number of node children by moving one more key bit
+// into the child index.
+func (t *LCTrie[V]) inflate(n *lcNode[V]) *lcNode[V] {
+	tn := newLCInternal[V](n.key, int(n.pos)-1, int(n.bits)+1)
+	newBit := int(n.pos) - 1
+
+	for i, child := range n.children {
+		if child == nil {
+			continue
+		}
+		idx := uint64(i) << 1
+
+		if !n.isFull(child) {
+			// The new index bit is fixed for all child descendants.
+			tn.setChild(idx|uint64(child.key>>newBit&1), child)
+			continue
+		}
+
+		if child.bits == 1 {
+			tn.setChild(idx, child.children[0])
+			tn.setChild(idx|1, child.children[1])
+			continue
+		}
+
+		// Split the full child into two halves on its top index bit.
+		half := len(child.children) / 2
+		left := newLCInternal[V](child.key, int(child.pos), int(child.bits)-1)
+		right := newLCInternal[V](child.key|1<<newBit, int(child.pos), int(child.bits)-1)
+		for j := range half {
+			left.setChild(uint64(j), child.children[j])
+			right.setChild(uint64(j), child.children[half+j])
+		}
+
+		tn.setChild(idx, t.resize(left, false))
+		tn.setChild(idx|1, t.resize(right, false))
+	}
+
+	return tn
+}
+
+// halve halves the number of node children by moving the lowest index bit
+// into new binary child nodes.
+func (t *LCTrie[V]) halve(n *lcNode[V]) *lcNode[V] {
+	tn := newLCInternal[V](n.key, int(n.pos)+1, int(n.bits)-1)
+
+	for i := range len(tn.children) {
+		left, right := n.children[2*i], n.children[2*i+1]
+
+		switch {
+		case left == nil && right == nil:
+			continue
+		case right == nil:
+			tn.setChild(uint64(i), left)
+		case left == nil:
+			tn.setChild(uint64(i), right)
+		default:
+			binary := newLCInternal[V](n.key|uint32(i)<<(n.pos+1), int(n.pos), 1)
+			binary.setChild(0, left)
+			binary.setChild(1, right)
+			tn.setChild(uint64(i), binary)
+		}
+	}
+
+	return tn
+}
+
+// Len returns the total number of prefixes stored in the LC-trie.
+func (t *LCTrie[V]) Len() int {
+	return t.size
+}
+
+// Stats walks the LC-trie and returns node counts and depth statistics.
+func (t *LCTrie[V]) Stats() LCTrieStats {
+	stats := LCTrieStats{}
+	totalDepth := 0
+
+	var walk func(n *lcNode[V], depth int)
+	walk = func(n *lcNode[V], depth int) {
+		if n.isLeaf() {
+			stats.Leaves++
+			stats.Prefixes += len(n.prefixes)
+			stats.MaxDepth = max(stats.MaxDepth, depth)
+			totalDepth += depth
+			return
+		}
+
+		stats.InternalNodes++
+		stats.NullPointers += n.emptyChildren
+		stats.NodeSizes[n.bits]++
+		for _, child := range n.children {
+			if child != nil {
+				walk(child, depth+1)
+			}
+		}
+	}
+
+	if t.root != nil {
+		walk(t.root, 0)
+	}
+	if stats.Leaves != 0 {
+		stats.AvgDepth = float64(totalDepth) / float64(stats.Leaves)
+	}
+
+	return stats
+}
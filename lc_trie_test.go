@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkLCTrieInvariants walks the trie and verifies node counters and the
+// placement of every node below its parent.
+func checkLCTrieInvariants[V any](t *testing.T, trie *LCTrie[V]) {
+	t.Helper()
+
+	var walk func(n *lcNode[V])
+	walk = func(n *lcNode[V]) {
+		if n.isLeaf() {
+			require.NotEmpty(t, n.prefixes, "empty leaf %08x", n.key)
+			for idx := 1; idx < len(n.prefixes); idx++ {
+				require.Greater(t, n.prefixes[idx-1].bits, n.prefixes[idx].bits)
+			}
+			return
+		}
+
+		empty, full := 0, 0
+		for idx, child := range n.children {
+			if child == nil {
+				empty++
+				continue
+			}
+			if n.isFull(child) {
+				full++
+			}
+			require.Equal(t, uint64(idx), n.index(child.key),
+				"child %08x misplaced under node %08x/%d+%d", child.key, n.key, n.pos, n.bits)
+			walk(child)
+		}
+		require.Equal(t, empty, n.emptyChildren)
+		require.Equal(t, full, n.fullChildren)
+		require.Less(t, empty, len(n.children)-1, "node %08x must have at least two children", n.key)
+	}
+
+	if trie.root != nil {
+		walk(trie.root)
+	}
+	assert.Equal(t, trie.Len(), trie.Stats().Prefixes)
+}
+
+// TestLCTrieBasicOperations tests basic insert and lookup operations
+func TestLCTrieBasicOperations(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []struct{ cidr, value string }
+		lookups  []struct{ addr, want string }
+	}{
+		{
+			name: "single IPv4 prefix",
+			prefixes: []struct{ cidr, value string }{
+				{"192.168.1.0/24", "DC1"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"192.168.1.1", "DC1"},
+				{"192.168.1.255", "DC1"},
+				{"192.168.2.1", ""},
+			},
+		},
+		{
+			name: "overlapping IPv4 prefixes - more specific wins",
+			prefixes: []struct{ cidr, value string }{
+				{"10.0.0.0/8", "DC1"},
+				{"10.1.0.0/16", "DC2"},
+				{"10.1.1.0/24", "DC3"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"10.0.0.1", "DC1"},
+				{"10.1.0.1", "DC2"},
+				{"10.1.1.1", "DC3"},
+				{"10.2.0.1", "DC1"},
+				{"11.0.0.1", ""},
+			},
+		},
+		{
+			name: "prefixes sharing a network address",
+			prefixes: []struct{ cidr, value string }{
+				{"10.0.0.0/24", "DC3"},
+				{"10.0.0.0/8", "DC1"},
+				{"10.0.0.0/16", "DC2"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"10.0.0.1", "DC3"},
+				{"10.0.1.1", "DC2"},
+				{"10.1.0.1", "DC1"},
+			},
+		},
+		{
+			name: "default route",
+			prefixes: []struct{ cidr, value string }{
+				{"0.0.0.0/0", "DEFAULT"},
+				{"192.168.0.0/16", "DC1"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"8.8.8.8", "DEFAULT"},
+				{"192.168.1.1", "DC1"},
+				{"255.255.255.255", "DEFAULT"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie := NewLCTrie[string](DefaultLCTrieConfig())
+			for _, p := range tt.prefixes {
+				trie.InsertOrUpdate(netip.MustParsePrefix(p.cidr), onEmptyString(p.value), onUpdateString(p.value))
+			}
+			checkLCTrieInvariants(t, trie)
+
+			for _, lookup := range tt.lookups {
+				_, got, found := trie.Lookup(netip.MustParseAddr(lookup.addr))
+				if lookup.want == "" {
+					assert.False(t, found, "Lookup(%s) = %q, want not found", lookup.addr, got)
+					continue
+				}
+				assert.True(t, found, "Lookup(%s) not found", lookup.addr)
+				assert.Equal(t, lookup.want, got, "Lookup(%s)", lookup.addr)
+			}
+		})
+	}
+}
+
+// TestLCTrieUpdateAndDelete tests value updates and prefix removal
+func TestLCTrieUpdateAndDelete(t *testing.T) {
+	trie := NewLCTrie[int](DefaultLCTrieConfig())
+	trie.InsertOrUpdate(netip.MustParsePrefix("10.0.0.0/8"), onEmpty(1), onUpdate(1))
+	trie.InsertOrUpdate(netip.MustParsePrefix("10.1.0.0/16"), onEmpty(2), onUpdate(2))
+	trie.InsertOrUpdate(netip.MustParsePrefix("10.1.0.0/16"), onEmpty(0), onUpdate(3))
+	require.Equal(t, 2, trie.Len())
+
+	prefix, v, ok := trie.Lookup(netip.MustParseAddr("10.1.2.3"))
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, netip.MustParsePrefix("10.1.0.0/16"), prefix)
+
+	// Update without deletion.
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/16"), func(v int) (int, bool) { return v + 1, false })
+	_, v, _ = trie.Lookup(netip.MustParseAddr("10.1.2.3"))
+	assert.Equal(t, 4, v)
+
+	// Deleting a missing prefix is a no-op.
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/24"), func(int) (int, bool) { return 0, true })
+	require.Equal(t, 2, trie.Len())
+
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/16"), func(int) (int, bool) { return 0, true })
+	require.Equal(t, 1, trie.Len())
+	prefix, v, ok = trie.Lookup(netip.MustParseAddr("10.1.2.3"))
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), prefix)
+
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.0.0.0/8"), func(int) (int, bool) { return 0, true })
+	require.Equal(t, 0, trie.Len())
+	_, _, ok = trie.Lookup(netip.MustParseAddr("10.1.2.3"))
+	assert.False(t, ok)
+}
+
+// TestLCTrieMatchesMapTrie runs random inserts and deletes against LCTrie
+// and MapTrie and compares lookups after every phase
+func TestLCTrieMatchesMapTrie(t *testing.T) {
+	configs := map[string]LCTrieConfig{
+		"fib_trie": DefaultLCTrieConfig(),
+		"binary":   {InflateThreshold: 101, HalveThreshold: 0, RootInflateThreshold: 101, RootHalveThreshold: 0},
+		"eager":    {InflateThreshold: 10, HalveThreshold: 5, RootInflateThreshold: 5, RootHalveThreshold: 2},
+	}
+
+	prefixes := randomIPv4Prefixes(20_000)
+	// Add short prefixes so that lookups exercise backtracking.
+	rng := rand.New(rand.NewSource(44))
+	for range 500 {
+		addr := netip.AddrFrom4([4]byte{byte(rng.Intn(256)), byte(rng.Intn(256)), 0, 0})
+		prefixes = append(prefixes, netip.PrefixFrom(addr, rng.Intn(17)).Masked())
+	}
+	addrs := randomIPv4Addrs(10_000)
+	for _, prefix := range prefixes[:2000] {
+		addrs = append(addrs, prefix.Addr(), prefixLastAddr(prefix))
+	}
+
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			trie := NewLCTrie[int](cfg)
+			reference := NewMapTrie[netip.Prefix, netip.Addr, int](0)
+
+			compare := func(phase string) {
+				checkLCTrieInvariants(t, trie)
+				require.Equal(t, reference.Len(), trie.Len(), phase)
+				for _, addr := range addrs {
+					wantPrefix, want, wantOk := reference.Lookup(addr)
+					gotPrefix, got, ok := trie.Lookup(addr)
+					require.Equal(t, wantOk, ok, "%s: Lookup(%s)", phase, addr)
+					require.Equal(t, want, got, "%s: Lookup(%s)", phase, addr)
+					require.Equal(t, wantPrefix, gotPrefix, "%s: Lookup(%s)", phase, addr)
+				}
+			}
+
+			for i, prefix := range prefixes {
+				trie.InsertOrUpdate(prefix, onEmpty(i), onUpdate(i))
+				reference.InsertOrUpdate(prefix, onEmpty(i), onUpdate(i))
+			}
+			compare("insert")
+
+			deleted := func(int) (int, bool) { return 0, true }
+			for i, prefix := range prefixes {
+				if i%3 != 0 {
+					trie.UpdateOrDelete(prefix, deleted)
+					reference.UpdateOrDelete(prefix, deleted)
+				}
+			}
+			compare("delete")
+
+			for i, prefix := range prefixes {
+				if i%3 == 0 {
+					trie.UpdateOrDelete(prefix, deleted)
+					reference.UpdateOrDelete(prefix, deleted)
+				}
+			}
+			compare("delete all")
+			assert.Nil(t, trie.root)
+		})
+	}
+}
+
+// TestLCTrieStats verifies level compression shows up in statistics
+func TestLCTrieStats(t *testing.T) {
+	trie := NewLCTrie[string](DefaultLCTrieConfig())
+	for i := range 256 {
+		value := fmt.Sprintf("DC%d", i)
+		prefix := netip.MustParsePrefix(fmt.Sprintf("10.%d.0.0/16", i))
+		trie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+	}
+
+	stats := trie.Stats()
+	assert.Equal(t, 256, stats.Prefixes)
+	assert.Equal(t, 256, stats.Leaves)
+	// A full /8 of /16 routes collapses into a single wide root node. The
+	// root thresholds allow it to be inflated past 256 children.
+	require.Equal(t, 1, stats.InternalNodes)
+	rootBits := int(trie.root.bits)
+	assert.GreaterOrEqual(t, rootBits, 8)
+	assert.Equal(t, 1, stats.NodeSizes[rootBits])
+	assert.Equal(t, 1<<rootBits-256, stats.NullPointers)
+	assert.Equal(t, 1, stats.MaxDepth)
+	assert.InDelta(t, 1.0, stats.AvgDepth, 1e-9)
+}
+
+// BenchmarkLCTrieLookup benchmarks lookups in small LC-tries
+func BenchmarkLCTrieLookup(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []string
+		lookups  []string
+	}{
+		{
+			name:     "single_prefix_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"192.168.1.1"},
+		},
+		{
+			name: "longest_prefix_match",
+			prefixes: []string{
+				"10.0.0.0/8",
+				"10.1.0.0/16",
+				"10.1.1.0/24",
+				"10.1.1.128/25",
+			},
+			lookups: []string{"10.1.1.129"},
+		},
+		{
+			name:     "no_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"8.8.8.8"},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			trie := NewLCTrie[string](DefaultLCTrieConfig())
+			for _, cidr := range bm.prefixes {
+				trie.InsertOrUpdate(netip.MustParsePrefix(cidr), onEmptyString(cidr), onUpdateString(cidr))
+			}
+
+			addrs := make([]netip.Addr, len(bm.lookups))
+			for i, lookup := range bm.lookups {
+				addrs[i] = netip.MustParseAddr(lookup)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for b.Loop() {
+				for _, addr := range addrs {
+					_, _, _ = trie.Lookup(addr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+var (
+	lookupHitRates = flag.String("lookup-hit-rates", "1,0.5,0", "comma separated hit rates of BenchmarkLookupDistribution1M")
+	lookupZipfS    = flag.Float64("lookup-zipf-s", 1.2, "exponent of the Zipf popularity of BenchmarkLookupDistribution1M, above 1")
+	lookupAddrs    = flag.Int("lookup-addrs", 100_000, "number of lookup addresses per case of BenchmarkLookupDistribution1M")
+)
+
+// BenchmarkLookupDistribution1M benchmarks lookups on 1M prefixes loaded
+// into every implementation with addresses of controlled hit rates, drawn
+// by prefix, by address space or by Zipf popularity.
+//
+// hit-rate is the achieved hit rate of the implementation and
+// expected-hit-rate the one of the addresses, which can be below
+// -lookup-hit-rates when the table covers almost all of the address
+// space. match-len-p50 and match-len-p90 are quantiles of the matched
+// prefix lengths; the full histogram is logged.
+func BenchmarkLookupDistribution1M(b *testing.B) {
+	rates, err := parseHitRates(*lookupHitRates)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if *lookupZipfS <= 1 {
+		b.Fatalf("-lookup-zipf-s %g not above 1", *lookupZipfS)
+	}
+
+	for _, ds := range prefixDatasets() {
+		prefixes := ds.prefixes(1000_000)
+		ipv4 := prefixes[0].Addr().Is4()
+
+		// The addresses are generated once per dataset, when the first case
+		// runs, and shared by the implementations.
+		type lookupCase struct {
+			addrs []netip.Addr
+			hist  MatchLengthHistogram
+		}
+		var cases map[string]lookupCase
+		generate := func(b *testing.B) {
+			cases = map[string]lookupCase{}
+			g := NewLookupAddrGenerator(prefixes)
+			for _, weighting := range []AddrWeighting{WeightByPrefix, WeightBySpace, WeightByZipf} {
+				for _, rate := range rates {
+					addrs, err := g.Generate(*lookupAddrs, LookupAddrConfig{HitRate: rate, Weighting: weighting, ZipfS: *lookupZipfS, Seed: 43})
+					if err != nil {
+						b.Fatal(err)
+					}
+					cases[fmt.Sprintf("%s/hit=%g", weighting, rate)] = lookupCase{addrs, g.MatchLengths(addrs)}
+				}
+			}
+		}
+
+		for _, impl := range stringTableImplementations() {
+			if impl.ipv4Only && !ipv4 {
+				continue
+			}
+
+			var lookup func(netip.Addr) bool
+			for _, weighting := range []AddrWeighting{WeightByPrefix, WeightBySpace, WeightByZipf} {
+				for _, rate := range rates {
+					name := fmt.Sprintf("%s/hit=%g", weighting, rate)
+					b.Run(ds.name+"/"+impl.name+"/"+name, func(b *testing.B) {
+						if cases == nil {
+							generate(b)
+						}
+						if lookup == nil {
+							lookup, _ = loadTable(b, impl, prefixes)
+						}
+						c := cases[name]
+						b.Logf("Matched lengths of %s: %s", name, c.hist)
+
+						b.ResetTimer()
+						b.ReportAllocs()
+						captureProfiles(b)
+
+						idx := 0
+						foundCount := 0
+						for b.Loop() {
+							if lookup(c.addrs[idx]) {
+								foundCount++
+							}
+							idx = (idx + 1) % len(c.addrs)
+						}
+
+						if foundCount == 0 && c.hist.Hits() != 0 {
+							b.Fatalf("No successful lookups in %d iterations", b.N)
+						}
+
+						b.ReportMetric(float64(foundCount)/float64(b.N), "hit-rate")
+						b.ReportMetric(c.hist.HitRate(), "expected-hit-rate")
+						b.ReportMetric(float64(c.hist.Quantile(0.5)), "match-len-p50")
+						b.ReportMetric(float64(c.hist.Quantile(0.9)), "match-len-p90")
+					})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddrWeighting selects how likely each inserted prefix is to contain a
+// lookup address.
+type AddrWeighting string
+
+const (
+	// WeightByPrefix draws every prefix with the same probability.
+	WeightByPrefix AddrWeighting = "prefix"
+	// WeightBySpace draws prefixes in proportion to the addresses they
+	// cover, as for uniformly random addresses inside the table.
+	WeightBySpace AddrWeighting = "space"
+	// WeightByZipf draws prefixes by Zipf-skewed popularity, a few
+	// prefixes getting most of the traffic.
+	WeightByZipf AddrWeighting = "zipf"
+)
+
+// LookupAddrConfig configures LookupAddrGenerator.Generate.
+type LookupAddrConfig struct {
+	// HitRate is the fraction of addresses drawn from inside inserted
+	// prefixes, the others are random addresses outside of them.
+	HitRate   float64
+	Weighting AddrWeighting
+	// ZipfS is the exponent of the Zipf popularity, above 1.
+	ZipfS float64
+	Seed  int64
+}
+
+// maxMissAttempts is the number of random addresses tried for a miss
+// before one covered by the table is used instead, in tables covering
+// almost all of the address space.
+const maxMissAttempts = 100
+
+// LookupAddrGenerator generates lookup addresses with a controlled hit
+// rate for a set of prefixes. MapTrie is the index used to tell hits from
+// misses and to find the matched prefix lengths.
+type LookupAddrGenerator struct {
+	prefixes []netip.Prefix
+	index    MapTrie[netip.Prefix, netip.Addr, struct{}]
+}
+
+// NewLookupAddrGenerator returns a generator of addresses for the
+// prefixes.
+func NewLookupAddrGenerator(prefixes []netip.Prefix) *LookupAddrGenerator {
+	index := NewMapTrie[netip.Prefix, netip.Addr, struct{}](0)
+	present := func() struct{} { return struct{}{} }
+	for _, prefix := range prefixes {
+		index.InsertOrUpdate(prefix, present, func(struct{}) struct{} { return struct{}{} })
+	}
+	return &LookupAddrGenerator{prefixes: prefixes, index: index}
+}
+
+// Generate returns n lookup addresses. Hits are random addresses inside
+// prefixes drawn by the weighting, misses random addresses of the family
+// of a random prefix that no prefix covers. The achieved hit rate can be
+// lower than configured when misses are hard to find; see MatchLengths.
+func (g *LookupAddrGenerator) Generate(n int, cfg LookupAddrConfig) ([]netip.Addr, error) {
+	if len(g.prefixes) == 0 {
+		return nil, errors.New("no prefixes")
+	}
+	if cfg.HitRate < 0 || cfg.HitRate > 1 {
+		return nil, fmt.Errorf("hit rate %g outside [0, 1]", cfg.HitRate)
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+
+	var pick func() netip.Prefix
+	switch cfg.Weighting {
+	case WeightByPrefix:
+		pick = func() netip.Prefix { return g.prefixes[rng.Intn(len(g.prefixes))] }
+	case WeightBySpace:
+		cumulative := make([]float64, len(g.prefixes))
+		var total float64
+		for i, prefix := range g.prefixes {
+			total += math.Ldexp(1, prefix.Addr().BitLen()-prefix.Bits())
+			cumulative[i] = total
+		}
+		pick = func() netip.Prefix {
+			i := sort.SearchFloat64s(cumulative, rng.Float64()*total)
+			return g.prefixes[min(i, len(g.prefixes)-1)]
+		}
+	case WeightByZipf:
+		if cfg.ZipfS <= 1 {
+			return nil, fmt.Errorf("zipf exponent %g not above 1", cfg.ZipfS)
+		}
+		// Popularity ranks are shuffled, so that the popular prefixes are
+		// not the first inserted ones.
+		ranks := rng.Perm(len(g.prefixes))
+		zipf := rand.NewZipf(rng, cfg.ZipfS, 1, uint64(len(g.prefixes)-1))
+		pick = func() netip.Prefix { return g.prefixes[ranks[zipf.Uint64()]] }
+	default:
+		return nil, fmt.Errorf("unknown weighting %q", cfg.Weighting)
+	}
+
+	addrs := make([]netip.Addr, n)
+	for i := range addrs {
+		if rng.Float64() < cfg.HitRate {
+			addrs[i] = randomAddrIn(rng, pick())
+			continue
+		}
+		family := netip.PrefixFrom(g.prefixes[rng.Intn(len(g.prefixes))].Addr(), 0).Masked()
+		for range maxMissAttempts {
+			addrs[i] = randomAddrIn(rng, family)
+			if _, _, ok := g.index.Lookup(addrs[i]); !ok {
+				break
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// MatchLengths returns the histogram of the longest matching prefix
+// lengths of the addresses.
+func (g *LookupAddrGenerator) MatchLengths(addrs []netip.Addr) MatchLengthHistogram {
+	var h MatchLengthHistogram
+	for _, addr := range addrs {
+		prefix, _, ok := g.index.Lookup(addr)
+		if !ok {
+			h.Misses++
+			continue
+		}
+		h.Matches[prefix.Bits()]++
+	}
+	return h
+}
+
+// MatchLengthHistogram counts lookups by the length of the longest
+// matching prefix.
+type MatchLengthHistogram struct {
+	Matches [129]int // Hits per prefix length
+	Misses  int
+}
+
+// Hits returns the number of lookups matching a prefix.
+func (h MatchLengthHistogram) Hits() int {
+	hits := 0
+	for _, n := range h.Matches {
+		hits += n
+	}
+	return hits
+}
+
+// HitRate returns the fraction of lookups matching a prefix.
+func (h MatchLengthHistogram) HitRate() float64 {
+	hits := h.Hits()
+	if hits+h.Misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+h.Misses)
+}
+
+// Quantile returns the q quantile of the matched lengths of the hits, -1
+// without hits.
+func (h MatchLengthHistogram) Quantile(q float64) int {
+	hits := h.Hits()
+	if hits == 0 {
+		return -1
+	}
+	rank := max(int(math.Ceil(q*float64(hits))), 1)
+	for bits, n := range h.Matches {
+		if rank -= n; rank <= 0 {
+			return bits
+		}
+	}
+	return len(h.Matches) - 1
+}
+
+// String formats the non-empty buckets as "/24:80 miss:20".
+func (h MatchLengthHistogram) String() string {
+	var parts []string
+	for bits, n := range h.Matches {
+		if n != 0 {
+			parts = append(parts, fmt.Sprintf("/%d:%d", bits, n))
+		}
+	}
+	if h.Misses != 0 {
+		parts = append(parts, fmt.Sprintf("miss:%d", h.Misses))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseHitRates parses a comma separated list of hit rates.
+func parseHitRates(s string) ([]float64, error) {
+	var rates []float64
+	for _, field := range strings.Split(s, ",") {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("hit rate: %w", err)
+		}
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("hit rate %g outside [0, 1]", rate)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
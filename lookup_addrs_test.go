@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLookupAddrGeneratorHitRate tests that the configured fraction of
+// addresses hits the prefixes
+func TestLookupAddrGeneratorHitRate(t *testing.T) {
+	g := NewLookupAddrGenerator(randomIPv6Prefixes(1000))
+	for _, weighting := range []AddrWeighting{WeightByPrefix, WeightBySpace, WeightByZipf} {
+		for _, rate := range []float64{0, 0.5, 1} {
+			addrs, err := g.Generate(10000, LookupAddrConfig{HitRate: rate, Weighting: weighting, ZipfS: 1.2, Seed: 1})
+			require.NoError(t, err)
+			require.Len(t, addrs, 10000)
+			h := g.MatchLengths(addrs)
+			assert.Equal(t, 10000, h.Hits()+h.Misses)
+			assert.InDelta(t, rate, h.HitRate(), 0.02, "%s %g", weighting, rate)
+		}
+	}
+}
+
+// TestLookupAddrGeneratorWeighting tests the distribution of hits over the
+// prefixes
+func TestLookupAddrGeneratorWeighting(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+		netip.MustParsePrefix("203.0.113.0/24"),
+	}
+	g := NewLookupAddrGenerator(prefixes)
+	share := func(weighting AddrWeighting) float64 {
+		addrs, err := g.Generate(10000, LookupAddrConfig{HitRate: 1, Weighting: weighting, ZipfS: 2, Seed: 1})
+		require.NoError(t, err)
+		return float64(g.MatchLengths(addrs).Matches[8]) / 10000
+	}
+	assert.InDelta(t, 0.25, share(WeightByPrefix), 0.02)
+	assert.Greater(t, share(WeightBySpace), 0.99, "the /8 covers 65536 times the addresses of a /24")
+
+	addrs, err := g.Generate(10000, LookupAddrConfig{HitRate: 1, Weighting: WeightByZipf, ZipfS: 2, Seed: 1})
+	require.NoError(t, err)
+	counts := map[netip.Prefix]int{}
+	for _, addr := range addrs {
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr) {
+				counts[prefix]++
+			}
+		}
+	}
+	maxCount := 0
+	for _, n := range counts {
+		maxCount = max(maxCount, n)
+	}
+	assert.Greater(t, maxCount, 5000, "the most popular prefix gets most lookups")
+}
+
+// TestLookupAddrGeneratorErrors tests invalid configurations
+func TestLookupAddrGeneratorErrors(t *testing.T) {
+	g := NewLookupAddrGenerator(referencePrefixes(10))
+	for _, cfg := range []LookupAddrConfig{
+		{HitRate: 1.5, Weighting: WeightByPrefix},
+		{HitRate: 1, Weighting: "uniform"},
+		{HitRate: 1, Weighting: WeightByZipf, ZipfS: 1},
+	} {
+		_, err := g.Generate(10, cfg)
+		assert.Error(t, err, cfg)
+	}
+	_, err := NewLookupAddrGenerator(nil).Generate(10, LookupAddrConfig{Weighting: WeightByPrefix})
+	assert.Error(t, err)
+}
+
+// TestMatchLengthHistogram tests hit rates, quantiles and formatting of
+// matched lengths
+func TestMatchLengthHistogram(t *testing.T) {
+	var h MatchLengthHistogram
+	assert.Zero(t, h.HitRate())
+	assert.Equal(t, -1, h.Quantile(0.5))
+
+	h.Matches[16] = 2
+	h.Matches[24] = 6
+	h.Matches[32] = 2
+	h.Misses = 10
+	assert.Equal(t, 10, h.Hits())
+	assert.InDelta(t, 0.5, h.HitRate(), 1e-12)
+	assert.Equal(t, 16, h.Quantile(0))
+	assert.Equal(t, 24, h.Quantile(0.5))
+	assert.Equal(t, 24, h.Quantile(0.8))
+	assert.Equal(t, 32, h.Quantile(0.9))
+	assert.Equal(t, "/16:2 /24:6 /32:2 miss:10", h.String())
+}
+
+// TestParseHitRates tests parsing of hit rate lists
+func TestParseHitRates(t *testing.T) {
+	rates, err := parseHitRates("1, 0.9,0")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 0.9, 0}, rates)
+
+	_, err = parseHitRates("1,high")
+	assert.Error(t, err)
+	_, err = parseHitRates("2")
+	assert.Error(t, err)
+}
+
+// TestLookupAddrGeneratorUnmasked tests that hits inside unmasked prefixes
+// are counted as hits
+func TestLookupAddrGeneratorUnmasked(t *testing.T) {
+	g := NewLookupAddrGenerator([]netip.Prefix{
+		netip.MustParsePrefix("192.0.2.77/24"),
+		netip.MustParsePrefix("2001:db8::1/32"),
+	})
+	addrs, err := g.Generate(1000, LookupAddrConfig{HitRate: 1, Weighting: WeightByPrefix, Seed: 1})
+	require.NoError(t, err)
+	h := g.MatchLengths(addrs)
+	assert.Zero(t, h.Misses)
+	assert.Equal(t, 1000, h.Matches[24]+h.Matches[32])
+}
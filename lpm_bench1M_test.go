@@ -77,6 +77,7 @@ func BenchmarkLPMInsert1M(b *testing.B) {
 	for _, bm := range benchmarks {
 		b.Run(bm.name, func(b *testing.B) {
 			b.ReportAllocs()
+			captureProfiles(b)
 
 			lpm := lpm.New()
 			idx := 0
@@ -212,6 +213,7 @@ func BenchmarkLPMLookup1M(b *testing.B) {
 
 			b.ResetTimer()
 			b.ReportAllocs()
+			captureProfiles(b)
 
 			idx := 0
 			foundCount := 0
@@ -226,6 +228,9 @@ func BenchmarkLPMLookup1M(b *testing.B) {
 			if foundCount == 0 {
 				b.Fatalf("No successful lookups in %d iterations", b.N)
 			}
+
+			b.ReportMetric(float64(stats.TotalSize), "table-bytes")
+			b.ReportMetric(float64(allocDiff), "heap-bytes")
 		})
 	}
 }
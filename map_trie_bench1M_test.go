@@ -77,6 +77,7 @@ func BenchmarkMapTrieInsert1M(b *testing.B) {
 	for _, bm := range benchmarks {
 		b.Run(bm.name, func(b *testing.B) {
 			b.ReportAllocs()
+			captureProfiles(b)
 
 			trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
 			idx := 0
@@ -206,9 +207,13 @@ func BenchmarkMapTrieLookup1M(b *testing.B) {
 			b.Logf("Memory usage after 1M inserts: Alloc=%d bytes (%.2f MB), TotalAlloc=%d bytes (%.2f MB)",
 				allocDiff, float64(allocDiff)/(1024*1024),
 				totalAllocDiff, float64(totalAllocDiff)/(1024*1024))
+			stats := trie.Stats()
+			b.Logf("maptrie.populatedLengths: %d, maptrie.tables: %d, maptrie.slots: %d, estimated size: %d, load factor: %.2f",
+				len(stats.PopulatedLengths), stats.Maps.Tables, stats.Maps.Slots, stats.Maps.Bytes, stats.LoadFactor())
 
 			b.ResetTimer()
 			b.ReportAllocs()
+			captureProfiles(b)
 
 			idx := 0
 			foundCount := 0
@@ -223,6 +228,11 @@ func BenchmarkMapTrieLookup1M(b *testing.B) {
 			if foundCount == 0 {
 				b.Fatalf("No successful lookups in %d iterations", b.N)
 			}
+
+			b.ReportMetric(float64(stats.Maps.Bytes), "table-bytes")
+			b.ReportMetric(float64(allocDiff), "heap-bytes")
+			b.ReportMetric(float64(len(stats.PopulatedLengths)), "populated-lengths")
+			b.ReportMetric(stats.LoadFactor(), "load-factor")
 		})
 	}
 }
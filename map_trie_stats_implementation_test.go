@@ -0,0 +1,205 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"net/netip"
+	"slices"
+	"unsafe"
+)
+
+// Layout of the runtime swiss table maps used by the estimates below. The
+// runtime does not expose map internals, so the constants mirror
+// internal/runtime/maps and the estimates assume the maps were grown by
+// insertion rather than pre-sized with a capacity hint.
+const (
+	mapHeaderBytes     = 48   // maps.Map
+	mapTableBytes      = 32   // maps.table
+	mapGroupSlots      = 8    // slots per group, one control byte each
+	mapMaxTableSlots   = 1024 // tables split instead of growing past this
+	mapMaxLoadNum      = 7    // maximum load factor is 7/8
+	mapMaxLoadDen      = 8
+	mapSplitGrowFactor = math.Ln2 // average fill of extendible hashing tables
+)
+
+// MapStats is the estimated layout of a single Go map.
+type MapStats struct {
+	Entries int // Number of entries stored
+	Tables  int // Number of swiss tables, 0 for small maps
+	Slots   int // Number of allocated slots
+	Bytes   int // Estimated size of the header, directory, tables and groups
+}
+
+// estimateMapStats returns the estimated layout of a map holding the
+// given number of entries with slots of slotSize bytes.
+func estimateMapStats(entries int, slotSize uintptr) MapStats {
+	stats := MapStats{Entries: entries, Bytes: mapHeaderBytes}
+	if entries == 0 {
+		return stats
+	}
+
+	groupBytes := mapGroupSlots + mapGroupSlots*int(slotSize)
+	if entries <= mapGroupSlots {
+		// Small maps keep a single group without a table.
+		stats.Slots = mapGroupSlots
+		stats.Bytes += groupBytes
+		return stats
+	}
+
+	slots := 1 << bits.Len(uint((entries*mapMaxLoadDen+mapMaxLoadNum-1)/mapMaxLoadNum-1))
+	if slots <= mapMaxTableSlots {
+		stats.Tables, stats.Slots = 1, slots
+	} else {
+		// Full tables split in two, so with uniform hashing tables are on
+		// average ln2 of their maximum load.
+		perTable := float64(mapMaxTableSlots*mapMaxLoadNum/mapMaxLoadDen) * mapSplitGrowFactor
+		stats.Tables = int(math.Ceil(float64(entries) / perTable))
+		stats.Slots = stats.Tables * mapMaxTableSlots
+		// The directory has a power of two entries.
+		stats.Bytes += (1 << bits.Len(uint(stats.Tables-1))) * int(unsafe.Sizeof(uintptr(0)))
+	}
+	stats.Bytes += stats.Tables*mapTableBytes + stats.Slots/mapGroupSlots*groupBytes
+
+	return stats
+}
+
+// LoadFactor returns the ratio of entries to allocated slots.
+func (s MapStats) LoadFactor() float64 {
+	if s.Slots == 0 {
+		return 0
+	}
+	return float64(s.Entries) / float64(s.Slots)
+}
+
+// add accumulates the stats of another map.
+func (s *MapStats) add(other MapStats) {
+	s.Entries += other.Entries
+	s.Tables += other.Tables
+	s.Slots += other.Slots
+	s.Bytes += other.Bytes
+}
+
+// MapTrieStats describes the structure of a MapTrie, comparable to
+// lpm.Stats.
+type MapTrieStats struct {
+	Entries          [129]int // Number of entries per prefix length
+	PopulatedLengths []int    // Prefix lengths with at least one entry, ascending
+	Maps             MapStats // Estimated layout of all per-length maps
+}
+
+// Len returns the total number of entries.
+func (s MapTrieStats) Len() int {
+	return s.Maps.Entries
+}
+
+// LoadFactor returns the ratio of entries to allocated slots over all
+// per-length maps.
+func (s MapTrieStats) LoadFactor() float64 {
+	return s.Maps.LoadFactor()
+}
+
+// Stats returns per-length entry counts and the estimated memory used by
+// the map buckets. Memory referenced by keys or values is not included.
+func (m *MapTrie[K, Q, V]) Stats() MapTrieStats {
+	var slot struct {
+		key   K
+		value V
+	}
+
+	var stats MapTrieStats
+	for bits, entries := range m {
+		if entries == nil {
+			continue
+		}
+		stats.Entries[bits] = len(entries)
+		if len(entries) != 0 {
+			stats.PopulatedLengths = append(stats.PopulatedLengths, bits)
+		}
+		stats.Maps.add(estimateMapStats(len(entries), unsafe.Sizeof(slot)))
+	}
+
+	return stats
+}
+
+// PatriciaStats is the estimated structure of kentik/patricia trees
+// holding a set of prefixes, one tree per address family.
+type PatriciaStats struct {
+	IPv4Nodes int      // Nodes of the IPv4 tree including the root and the unused node 0
+	IPv6Nodes int      // Nodes of the IPv6 tree including the root and the unused node 0
+	Tags      int      // Number of tagged nodes, one per distinct prefix
+	NodeBytes int      // Size of the node slices
+	Tags4     MapStats // Estimated layout of the IPv4 tag map
+	Tags6     MapStats // Estimated layout of the IPv6 tag map
+}
+
+// TotalSize returns the estimated size of the nodes and tag maps in bytes.
+func (s PatriciaStats) TotalSize() int {
+	return s.NodeBytes + s.Tags4.Bytes + s.Tags6.Bytes
+}
+
+// Sizes of string_tree.treeNodeV4 and treeNodeV6, which are unexported.
+const (
+	patriciaNodeV4Bytes = 40
+	patriciaNodeV6Bytes = 48
+)
+
+// EstimatePatriciaStats returns the structure of string_tree trees built
+// by setting every prefix with one tag.
+//
+// The trees are path compressed, so besides the root they hold a node per
+// distinct prefix and a branch node wherever two subtrees diverge. Those
+// branch points are the common prefixes of neighbours in address order.
+func EstimatePatriciaStats(prefixes []netip.Prefix) PatriciaStats {
+	var v4, v6 []netip.Prefix
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is4() {
+			v4 = append(v4, prefix.Masked())
+		} else {
+			v6 = append(v6, prefix.Masked())
+		}
+	}
+
+	// The tag maps are keyed by uint64 and hold strings.
+	tagSlot := unsafe.Sizeof(struct {
+		key uint64
+		tag string
+	}{})
+
+	var stats PatriciaStats
+	var tags4, tags6 int
+	stats.IPv4Nodes, tags4 = patriciaNodes(v4)
+	stats.IPv6Nodes, tags6 = patriciaNodes(v6)
+	stats.Tags = tags4 + tags6
+	stats.NodeBytes = stats.IPv4Nodes*patriciaNodeV4Bytes + stats.IPv6Nodes*patriciaNodeV6Bytes
+	stats.Tags4 = estimateMapStats(tags4, tagSlot)
+	stats.Tags6 = estimateMapStats(tags6, tagSlot)
+
+	return stats
+}
+
+// patriciaNodes returns the number of nodes and distinct prefixes of a
+// single family tree.
+func patriciaNodes(prefixes []netip.Prefix) (nodes, tags int) {
+	if len(prefixes) == 0 {
+		// An empty tree has the unused node 0 and the root.
+		return 2, 0
+	}
+
+	slices.SortFunc(prefixes, comparePrefixes)
+	prefixes = slices.Compact(prefixes)
+
+	// The root is the /0 of the family, which holds the default route.
+	distinct := map[netip.Prefix]struct{}{
+		netip.PrefixFrom(prefixes[0].Addr(), 0).Masked(): {},
+	}
+	for idx, prefix := range prefixes {
+		distinct[prefix] = struct{}{}
+		if idx > 0 {
+			prev := prefixes[idx-1]
+			distinct[netip.PrefixFrom(prefix.Addr(), commonPrefixLen(prev, prefix)).Masked()] = struct{}{}
+		}
+	}
+
+	// Node 0 is unused.
+	return 1 + len(distinct), len(prefixes)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/kentik/patricia"
+	"github.com/kentik/patricia/string_tree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMapTrieStats tests per-length counts of a small trie
+func TestMapTrieStats(t *testing.T) {
+	trie := NewMapTrie[netip.Prefix, netip.Addr, int](0)
+	for _, cidr := range []string{
+		"0.0.0.0/0",
+		"10.0.0.0/8",
+		"11.0.0.0/8",
+		"10.1.0.0/16",
+		"2001:db8::/32",
+		"2001:db8:1::/48",
+	} {
+		trie.InsertOrUpdate(netip.MustParsePrefix(cidr), onEmpty(1), onUpdate(1))
+	}
+
+	stats := trie.Stats()
+	assert.Equal(t, 6, stats.Len())
+	assert.Equal(t, trie.Len(), stats.Len())
+	assert.Equal(t, []int{0, 8, 16, 32, 48}, stats.PopulatedLengths)
+	assert.Equal(t, 1, stats.Entries[0])
+	assert.Equal(t, 2, stats.Entries[8])
+	assert.Equal(t, 1, stats.Entries[48])
+	assert.Equal(t, 0, stats.Entries[24])
+
+	// Every populated length is a small map with a single group.
+	assert.Equal(t, 5*mapGroupSlots, stats.Maps.Slots)
+	assert.Equal(t, 0, stats.Maps.Tables)
+	assert.InDelta(t, 6.0/40.0, stats.LoadFactor(), 1e-9)
+	assert.Greater(t, stats.Maps.Bytes, 129*mapHeaderBytes)
+
+	// Deleting the only entry of a length leaves it unpopulated.
+	trie.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/16"), func(int) (int, bool) { return 0, true })
+	assert.Equal(t, []int{0, 8, 32, 48}, trie.Stats().PopulatedLengths)
+}
+
+// TestEstimateMapStats tests the swiss table layout estimate
+func TestEstimateMapStats(t *testing.T) {
+	tests := []struct {
+		entries int
+		tables  int
+		slots   int
+	}{
+		{0, 0, 0},
+		{8, 0, 8},
+		{9, 1, 16},
+		{100, 1, 128},
+		{896, 1, 1024},
+		{897, 2, 2048},
+		{100_000, 162, 162 * 1024},
+	}
+
+	for _, tt := range tests {
+		stats := estimateMapStats(tt.entries, 40)
+		assert.Equal(t, tt.tables, stats.Tables, "entries=%d", tt.entries)
+		assert.Equal(t, tt.slots, stats.Slots, "entries=%d", tt.entries)
+		if stats.Tables != 0 {
+			assert.LessOrEqual(t, stats.LoadFactor(), 7.0/8.0, "entries=%d", tt.entries)
+		}
+	}
+}
+
+// TestEstimateMapStatsMatchesHeap compares the estimate against the heap
+// growth of a map filled by insertion
+func TestEstimateMapStatsMatchesHeap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping heap measurement in short mode")
+	}
+
+	prefixes := randomIPv4Prefixes(200_000)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	entries := make(map[netip.Prefix]string)
+	for _, prefix := range prefixes {
+		entries[prefix] = ""
+	}
+
+	runtime.GC()
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	var slot struct {
+		key   netip.Prefix
+		value string
+	}
+	estimate := estimateMapStats(len(entries), unsafe.Sizeof(slot))
+	heap := float64(after.HeapAlloc - before.HeapAlloc)
+	t.Logf("entries=%d estimate=%d heap=%.0f", len(entries), estimate.Bytes, heap)
+	assert.InEpsilon(t, heap, float64(estimate.Bytes), 0.25)
+
+	runtime.KeepAlive(prefixes)
+	runtime.KeepAlive(entries)
+}
+
+// radixNodes counts the nodes of a RadixTrie subtree
+func radixNodes[V any](node *radixNode[V]) int {
+	if node == nil {
+		return 0
+	}
+	return 1 + radixNodes(node.children[0]) + radixNodes(node.children[1])
+}
+
+// TestEstimatePatriciaStats tests the node estimate against a hand-made
+// tree and against RadixTrie, which has the same shape without a root
+func TestEstimatePatriciaStats(t *testing.T) {
+	t.Run("hand-made", func(t *testing.T) {
+		var prefixes []netip.Prefix
+		for _, cidr := range []string{
+			"10.0.0.0/8",
+			"10.1.0.0/16",
+			"10.128.0.0/16", // no branch node, 10.0.0.0/8 joins both
+			"192.168.1.0/24",
+			"192.168.2.0/24", // branch node 192.168.0.0/22
+			"10.0.0.0/8",     // duplicate
+		} {
+			prefixes = append(prefixes, netip.MustParsePrefix(cidr))
+		}
+
+		stats := EstimatePatriciaStats(prefixes)
+		// Unused node, root, 5 prefixes, a branch for 192.168.0.0/22 and
+		// one joining 10/8 and 192.168/22 at 0.0.0.0/0, which is the root.
+		assert.Equal(t, 2+5+1, stats.IPv4Nodes)
+		assert.Equal(t, 2, stats.IPv6Nodes)
+		assert.Equal(t, 5, stats.Tags)
+		assert.Equal(t, 8*patriciaNodeV4Bytes+2*patriciaNodeV6Bytes, stats.NodeBytes)
+		assert.Equal(t, stats.NodeBytes+stats.Tags4.Bytes+stats.Tags6.Bytes, stats.TotalSize())
+	})
+
+	t.Run("random", func(t *testing.T) {
+		prefixes := referencePrefixes(5000)
+
+		radix := NewRadixTrie[int]()
+		tree4, tree6 := string_tree.NewTreeV4(), string_tree.NewTreeV6()
+		for idx, prefix := range prefixes {
+			radix.Insert(prefix, idx)
+			addr := prefix.Addr()
+			if addr.Is4() {
+				tree4.Set(patricia.NewIPv4AddressFromBytes(addr.AsSlice(), uint(prefix.Bits())), "DC")
+			} else {
+				tree6.Set(patricia.NewIPv6Address(addr.AsSlice(), uint(prefix.Bits())), "DC")
+			}
+		}
+
+		stats := EstimatePatriciaStats(prefixes)
+		require.Equal(t, radix.Len(), stats.Tags)
+		assert.Equal(t, tree4.CountTags()+tree6.CountTags(), stats.Tags)
+
+		// RadixTrie has no root unless /0 or a branch at /0 exists.
+		rootless := func(node *radixNode[int]) int {
+			if node != nil && node.prefix.Bits() == 0 {
+				return 0
+			}
+			return 1
+		}
+		assert.Equal(t, 1+rootless(radix.v4)+radixNodes(radix.v4), stats.IPv4Nodes)
+		assert.Equal(t, 1+rootless(radix.v6)+radixNodes(radix.v6), stats.IPv6Nodes)
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+// BenchmarkProcessMemory1M measures the memory of 1M prefixes loaded into
+// every implementation, each in a subprocess of its own, as seen by the
+// kernel rather than the Go heap alone. ns/op is the duration of one
+// subprocess, use -benchtime=1x.
+//
+// rss-bytes/prefix, anon-bytes/prefix and heap-bytes/prefix are the growth
+// of VmRSS, of the anonymous memory from smaps_rollup and of the Go heap
+// per prefix, comparable to the psutil RSS of py_bench_pytricia_1m.py.
+// peak-rss-bytes is the peak RSS growth during the build.
+func BenchmarkProcessMemory1M(b *testing.B) {
+	if runtime.GOOS != "linux" {
+		b.Skip("the memory probe reads /proc")
+	}
+
+	for _, c := range memoryProbeCases() {
+		b.Run(c.name, func(b *testing.B) {
+			var result MemoryProbeResult
+			for b.Loop() {
+				var err error
+				result, err = runMemoryProbe(c.name, 1000_000)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			growth := result.Growth()
+			b.Logf("Memory usage after %d inserts: RSS=%d bytes (%.2f MB), peak RSS=%d bytes (%.2f MB), anonymous=%d bytes (%.2f MB), PSS=%d bytes, heap=%d bytes (%.2f MB), sys=%d bytes",
+				result.Prefixes, growth.RSS, float64(growth.RSS)/(1024*1024), growth.PeakRSS, float64(growth.PeakRSS)/(1024*1024),
+				growth.Anonymous, float64(growth.Anonymous)/(1024*1024), growth.PSS, growth.Heap, float64(growth.Heap)/(1024*1024), growth.Sys)
+
+			prefixes := float64(result.Prefixes)
+			b.ReportMetric(float64(growth.RSS)/prefixes, "rss-bytes/prefix")
+			b.ReportMetric(float64(growth.Anonymous)/prefixes, "anon-bytes/prefix")
+			b.ReportMetric(float64(growth.Heap)/prefixes, "heap-bytes/prefix")
+			b.ReportMetric(float64(growth.PeakRSS), "peak-rss-bytes")
+		})
+	}
+}
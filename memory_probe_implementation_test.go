@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// memoryProbeMarker prefixes the line with the result of a memory probe
+// in the output of the subprocess.
+const memoryProbeMarker = "memory-probe-result: "
+
+// ProcessMemory is the memory of the process as seen by the kernel and by
+// the Go runtime, in bytes.
+type ProcessMemory struct {
+	RSS       int64 // VmRSS of /proc/self/status
+	PeakRSS   int64 // VmHWM of /proc/self/status
+	Anonymous int64 // Anonymous of /proc/self/smaps_rollup
+	PSS       int64 // Pss of /proc/self/smaps_rollup
+	Heap      int64 // runtime.MemStats.HeapAlloc
+	Sys       int64 // runtime.MemStats.Sys, memory obtained from the OS
+}
+
+// ReadProcessMemory reads the memory of the current process. It only
+// works on Linux.
+func ReadProcessMemory() (ProcessMemory, error) {
+	var mem ProcessMemory
+	if err := readProcKB("/proc/self/status", map[string]*int64{
+		"VmRSS": &mem.RSS,
+		"VmHWM": &mem.PeakRSS,
+	}); err != nil {
+		return mem, err
+	}
+	if err := readProcKB("/proc/self/smaps_rollup", map[string]*int64{
+		"Anonymous": &mem.Anonymous,
+		"Pss":       &mem.PSS,
+	}); err != nil {
+		return mem, err
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	mem.Heap = int64(stats.HeapAlloc)
+	mem.Sys = int64(stats.Sys)
+	return mem, nil
+}
+
+// Sub returns the growth of the memory since before. PeakRSS is the peak
+// RSS above the RSS of before.
+func (m ProcessMemory) Sub(before ProcessMemory) ProcessMemory {
+	return ProcessMemory{
+		RSS:       m.RSS - before.RSS,
+		PeakRSS:   m.PeakRSS - before.RSS,
+		Anonymous: m.Anonymous - before.Anonymous,
+		PSS:       m.PSS - before.PSS,
+		Heap:      m.Heap - before.Heap,
+		Sys:       m.Sys - before.Sys,
+	}
+}
+
+// readProcKB reads the fields of a /proc file in the "Name: 123 kB"
+// format.
+func readProcKB(path string, fields map[string]*int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := parseProcKB(f, fields); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// parseProcKB parses the fields of /proc/self/status or
+// /proc/self/smaps_rollup and stores them in bytes. Lines of other fields
+// are ignored.
+func parseProcKB(r io.Reader, fields map[string]*int64) error {
+	found := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		dst, wanted := fields[name]
+		if !ok || !wanted {
+			continue
+		}
+
+		value, unit, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		kb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || unit != "kB" {
+			return fmt.Errorf("field %s: invalid value %q", name, strings.TrimSpace(rest))
+		}
+		*dst = kb * 1024
+		found++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if found != len(fields) {
+		return fmt.Errorf("found %d of %d fields", found, len(fields))
+	}
+	return nil
+}
+
+// MemoryProbeResult is the memory of a process around a table build.
+type MemoryProbeResult struct {
+	Prefixes int
+	Before   ProcessMemory
+	After    ProcessMemory
+}
+
+// Growth returns the memory added by the build.
+func (r MemoryProbeResult) Growth() ProcessMemory {
+	return r.After.Sub(r.Before)
+}
+
+// measureMemory reads the process memory before and after build, with
+// garbage collected and returned to the OS, keeping the result of build
+// alive until the second measurement. The peak RSS is reset first where
+// the kernel supports it, so that PeakRSS is the peak of the build.
+func measureMemory(prefixes int, build func() any) (MemoryProbeResult, error) {
+	result := MemoryProbeResult{Prefixes: prefixes}
+
+	debug.FreeOSMemory()
+	_ = os.WriteFile("/proc/self/clear_refs", []byte("5"), 0)
+	before, err := ReadProcessMemory()
+	if err != nil {
+		return result, err
+	}
+
+	table := build()
+
+	debug.FreeOSMemory()
+	after, err := ReadProcessMemory()
+	if err != nil {
+		return result, err
+	}
+	runtime.KeepAlive(table)
+
+	result.Before, result.After = before, after
+	return result, nil
+}
+
+// runMemoryProbe runs the memory probe of the named case in a new process
+// of the test binary, so that the memory of earlier cases, which the Go
+// runtime does not always return to the OS, does not count.
+func runMemoryProbe(name string, prefixes int) (MemoryProbeResult, error) {
+	var result MemoryProbeResult
+
+	cmd := exec.Command(os.Args[0],
+		"-test.run=^TestMemoryProbeChild$",
+		"-test.count=1",
+		"-memory-probe="+name,
+		"-memory-probe-prefixes="+strconv.Itoa(prefixes))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return result, fmt.Errorf("memory probe %s: %w\n%s%s", name, err, out, stderr.Bytes())
+	}
+
+	for line := range strings.Lines(string(out)) {
+		if data, ok := strings.CutPrefix(line, memoryProbeMarker); ok {
+			err := json.Unmarshal([]byte(data), &result)
+			return result, err
+		}
+	}
+	return result, fmt.Errorf("memory probe %s: no result in output\n%s", name, out)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	memoryProbe         = flag.String("memory-probe", "", "case measured by TestMemoryProbeChild, set by runMemoryProbe")
+	memoryProbePrefixes = flag.Int("memory-probe-prefixes", 1000_000, "number of prefixes loaded by TestMemoryProbeChild")
+)
+
+// memoryProbeCase is a table measured by the memory probe, named by
+// dataset and implementation.
+type memoryProbeCase struct {
+	name     string
+	prefixes func(n int) []netip.Prefix
+	load     func(prefixes []netip.Prefix, values []string) (func(netip.Addr) bool, error)
+}
+
+// memoryProbeCases returns the tables measured by the memory probe.
+func memoryProbeCases() []memoryProbeCase {
+	var cases []memoryProbeCase
+	for _, ds := range prefixDatasets() {
+		for _, impl := range stringTableImplementations() {
+			if impl.ipv4Only && strings.HasPrefix(ds.name, "ipv6") {
+				continue
+			}
+			cases = append(cases, memoryProbeCase{ds.name + "/" + impl.name, ds.prefixes, impl.load})
+		}
+	}
+	return cases
+}
+
+// TestMemoryProbeChild builds the table of the case given with
+// -memory-probe and prints its memory usage. It runs in a subprocess
+// started by runMemoryProbe
+func TestMemoryProbeChild(t *testing.T) {
+	if *memoryProbe == "" {
+		t.Skip("started by runMemoryProbe with -memory-probe")
+	}
+
+	for _, c := range memoryProbeCases() {
+		if c.name != *memoryProbe {
+			continue
+		}
+
+		// The dataset is generated before the first measurement, as in
+		// the benchmarks, and the values by the build.
+		prefixes := c.prefixes(*memoryProbePrefixes)
+		result, err := measureMemory(len(prefixes), func() any {
+			lookup, err := c.load(prefixes, datacenterValues(len(prefixes)))
+			require.NoError(t, err)
+			return lookup
+		})
+		require.NoError(t, err)
+		runtime.KeepAlive(prefixes)
+
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		fmt.Printf("%s%s\n", memoryProbeMarker, data)
+		return
+	}
+	t.Fatalf("unknown memory probe %q", *memoryProbe)
+}
+
+// TestParseProcKB tests parsing of /proc/self/status and smaps_rollup
+// fields
+func TestParseProcKB(t *testing.T) {
+	status := "Name:\tlpm-benchmark.test\nVmHWM:\t    1684 kB\nVmRSS:\t    1536 kB\nThreads:\t5\n"
+	var rss, hwm int64
+	require.NoError(t, parseProcKB(strings.NewReader(status), map[string]*int64{"VmRSS": &rss, "VmHWM": &hwm}))
+	assert.Equal(t, int64(1536*1024), rss)
+	assert.Equal(t, int64(1684*1024), hwm)
+
+	rollup := "562e3a013000-7fffb4d73000 ---p 00000000 00:00 0    [rollup]\nRss:                1408 kB\nPss:                 470 kB\nPss_Anon:            104 kB\nAnonymous:           104 kB\n"
+	var pss, anon int64
+	require.NoError(t, parseProcKB(strings.NewReader(rollup), map[string]*int64{"Pss": &pss, "Anonymous": &anon}))
+	assert.Equal(t, int64(470*1024), pss)
+	assert.Equal(t, int64(104*1024), anon)
+
+	assert.Error(t, parseProcKB(strings.NewReader(status), map[string]*int64{"VmSwap": &rss}), "missing field")
+	assert.Error(t, parseProcKB(strings.NewReader("VmRSS:\tmany kB\n"), map[string]*int64{"VmRSS": &rss}))
+	assert.Error(t, parseProcKB(strings.NewReader("VmRSS:\t1536 MB\n"), map[string]*int64{"VmRSS": &rss}))
+}
+
+// TestRunMemoryProbe tests a memory probe in a subprocess with a small
+// table
+func TestRunMemoryProbe(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the memory probe reads /proc")
+	}
+
+	result, err := runMemoryProbe("ipv4_1M_prefixes/maptrie", 100_000)
+	require.NoError(t, err)
+	assert.Equal(t, 100_000, result.Prefixes)
+
+	growth := result.Growth()
+	assert.Positive(t, growth.Heap)
+	assert.Positive(t, growth.RSS)
+	assert.Positive(t, growth.Anonymous)
+	assert.GreaterOrEqual(t, growth.PeakRSS, growth.RSS)
+
+	_, err = runMemoryProbe("ipv4_1M_prefixes/unknown", 10)
+	assert.Error(t, err)
+}
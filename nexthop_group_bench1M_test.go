@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"testing"
+
+	"github.com/sakateka/lpm"
+)
+
+// groupValue encodes a group ID as an lpm value, which can only be a
+// string.
+func groupValue(id NextHopGroupID) string {
+	return string(binary.LittleEndian.AppendUint32(nil, uint32(id)))
+}
+
+// groupFromValue decodes a group ID stored by groupValue.
+func groupFromValue(value string) NextHopGroupID {
+	return NextHopGroupID(uint32(value[0]) | uint32(value[1])<<8 | uint32(value[2])<<16 | uint32(value[3])<<24)
+}
+
+// BenchmarkNextHopGroupFIB1M benchmarks memory and lookups of 1M prefixes
+// with ECMP next hop groups drawn from 8 next hops, stored as group IDs
+// in lpm, MapTrie and the radix trie, versus one string per prefix as in
+// the other benchmarks and, for MapTrie, one member slice per prefix.
+// groups is the number of distinct next hop groups.
+//
+// The strings and member slices are created by the load, so heap-bytes
+// includes them.
+func BenchmarkNextHopGroupFIB1M(b *testing.B) {
+	datasets := []struct {
+		name     string
+		prefixes []netip.Prefix
+		addrs    []netip.Addr
+	}{
+		{"ipv4_1M_prefixes", randomIPv4Prefixes(1000_000), randomIPv4Addrs(1000)},
+		{"ipv6_1M_prefixes", randomIPv6Prefixes(1000_000), randomIPv6Addrs(1000)},
+	}
+	memberSets := ecmpMemberSets(1000_000, 8)
+
+	// Each load returns a lookup of an address and a flow hash, and the
+	// number of groups if the table uses them.
+	implementations := []struct {
+		name string
+		load func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error)
+	}{
+		{
+			name: "lpm/strings",
+			load: func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error) {
+				table := lpm.New()
+				for i, prefix := range prefixes {
+					table.Insert(prefix, fmt.Sprintf("DC%d", i))
+				}
+				return func(addr netip.Addr, _ uint32) bool {
+					_, ok := table.Lookup(addr)
+					return ok
+				}, 0, nil
+			},
+		},
+		{
+			// lpm cannot delete prefixes, so it is loaded once with the
+			// group IDs instead of being used behind a FIB.
+			name: "lpm/groups",
+			load: func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error) {
+				groups := NewNextHopGroups()
+				table := lpm.New()
+				for i, prefix := range prefixes {
+					id, err := groups.Acquire(memberSets[i])
+					if err != nil {
+						return nil, 0, fmt.Errorf("Acquire: %w", err)
+					}
+					table.Insert(prefix, groupValue(id))
+				}
+				return func(addr netip.Addr, hash uint32) bool {
+					value, ok := table.Lookup(addr)
+					if ok {
+						_ = groups.Resolve(groupFromValue(value), hash)
+					}
+					return ok
+				}, groups.Len(), nil
+			},
+		},
+		{
+			name: "maptrie/strings",
+			load: func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error) {
+				trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+				for i, prefix := range prefixes {
+					value := fmt.Sprintf("DC%d", i)
+					trie.InsertOrUpdate(prefix, onEmptyString(value), onUpdateString(value))
+				}
+				return func(addr netip.Addr, _ uint32) bool {
+					_, _, ok := trie.Lookup(addr)
+					return ok
+				}, 0, nil
+			},
+		},
+		{
+			name: "maptrie/members",
+			load: func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error) {
+				trie := NewMapTrie[netip.Prefix, netip.Addr, []NextHopMember](0)
+				for i, prefix := range prefixes {
+					members := append([]NextHopMember(nil), memberSets[i]...)
+					trie.InsertOrUpdate(prefix, func() []NextHopMember { return members },
+						func([]NextHopMember) []NextHopMember { return members })
+				}
+				return func(addr netip.Addr, hash uint32) bool {
+					_, members, ok := trie.Lookup(addr)
+					if ok {
+						_ = members[hash%uint32(len(members))].NextHop
+					}
+					return ok
+				}, 0, nil
+			},
+		},
+		{
+			name: "maptrie/groups",
+			load: func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error) {
+				return loadGroupFIB(newMapTrieTable[NextHopGroupID](), prefixes, memberSets)
+			},
+		},
+		{
+			name: "radix_trie/strings",
+			load: func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error) {
+				trie := NewRadixTrie[string]()
+				for i, prefix := range prefixes {
+					trie.Insert(prefix, fmt.Sprintf("DC%d", i))
+				}
+				return func(addr netip.Addr, _ uint32) bool {
+					_, _, ok := trie.Lookup(addr)
+					return ok
+				}, 0, nil
+			},
+		},
+		{
+			name: "radix_trie/groups",
+			load: func(prefixes []netip.Prefix) (func(netip.Addr, uint32) bool, int, error) {
+				return loadGroupFIB(NewRadixTrie[NextHopGroupID](), prefixes, memberSets)
+			},
+		},
+	}
+
+	for _, ds := range datasets {
+		for _, impl := range implementations {
+			b.Run(ds.name+"/"+impl.name, func(b *testing.B) {
+				// Measure memory before insertion
+				runtime.GC()
+				var memBefore runtime.MemStats
+				runtime.ReadMemStats(&memBefore)
+
+				lookup, groups, err := impl.load(ds.prefixes)
+				if err != nil {
+					b.Fatalf("load: %v", err)
+				}
+
+				// Measure memory after insertion
+				runtime.GC()
+				var memAfter runtime.MemStats
+				runtime.ReadMemStats(&memAfter)
+
+				allocDiff := memAfter.Alloc - memBefore.Alloc
+				b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB), groups: %d",
+					len(ds.prefixes), allocDiff, float64(allocDiff)/(1024*1024), groups)
+
+				b.ResetTimer()
+				b.ReportAllocs()
+				captureProfiles(b)
+
+				idx := 0
+				foundCount := 0
+				for b.Loop() {
+					if lookup(ds.addrs[idx], uint32(idx)*2654435761) {
+						foundCount++
+					}
+					idx = (idx + 1) % len(ds.addrs)
+				}
+
+				if foundCount == 0 {
+					b.Fatalf("No successful lookups in %d iterations", b.N)
+				}
+
+				b.ReportMetric(float64(allocDiff), "heap-bytes")
+				b.ReportMetric(float64(groups), "groups")
+			})
+		}
+	}
+}
+
+// loadGroupFIB loads the prefixes with their member sets into a FIB on
+// top of table.
+func loadGroupFIB(table fibTable[NextHopGroupID], prefixes []netip.Prefix,
+	memberSets [][]NextHopMember) (func(netip.Addr, uint32) bool, int, error) {
+	fib := NewFIB(table)
+	for i, prefix := range prefixes {
+		if err := fib.Set(prefix, memberSets[i]); err != nil {
+			return nil, 0, fmt.Errorf("Set: %w", err)
+		}
+	}
+	return func(addr netip.Addr, hash uint32) bool {
+		_, _, ok := fib.Lookup(addr, hash)
+		return ok
+	}, fib.Groups().Len(), nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// nextHopBuckets is the number of hash buckets of a next hop group. The
+// members share the buckets in proportion to their weights.
+const nextHopBuckets = 64
+
+// NextHopGroupID identifies a next hop group in NextHopGroups.
+type NextHopGroupID uint32
+
+// NextHopMember is a next hop of a group with its ECMP weight.
+type NextHopMember struct {
+	NextHop netip.Addr
+	Weight  uint32
+}
+
+// nextHopGroup is a deduplicated set of members.
+type nextHopGroup struct {
+	members []NextHopMember
+	// buckets maps a flow hash to the index of a member.
+	buckets [nextHopBuckets]uint8
+	refs    int
+	key     string
+}
+
+// NextHopGroups deduplicates next hop member sets into small group IDs.
+//
+// Groups are reference counted: Acquire returns the ID of an existing
+// group with the same members, and the ID is reused once the last
+// reference is released.
+type NextHopGroups struct {
+	groups []nextHopGroup
+	ids    map[string]NextHopGroupID
+	free   []NextHopGroupID
+}
+
+// NewNextHopGroups returns an empty NextHopGroups.
+func NewNextHopGroups() *NextHopGroups {
+	return &NextHopGroups{ids: map[string]NextHopGroupID{}}
+}
+
+// Acquire returns the group of the members and takes a reference to it.
+//
+// The order of members does not matter, and members with the same next
+// hop are merged by adding their weights.
+func (g *NextHopGroups) Acquire(members []NextHopMember) (NextHopGroupID, error) {
+	members, err := canonicalMembers(members)
+	if err != nil {
+		return 0, err
+	}
+
+	key := membersKey(members)
+	if id, ok := g.ids[key]; ok {
+		g.groups[id].refs++
+		return id, nil
+	}
+
+	group := nextHopGroup{members: members, buckets: memberBuckets(members), refs: 1, key: key}
+
+	var id NextHopGroupID
+	if n := len(g.free); n > 0 {
+		id, g.free = g.free[n-1], g.free[:n-1]
+		g.groups[id] = group
+	} else {
+		id = NextHopGroupID(len(g.groups))
+		g.groups = append(g.groups, group)
+	}
+	g.ids[key] = id
+
+	return id, nil
+}
+
+// Release drops a reference to the group and frees it with the last one.
+func (g *NextHopGroups) Release(id NextHopGroupID) {
+	group := &g.groups[id]
+	if group.refs == 0 {
+		panic(fmt.Sprintf("NextHopGroups: release of free group %d", id))
+	}
+
+	if group.refs--; group.refs == 0 {
+		delete(g.ids, group.key)
+		*group = nextHopGroup{}
+		g.free = append(g.free, id)
+	}
+}
+
+// Members returns the members of the group ordered by next hop.
+func (g *NextHopGroups) Members(id NextHopGroupID) []NextHopMember {
+	return slices.Clone(g.groups[id].members)
+}
+
+// Refs returns the number of references to the group.
+func (g *NextHopGroups) Refs(id NextHopGroupID) int {
+	return g.groups[id].refs
+}
+
+// Resolve returns the member of the group a flow hash is forwarded to.
+func (g *NextHopGroups) Resolve(id NextHopGroupID, hash uint32) netip.Addr {
+	group := &g.groups[id]
+	return group.members[group.buckets[hash%nextHopBuckets]].NextHop
+}
+
+// Len returns the number of groups in use.
+func (g *NextHopGroups) Len() int {
+	return len(g.ids)
+}
+
+// canonicalMembers returns the members sorted by next hop with duplicates
+// merged.
+func canonicalMembers(members []NextHopMember) ([]NextHopMember, error) {
+	if len(members) == 0 {
+		return nil, errors.New("next hop group without members")
+	}
+
+	out := make([]NextHopMember, 0, len(members))
+	for _, m := range members {
+		if !m.NextHop.IsValid() {
+			return nil, errors.New("invalid next hop")
+		}
+		if m.Weight == 0 {
+			return nil, fmt.Errorf("next hop %s with zero weight", m.NextHop)
+		}
+		out = append(out, m)
+	}
+	slices.SortFunc(out, func(a, b NextHopMember) int {
+		return a.NextHop.Compare(b.NextHop)
+	})
+
+	merged := out[:1]
+	for _, m := range out[1:] {
+		if last := &merged[len(merged)-1]; last.NextHop == m.NextHop {
+			last.Weight += m.Weight
+		} else {
+			merged = append(merged, m)
+		}
+	}
+
+	if len(merged) > nextHopBuckets {
+		return nil, fmt.Errorf("%d next hops exceed %d buckets", len(merged), nextHopBuckets)
+	}
+	return slices.Clip(merged), nil
+}
+
+// membersKey encodes canonical members as a map key.
+func membersKey(members []NextHopMember) string {
+	key := make([]byte, 0, len(members)*24)
+	for _, m := range members {
+		addr, _ := m.NextHop.MarshalBinary()
+		key = append(key, byte(len(addr)))
+		key = append(key, addr...)
+		key = binary.BigEndian.AppendUint32(key, m.Weight)
+	}
+	return string(key)
+}
+
+// memberBuckets spreads the buckets over the members in proportion to
+// their weights, giving the buckets left by rounding down to the members
+// with the largest remainders.
+func memberBuckets(members []NextHopMember) [nextHopBuckets]uint8 {
+	var total uint64
+	for _, m := range members {
+		total += uint64(m.Weight)
+	}
+
+	counts := make([]int, len(members))
+	remainders := make([]uint64, len(members))
+	assigned := 0
+	for idx, m := range members {
+		share := uint64(m.Weight) * nextHopBuckets
+		counts[idx] = int(share / total)
+		remainders[idx] = share % total
+		assigned += counts[idx]
+	}
+
+	order := make([]int, len(members))
+	for idx := range order {
+		order[idx] = idx
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(remainders[b], remainders[a])
+	})
+	for _, idx := range order[:nextHopBuckets-assigned] {
+		counts[idx]++
+	}
+
+	var buckets [nextHopBuckets]uint8
+	bucket := 0
+	for idx, count := range counts {
+		for range count {
+			buckets[bucket] = uint8(idx)
+			bucket++
+		}
+	}
+	return buckets
+}
+
+// fibTable is the prefix table a FIB stores group IDs in. Get returns the
+// value of the exact prefix.
+type fibTable[V any] interface {
+	prefixTable[V]
+	Get(prefix netip.Prefix) (V, bool)
+}
+
+// FIB maps prefixes to next hop groups. The underlying table only stores
+// group IDs, the members live once per group in NextHopGroups.
+type FIB struct {
+	table  fibTable[NextHopGroupID]
+	groups *NextHopGroups
+}
+
+// NewFIB returns an empty FIB storing group IDs in table.
+func NewFIB(table fibTable[NextHopGroupID]) *FIB {
+	return &FIB{table: table, groups: NewNextHopGroups()}
+}
+
+// Set points the prefix to the group of the members.
+func (f *FIB) Set(prefix netip.Prefix, members []NextHopMember) error {
+	id, err := f.groups.Acquire(members)
+	if err != nil {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+
+	// Release the previous group after acquiring the new one, so that an
+	// unchanged group is not freed and recreated.
+	if old, ok := f.table.Get(prefix); ok {
+		f.groups.Release(old)
+	}
+	f.table.Insert(prefix, id)
+	return nil
+}
+
+// Delete removes the prefix and reports whether it was present.
+func (f *FIB) Delete(prefix netip.Prefix) bool {
+	id, ok := f.table.Get(prefix)
+	if !ok {
+		return false
+	}
+
+	f.table.Delete(prefix)
+	f.groups.Release(id)
+	return true
+}
+
+// Apply applies a best path change of a RIB, with a single next hop per
+// prefix.
+func (f *FIB) Apply(update FIBUpdate) error {
+	if update.Kind == DiffRemoved {
+		f.Delete(update.Prefix)
+		return nil
+	}
+	return f.Set(update.Prefix, []NextHopMember{{NextHop: update.New, Weight: 1}})
+}
+
+// Lookup returns the longest prefix containing the address and the next
+// hop the flow hash is forwarded to.
+func (f *FIB) Lookup(addr netip.Addr, hash uint32) (netip.Prefix, netip.Addr, bool) {
+	prefix, id, ok := f.table.Lookup(addr)
+	if !ok {
+		return prefix, netip.Addr{}, false
+	}
+	return prefix, f.groups.Resolve(id, hash), true
+}
+
+// LookupGroup returns the longest prefix containing the address and its
+// group.
+func (f *FIB) LookupGroup(addr netip.Addr) (netip.Prefix, NextHopGroupID, bool) {
+	return f.table.Lookup(addr)
+}
+
+// Groups returns the next hop groups of the FIB.
+func (f *FIB) Groups() *NextHopGroups {
+	return f.groups
+}
+
+// Len returns the number of prefixes.
+func (f *FIB) Len() int {
+	return f.table.Len()
+}
+
+// MultipathMembers returns the ECMP members of paths ordered from the best
+// to the worst, as returned by RIB.Paths: the next hops of all paths as
+// good as the best one by preference and metric, with weight 1 each.
+func MultipathMembers(paths []Path) []NextHopMember {
+	var members []NextHopMember
+	for _, path := range paths {
+		if path.Preference != paths[0].Preference || path.Metric != paths[0].Metric {
+			break
+		}
+		if !slices.ContainsFunc(members, func(m NextHopMember) bool { return m.NextHop == path.NextHop }) {
+			members = append(members, NextHopMember{NextHop: path.NextHop, Weight: 1})
+		}
+	}
+	return members
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fibTableImplementations returns the tables a FIB can store group IDs in
+func fibTableImplementations() []struct {
+	name     string
+	newTable func() fibTable[NextHopGroupID]
+} {
+	return []struct {
+		name     string
+		newTable func() fibTable[NextHopGroupID]
+	}{
+		{"maptrie", func() fibTable[NextHopGroupID] { return newMapTrieTable[NextHopGroupID]() }},
+		{"radix_trie", func() fibTable[NextHopGroupID] { return NewRadixTrie[NextHopGroupID]() }},
+		{"binary_trie", func() fibTable[NextHopGroupID] { return NewBinaryTrie[NextHopGroupID]() }},
+	}
+}
+
+// TestNextHopGroups tests deduplication, reference counting and ID reuse
+func TestNextHopGroups(t *testing.T) {
+	hop1, hop2, hop3 := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("2001:db8::1")
+	groups := NewNextHopGroups()
+
+	a, err := groups.Acquire([]NextHopMember{{hop2, 1}, {hop1, 1}})
+	require.NoError(t, err)
+	b, err := groups.Acquire([]NextHopMember{{hop1, 1}, {hop2, 1}})
+	require.NoError(t, err)
+	assert.Equal(t, a, b, "member order does not matter")
+	assert.Equal(t, 2, groups.Refs(a))
+	assert.Equal(t, []NextHopMember{{hop1, 1}, {hop2, 1}}, groups.Members(a))
+
+	// Duplicated next hops are merged.
+	c, err := groups.Acquire([]NextHopMember{{hop1, 1}, {hop3, 1}, {hop1, 2}})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, c)
+	assert.Equal(t, []NextHopMember{{hop1, 3}, {hop3, 1}}, groups.Members(c))
+	d, err := groups.Acquire([]NextHopMember{{hop3, 1}, {hop1, 3}})
+	require.NoError(t, err)
+	assert.Equal(t, c, d)
+	require.Equal(t, 2, groups.Len())
+
+	groups.Release(a)
+	groups.Release(a)
+	assert.Equal(t, 1, groups.Len())
+	assert.Panics(t, func() { groups.Release(a) })
+
+	// The freed ID is reused for the next new group.
+	e, err := groups.Acquire([]NextHopMember{{hop3, 5}})
+	require.NoError(t, err)
+	assert.Equal(t, a, e)
+	assert.Equal(t, hop3, groups.Resolve(e, 12345))
+
+	for _, members := range [][]NextHopMember{
+		nil,
+		{{netip.Addr{}, 1}},
+		{{hop1, 0}},
+	} {
+		_, err := groups.Acquire(members)
+		assert.Error(t, err, "%v", members)
+	}
+	tooMany := make([]NextHopMember, nextHopBuckets+1)
+	for idx := range tooMany {
+		tooMany[idx] = NextHopMember{netip.AddrFrom4([4]byte{10, 0, 0, byte(idx)}), 1}
+	}
+	_, err = groups.Acquire(tooMany)
+	assert.Error(t, err)
+}
+
+// TestNextHopGroupBuckets tests that hashes are spread over the members
+// in proportion to their weights
+func TestNextHopGroupBuckets(t *testing.T) {
+	tests := []struct {
+		weights []uint32
+		want    []int
+	}{
+		{[]uint32{1}, []int{64}},
+		{[]uint32{1, 1}, []int{32, 32}},
+		{[]uint32{1, 1, 1}, []int{22, 21, 21}},
+		{[]uint32{1, 3}, []int{16, 48}},
+		{[]uint32{1, 1000}, []int{0, 64}},
+		{[]uint32{5, 2, 1}, []int{40, 16, 8}},
+	}
+
+	for _, tt := range tests {
+		members := make([]NextHopMember, len(tt.weights))
+		for idx, weight := range tt.weights {
+			members[idx] = NextHopMember{netip.AddrFrom4([4]byte{10, 0, 0, byte(idx)}), weight}
+		}
+		groups := NewNextHopGroups()
+		id, err := groups.Acquire(members)
+		require.NoError(t, err)
+
+		got := make([]int, len(members))
+		for hash := range uint32(nextHopBuckets) {
+			got[groups.Resolve(id, hash).As4()[3]]++
+		}
+		assert.Equal(t, tt.want, got, "weights %v", tt.weights)
+
+		// Hashes beyond the bucket count wrap around.
+		assert.Equal(t, groups.Resolve(id, 7), groups.Resolve(id, 7+nextHopBuckets*1000))
+	}
+}
+
+// TestFIB tests the FIB on top of every table with RIB updates and ECMP
+// groups
+func TestFIB(t *testing.T) {
+	hop1, hop2 := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+
+	for _, impl := range fibTableImplementations() {
+		t.Run(impl.name, func(t *testing.T) {
+			fib := NewFIB(impl.newTable())
+			rib := NewRIB(func(u FIBUpdate) { require.NoError(t, fib.Apply(u)) })
+
+			prefix := netip.MustParsePrefix("10.0.0.0/8")
+			rib.InsertOrUpdate(prefix, Path{Source: "peer1", Preference: 100, NextHop: hop1})
+			rib.InsertOrUpdate(netip.MustParsePrefix("10.1.0.0/16"), Path{Source: "peer1", Preference: 100, NextHop: hop1})
+			require.Equal(t, 2, fib.Len())
+			require.Equal(t, 1, fib.Groups().Len(), "both prefixes share one group")
+
+			_, hop, ok := fib.Lookup(netip.MustParseAddr("10.2.0.1"), 0)
+			require.True(t, ok)
+			assert.Equal(t, hop1, hop)
+
+			// An equal cost path turns the prefix into an ECMP group.
+			rib.InsertOrUpdate(prefix, Path{Source: "peer2", Preference: 100, NextHop: hop2})
+			require.NoError(t, fib.Set(prefix, MultipathMembers(rib.Paths(prefix))))
+			require.Equal(t, 2, fib.Groups().Len())
+
+			seen := map[netip.Addr]int{}
+			for hash := range uint32(nextHopBuckets) {
+				_, hop, ok := fib.Lookup(netip.MustParseAddr("10.2.0.1"), hash)
+				require.True(t, ok)
+				seen[hop]++
+			}
+			assert.Equal(t, map[netip.Addr]int{hop1: 32, hop2: 32}, seen)
+			_, hop, _ = fib.Lookup(netip.MustParseAddr("10.1.0.1"), 5)
+			assert.Equal(t, hop1, hop, "the more specific prefix keeps its group")
+
+			// Setting the same members keeps the group.
+			_, before, _ := fib.LookupGroup(netip.MustParseAddr("10.2.0.1"))
+			require.NoError(t, fib.Set(prefix, []NextHopMember{{hop2, 1}, {hop1, 1}}))
+			_, after, _ := fib.LookupGroup(netip.MustParseAddr("10.2.0.1"))
+			assert.Equal(t, before, after)
+			assert.Equal(t, 1, fib.Groups().Refs(after))
+
+			assert.Error(t, fib.Set(prefix, nil))
+
+			// Withdrawing the only path of a prefix removes it and
+			// releases its group.
+			rib.UpdateOrDelete(netip.MustParsePrefix("10.1.0.0/16"), "peer1")
+			require.Equal(t, 1, fib.Len())
+			require.Equal(t, 1, fib.Groups().Len())
+			assert.False(t, fib.Delete(netip.MustParsePrefix("10.1.0.0/16")))
+
+			require.True(t, fib.Delete(prefix))
+			assert.Equal(t, 0, fib.Groups().Len())
+			_, _, ok = fib.Lookup(netip.MustParseAddr("10.2.0.1"), 0)
+			assert.False(t, ok)
+		})
+	}
+}
+
+// TestFIBRandomGroups checks lookups and reference counts after random
+// group changes
+func TestFIBRandomGroups(t *testing.T) {
+	prefixes := referencePrefixes(1000)
+	addrs := referenceAddrs(prefixes, 1000)
+	memberSets := ecmpMemberSets(len(prefixes), 8)
+	rng := rand.New(rand.NewSource(50))
+
+	for _, impl := range fibTableImplementations() {
+		t.Run(impl.name, func(t *testing.T) {
+			fib := NewFIB(impl.newTable())
+			reference := NewMapTrie[netip.Prefix, netip.Addr, []NextHopMember](0)
+
+			for range 3 * len(prefixes) {
+				idx := rng.Intn(len(prefixes))
+				prefix := prefixes[idx]
+				if rng.Intn(4) == 0 {
+					fib.Delete(prefix)
+					reference.UpdateOrDelete(prefix, func([]NextHopMember) ([]NextHopMember, bool) { return nil, true })
+					continue
+				}
+				members := memberSets[rng.Intn(len(memberSets))]
+				require.NoError(t, fib.Set(prefix, members))
+				reference.InsertOrUpdate(prefix, func() []NextHopMember { return members },
+					func([]NextHopMember) []NextHopMember { return members })
+			}
+
+			require.Equal(t, reference.Len(), fib.Len())
+			for _, addr := range addrs {
+				wantPrefix, members, wantOk := reference.Lookup(addr)
+				prefix, id, ok := fib.LookupGroup(addr)
+				require.Equal(t, wantOk, ok, "Lookup(%s)", addr)
+				if !ok {
+					continue
+				}
+				require.Equal(t, wantPrefix, prefix, "Lookup(%s)", addr)
+				want, err := canonicalMembers(members)
+				require.NoError(t, err)
+				require.Equal(t, want, fib.Groups().Members(id), "Lookup(%s)", addr)
+			}
+
+			// Every prefix holds one reference to its group.
+			total := 0
+			for _, id := range fib.Groups().ids {
+				total += fib.Groups().Refs(id)
+			}
+			assert.Equal(t, fib.Len(), total)
+		})
+	}
+}
@@ -81,6 +81,7 @@ func BenchmarkPatriciaInsert1M(b *testing.B) {
 	for _, bm := range benchmarks {
 		b.Run(bm.name, func(b *testing.B) {
 			b.ReportAllocs()
+			captureProfiles(b)
 
 			if bm.isV6 {
 				tree := string_tree.NewTreeV6()
@@ -204,6 +205,10 @@ func BenchmarkPatriciaLookup1M(b *testing.B) {
 
 	for _, bm := range benchmarks {
 		b.Run(bm.name, func(b *testing.B) {
+			stats := EstimatePatriciaStats(bm.prefixes)
+			b.Logf("patricia.v4Nodes: %d, patricia.v6Nodes: %d, patricia.tags: %d, estimated size: %d",
+				stats.IPv4Nodes, stats.IPv6Nodes, stats.Tags, stats.TotalSize())
+
 			if bm.isV6 {
 				// Measure memory before insertion
 				runtime.GC()
@@ -233,6 +238,7 @@ func BenchmarkPatriciaLookup1M(b *testing.B) {
 
 				b.ResetTimer()
 				b.ReportAllocs()
+				captureProfiles(b)
 
 				idx := 0
 				foundCount := 0
@@ -248,6 +254,10 @@ func BenchmarkPatriciaLookup1M(b *testing.B) {
 				if foundCount == 0 {
 					b.Fatalf("No successful lookups in %d iterations", b.N)
 				}
+
+				b.ReportMetric(float64(stats.TotalSize()), "table-bytes")
+				b.ReportMetric(float64(allocDiff), "heap-bytes")
+				b.ReportMetric(float64(stats.IPv4Nodes+stats.IPv6Nodes), "nodes")
 			} else {
 				// Measure memory before insertion
 				runtime.GC()
@@ -277,6 +287,7 @@ func BenchmarkPatriciaLookup1M(b *testing.B) {
 
 				b.ResetTimer()
 				b.ReportAllocs()
+				captureProfiles(b)
 
 				idx := 0
 				foundCount := 0
@@ -292,6 +303,10 @@ func BenchmarkPatriciaLookup1M(b *testing.B) {
 				if foundCount == 0 {
 					b.Fatalf("No successful lookups in %d iterations", b.N)
 				}
+
+				b.ReportMetric(float64(stats.TotalSize()), "table-bytes")
+				b.ReportMetric(float64(allocDiff), "heap-bytes")
+				b.ReportMetric(float64(stats.IPv4Nodes+stats.IPv6Nodes), "nodes")
 			}
 		})
 	}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+// randomSetPrefixes generates n long prefixes at uniformly random
+// addresses, like allowlist entries. Unlike the sequential 1M datasets,
+// which collapse into a few blocks, they stay fragmented in a set.
+func randomSetPrefixes(n, bitLen int, seed int64) []netip.Prefix {
+	rng := rand.New(rand.NewSource(seed))
+	prefixes := make([]netip.Prefix, n)
+	for i := range prefixes {
+		var addr netip.Addr
+		var prefixLen int
+		if bitLen == 32 {
+			var a [4]byte
+			rng.Read(a[:])
+			addr, prefixLen = netip.AddrFrom4(a), 20+rng.Intn(13)
+		} else {
+			a := [16]byte{0x20, 0x01, 0x0d, 0xb8}
+			rng.Read(a[4:])
+			addr, prefixLen = netip.AddrFrom16(a), 56+rng.Intn(73)
+		}
+		prefixes[i] = netip.PrefixFrom(addr, prefixLen).Masked()
+	}
+	return prefixes
+}
+
+// BenchmarkPrefixSet1M benchmarks building sets from 1M prefixes and the
+// set operations between two sets of 500K prefixes
+func BenchmarkPrefixSet1M(b *testing.B) {
+	datasets := []struct {
+		name   string
+		bitLen int
+	}{
+		{"ipv4_1M_prefixes", 32},
+		{"ipv6_1M_prefixes", 128},
+	}
+
+	for _, ds := range datasets {
+		prefixes := append(randomSetPrefixes(500_000, ds.bitLen, 42), randomSetPrefixes(500_000, ds.bitLen, 43)...)
+		half := len(prefixes) / 2
+		x, y := NewPrefixSet(prefixes[:half]...), NewPrefixSet(prefixes[half:]...)
+
+		b.Run(ds.name+"/build", func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			var set PrefixSet
+			for b.Loop() {
+				set = NewPrefixSet(prefixes...)
+			}
+
+			b.ReportMetric(float64(set.Len()), "prefixes-out")
+		})
+
+		ops := []struct {
+			name string
+			op   func() PrefixSet
+		}{
+			{"union", func() PrefixSet { return x.Union(y) }},
+			{"intersect", func() PrefixSet { return x.Intersect(y) }},
+			{"subtract", func() PrefixSet { return x.Subtract(y) }},
+		}
+		for _, op := range ops {
+			b.Run(ds.name+"/"+op.name, func(b *testing.B) {
+				b.ReportAllocs()
+				captureProfiles(b)
+
+				var set PrefixSet
+				for b.Loop() {
+					set = op.op()
+				}
+
+				b.ReportMetric(float64(set.Len()), "prefixes-out")
+			})
+		}
+
+		b.Run(ds.name+"/contains", func(b *testing.B) {
+			// Half of the lookups hit the first address of a prefix.
+			addrs := make([]netip.Addr, 0, 1000)
+			for idx := range 500 {
+				addrs = append(addrs, prefixes[idx*(len(prefixes)/500)].Addr())
+			}
+			if ds.bitLen == 32 {
+				addrs = append(addrs, randomIPv4Addrs(500)...)
+			} else {
+				addrs = append(addrs, randomIPv6Addrs(500)...)
+			}
+			set := x.Union(y)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			foundCount := 0
+			for b.Loop() {
+				if set.Contains(addrs[idx]) {
+					foundCount++
+				}
+				idx = (idx + 1) % len(addrs)
+			}
+
+			if foundCount == 0 {
+				b.Fatalf("No addresses contained in %d iterations", b.N)
+			}
+		})
+	}
+}
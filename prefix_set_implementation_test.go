@@ -0,0 +1,199 @@
+package main
+
+import (
+	"iter"
+	"math/bits"
+	"net/netip"
+	"slices"
+)
+
+// setMember is the range value of addresses that belong to a PrefixSet.
+const setMember uint32 = 0
+
+// PrefixSet is a set of addresses described by prefixes, for address
+// space algebra on ACLs and allowlists.
+//
+// The set is kept as flattened ranges per family (see flattenPrefixes)
+// whose value is setMember or noValue. Adjacent ranges never share a
+// value, so the representation is canonical and Prefixes returns the
+// minimal CIDR list.
+type PrefixSet struct {
+	v4 []addrRange
+	v6 []addrRange
+}
+
+// NewPrefixSet returns the set of addresses covered by the prefixes.
+func NewPrefixSet(prefixes ...netip.Prefix) PrefixSet {
+	values := make([]uint32, len(prefixes))
+	for idx := range values {
+		values[idx] = setMember
+	}
+
+	return PrefixSet{
+		v4: flattenPrefixes(familyPrefixes(prefixes, values, 32)),
+		v6: flattenPrefixes(familyPrefixes(prefixes, values, 128)),
+	}
+}
+
+// PrefixSetFromTable returns the set of addresses covered by the prefixes
+// of a table, such as MapTrie.All or RadixTrie.All. Values are ignored.
+func PrefixSetFromTable[V any](table iter.Seq2[netip.Prefix, V]) PrefixSet {
+	var prefixes []netip.Prefix
+	for prefix := range table {
+		prefixes = append(prefixes, prefix)
+	}
+	return NewPrefixSet(prefixes...)
+}
+
+// family returns the ranges of the given family, which cover the whole
+// family also for the zero PrefixSet.
+func (s PrefixSet) family(bitLen int) []addrRange {
+	ranges := s.v4
+	if bitLen == 128 {
+		ranges = s.v6
+	}
+	if len(ranges) == 0 {
+		return flattenPrefixes(nil, nil, bitLen)
+	}
+	return ranges
+}
+
+// Contains reports whether the address belongs to the set.
+func (s PrefixSet) Contains(addr netip.Addr) bool {
+	ranges := s.family(addr.BitLen())
+
+	idx, found := slices.BinarySearchFunc(ranges, addr, func(r addrRange, addr netip.Addr) int {
+		return r.Start.Compare(addr)
+	})
+	if !found {
+		idx--
+	}
+	return ranges[idx].Value == setMember
+}
+
+// Union returns the addresses in s or other.
+func (s PrefixSet) Union(other PrefixSet) PrefixSet {
+	return s.combine(other, func(a, b bool) bool { return a || b })
+}
+
+// Intersect returns the addresses in both s and other.
+func (s PrefixSet) Intersect(other PrefixSet) PrefixSet {
+	return s.combine(other, func(a, b bool) bool { return a && b })
+}
+
+// Subtract returns the addresses in s that are not in other.
+func (s PrefixSet) Subtract(other PrefixSet) PrefixSet {
+	return s.combine(other, func(a, b bool) bool { return a && !b })
+}
+
+// combine applies a membership operation to both families.
+func (s PrefixSet) combine(other PrefixSet, op func(a, b bool) bool) PrefixSet {
+	return PrefixSet{
+		v4: combineRanges(s.family(32), other.family(32), op),
+		v6: combineRanges(s.family(128), other.family(128), op),
+	}
+}
+
+// combineRanges merges two flattened range lists of the same family,
+// which both start at the first address of the family.
+func combineRanges(a, b []addrRange, op func(a, b bool) bool) []addrRange {
+	out := make([]addrRange, 0, len(a)+len(b))
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var start netip.Addr
+		if j == len(b) || (i < len(a) && a[i].Start.Less(b[j].Start)) {
+			start = a[i].Start
+		} else {
+			start = b[j].Start
+		}
+		for i < len(a) && a[i].Start == start {
+			i++
+		}
+		for j < len(b) && b[j].Start == start {
+			j++
+		}
+
+		value := noValue
+		if op(a[i-1].Value == setMember, b[j-1].Value == setMember) {
+			value = setMember
+		}
+		if n := len(out); n > 0 && out[n-1].Value == value {
+			continue
+		}
+		out = append(out, addrRange{Start: start, Value: value})
+	}
+
+	return out
+}
+
+// Prefixes returns the minimal list of prefixes covering exactly the set,
+// IPv4 before IPv6 and each family in address order.
+func (s PrefixSet) Prefixes() []netip.Prefix {
+	var out []netip.Prefix
+	for _, bitLen := range []int{32, 128} {
+		ranges := s.family(bitLen)
+		for idx, r := range ranges {
+			if r.Value != setMember {
+				continue
+			}
+			var last netip.Addr
+			if idx+1 < len(ranges) {
+				last = ranges[idx+1].Start.Prev()
+			} else {
+				last = prefixLastAddr(netip.PrefixFrom(r.Start, 0))
+			}
+			out = appendRangePrefixes(out, r.Start, last)
+		}
+	}
+	return out
+}
+
+// Len returns the number of prefixes returned by Prefixes.
+func (s PrefixSet) Len() int {
+	return len(s.Prefixes())
+}
+
+// Equal reports whether both sets contain the same addresses.
+func (s PrefixSet) Equal(other PrefixSet) bool {
+	return slices.Equal(s.family(32), other.family(32)) && slices.Equal(s.family(128), other.family(128))
+}
+
+// appendRangePrefixes appends the fewest prefixes that cover exactly the
+// addresses from first to last.
+func appendRangePrefixes(dst []netip.Prefix, first, last netip.Addr) []netip.Prefix {
+	bitLen := first.BitLen()
+	for {
+		// Start with the largest block aligned at first and shrink it
+		// until it ends within the range.
+		prefixLen := bitLen - addrTrailingZeros(first)
+		for prefixLastAddr(netip.PrefixFrom(first, prefixLen)).Compare(last) > 0 {
+			prefixLen++
+		}
+
+		prefix := netip.PrefixFrom(first, prefixLen)
+		dst = append(dst, prefix)
+
+		end := prefixLastAddr(prefix)
+		if end == last {
+			return dst
+		}
+		first = end.Next()
+	}
+}
+
+// addrTrailingZeros returns the number of trailing zero bits of the
+// address, which is its bit length for the unspecified address.
+func addrTrailingZeros(addr netip.Addr) int {
+	a := addrBytes(addr)
+	n := addr.BitLen() / 8
+
+	zeros := 0
+	for idx := n - 1; idx >= 0; idx-- {
+		if a[idx] != 0 {
+			return zeros + bits.TrailingZeros8(a[idx])
+		}
+		zeros += 8
+	}
+	return zeros
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math/rand"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parsePrefixes parses a list of CIDRs
+func parsePrefixes(cidrs ...string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for idx, cidr := range cidrs {
+		prefixes[idx] = netip.MustParsePrefix(cidr)
+	}
+	return prefixes
+}
+
+// prefixStrings formats prefixes for comparisons
+func prefixStrings(prefixes []netip.Prefix) []string {
+	out := make([]string, len(prefixes))
+	for idx, prefix := range prefixes {
+		out[idx] = prefix.String()
+	}
+	return out
+}
+
+// TestPrefixSetOperations tests the set operations on hand-made sets
+func TestPrefixSetOperations(t *testing.T) {
+	a := NewPrefixSet(parsePrefixes("10.0.0.0/8", "192.168.0.0/24", "2001:db8::/32")...)
+	b := NewPrefixSet(parsePrefixes("10.128.0.0/9", "11.0.0.0/8", "192.168.1.0/24", "2001:db8:1::/48")...)
+
+	tests := []struct {
+		name string
+		set  PrefixSet
+		want []string
+	}{
+		{
+			name: "union merges adjacent blocks",
+			set:  a.Union(b),
+			want: []string{"10.0.0.0/7", "192.168.0.0/23", "2001:db8::/32"},
+		},
+		{
+			name: "intersection",
+			set:  a.Intersect(b),
+			want: []string{"10.128.0.0/9", "2001:db8:1::/48"},
+		},
+		{
+			name: "subtraction splits blocks",
+			set:  a.Subtract(b),
+			want: []string{
+				"10.0.0.0/9", "192.168.0.0/24",
+				"2001:db8::/48", "2001:db8:2::/47", "2001:db8:4::/46", "2001:db8:8::/45",
+				"2001:db8:10::/44", "2001:db8:20::/43", "2001:db8:40::/42", "2001:db8:80::/41",
+				"2001:db8:100::/40", "2001:db8:200::/39", "2001:db8:400::/38", "2001:db8:800::/37",
+				"2001:db8:1000::/36", "2001:db8:2000::/35", "2001:db8:4000::/34", "2001:db8:8000::/33",
+			},
+		},
+		{
+			name: "nested and duplicated prefixes collapse",
+			set:  NewPrefixSet(parsePrefixes("10.0.0.0/8", "10.1.0.0/16", "10.0.0.0/8", "10.0.0.0/9")...),
+			want: []string{"10.0.0.0/8"},
+		},
+		{
+			name: "whole address space",
+			set:  NewPrefixSet(parsePrefixes("0.0.0.0/1", "128.0.0.0/1", "::/0")...),
+			want: []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			name: "unaligned range",
+			set:  NewPrefixSet(parsePrefixes("10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/32")...),
+			want: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/32"},
+		},
+		{
+			name: "empty",
+			set:  a.Subtract(a),
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, prefixStrings(tt.set.Prefixes()))
+			assert.Equal(t, len(tt.want), tt.set.Len())
+		})
+	}
+
+	assert.True(t, a.Contains(netip.MustParseAddr("10.1.2.3")))
+	assert.False(t, a.Contains(netip.MustParseAddr("11.1.2.3")))
+	assert.False(t, PrefixSet{}.Contains(netip.MustParseAddr("::1")))
+	assert.True(t, PrefixSet{}.Equal(NewPrefixSet()))
+	assert.True(t, a.Union(b).Equal(b.Union(a)))
+}
+
+// TestPrefixSetFromTable tests building sets from table iterators
+func TestPrefixSetFromTable(t *testing.T) {
+	prefixes := referencePrefixes(1000)
+
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	radix := NewRadixTrie[string]()
+	for _, prefix := range prefixes {
+		trie.InsertOrUpdate(prefix, onEmptyString("DC"), onUpdateString("DC"))
+		radix.Insert(prefix, "DC")
+	}
+
+	want := NewPrefixSet(prefixes...)
+	assert.True(t, want.Equal(PrefixSetFromTable(trie.All())))
+	assert.True(t, want.Equal(PrefixSetFromTable(radix.All())))
+}
+
+// containsAny is the naive membership test the set operations are
+// checked against.
+func containsAny(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestPrefixSetProperties checks membership of random and boundary
+// addresses against the set semantics, and that results are minimal
+func TestPrefixSetProperties(t *testing.T) {
+	rng := rand.New(rand.NewSource(46))
+
+	for round := range 20 {
+		all := referencePrefixes(300)
+		rng.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+		aPrefixes, bPrefixes := all[:len(all)/2], all[len(all)/2:]
+		a, b := NewPrefixSet(aPrefixes...), NewPrefixSet(bPrefixes...)
+
+		// Probe around every prefix boundary as well as random addresses.
+		addrs := referenceAddrs(all, 300)
+		for _, prefix := range all {
+			first, last := prefix.Masked().Addr(), prefixLastAddr(prefix)
+			for _, addr := range []netip.Addr{first, first.Prev(), last, last.Next()} {
+				if addr.IsValid() {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+
+		ops := []struct {
+			name string
+			set  PrefixSet
+			want func(a, b bool) bool
+		}{
+			{"union", a.Union(b), func(a, b bool) bool { return a || b }},
+			{"intersect", a.Intersect(b), func(a, b bool) bool { return a && b }},
+			{"subtract", a.Subtract(b), func(a, b bool) bool { return a && !b }},
+			{"subtract_reverse", b.Subtract(a), func(a, b bool) bool { return b && !a }},
+		}
+
+		for _, op := range ops {
+			result := op.set.Prefixes()
+			for _, addr := range addrs {
+				want := op.want(containsAny(aPrefixes, addr), containsAny(bPrefixes, addr))
+				require.Equal(t, want, op.set.Contains(addr), "round %d %s: Contains(%s)", round, op.name, addr)
+				require.Equal(t, want, containsAny(result, addr), "round %d %s: prefixes contain %s", round, op.name, addr)
+			}
+
+			// The prefixes are sorted, disjoint and no two of them can be
+			// merged into their parent.
+			require.True(t, slices.IsSortedFunc(result, comparePrefixes), "round %d %s", round, op.name)
+			for idx := 1; idx < len(result); idx++ {
+				prev, cur := result[idx-1], result[idx]
+				require.False(t, prev.Overlaps(cur), "round %d %s: %s overlaps %s", round, op.name, prev, cur)
+				if prev.Bits() == cur.Bits() && prev.Bits() > 0 {
+					parent, _ := prev.Addr().Prefix(prev.Bits() - 1)
+					require.False(t, parent.Contains(cur.Addr()), "round %d %s: %s and %s merge", round, op.name, prev, cur)
+				}
+			}
+
+			// Rebuilding the set from its prefixes is a no-op.
+			require.True(t, op.set.Equal(NewPrefixSet(result...)), "round %d %s", round, op.name)
+		}
+
+		// De Morgan style identities on the canonical representation.
+		require.True(t, a.Union(b).Subtract(a.Intersect(b)).Equal(a.Subtract(b).Union(b.Subtract(a))), "round %d", round)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+var profileDir = flag.String("profile-dir", "", "directory to write CPU, heap and allocation profiles of every 1M benchmark case to, empty disables profiling")
+
+// profileIndexName is the file in the profile directory listing the
+// profiles of every case, one JSON object per line.
+const profileIndexName = "profiles.jsonl"
+
+// ProfileIndexEntry is a line of the profile index. File names are
+// relative to the profile directory.
+type ProfileIndexEntry struct {
+	Benchmark string `json:"benchmark"`
+	CPU       string `json:"cpu,omitempty"`
+	Heap      string `json:"heap"`
+	Allocs    string `json:"allocs"`
+}
+
+// profileBaseName returns the file name prefix of the profiles of a
+// benchmark, with the sub-benchmark separators and other characters that
+// are unsafe in file names replaced by '-'.
+func profileBaseName(benchmark string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, benchmark)
+}
+
+// captureProfiles profiles the rest of the benchmark if -profile-dir is
+// set, and does nothing otherwise. Call it right before the measured
+// loop.
+//
+// The CPU profile covers the benchmark from the call until it returns.
+// The heap and allocation profiles are written when it returns. As
+// runtime/pprof reports the heap of the last completed collection, the
+// heap profile shows the table of the case if the benchmark collected
+// garbage after loading it. Allocation profiles are cumulative for the
+// process; compare a case to the previous one with pprof -diff_base.
+func captureProfiles(b *testing.B) {
+	if *profileDir == "" {
+		return
+	}
+	if err := os.MkdirAll(*profileDir, 0o755); err != nil {
+		b.Fatalf("profile dir: %v", err)
+	}
+
+	base := profileBaseName(b.Name())
+	entry := ProfileIndexEntry{
+		Benchmark: b.Name(),
+		CPU:       base + ".cpu.pprof",
+		Heap:      base + ".heap.pprof",
+		Allocs:    base + ".allocs.pprof",
+	}
+
+	cpu, err := os.Create(filepath.Join(*profileDir, entry.CPU))
+	if err != nil {
+		b.Fatalf("CPU profile: %v", err)
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		// Another CPU profile is active, e.g. with -cpuprofile.
+		b.Logf("CPU profile not captured: %v", err)
+		cpu.Close()
+		os.Remove(cpu.Name())
+		cpu, entry.CPU = nil, ""
+	}
+
+	b.Cleanup(func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				b.Errorf("CPU profile: %v", err)
+			}
+		}
+		for _, p := range []struct{ name, file string }{{"heap", entry.Heap}, {"allocs", entry.Allocs}} {
+			if err := writeProfile(p.name, filepath.Join(*profileDir, p.file)); err != nil {
+				b.Errorf("%s profile: %v", p.name, err)
+			}
+		}
+		if err := appendProfileIndex(*profileDir, entry); err != nil {
+			b.Errorf("profile index: %v", err)
+		}
+		b.Logf("Profiles: cpu=%s heap=%s allocs=%s", entry.CPU, entry.Heap, entry.Allocs)
+	})
+}
+
+// writeProfile writes the named runtime/pprof profile to path.
+func writeProfile(name, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// appendProfileIndex appends an entry to the profile index in dir.
+func appendProfileIndex(dir string, entry ProfileIndexEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, profileIndexName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProfileBaseName tests the file names of the profiles of a benchmark
+func TestProfileBaseName(t *testing.T) {
+	assert.Equal(t, "BenchmarkLPMLookup1M-ipv4_1M_prefixes", profileBaseName("BenchmarkLPMLookup1M/ipv4_1M_prefixes"))
+	assert.Equal(t, "BenchmarkVRFTable1M-1000x1000-shared_maptrie-01", profileBaseName("BenchmarkVRFTable1M/1000x1000/shared_maptrie#01"))
+	assert.Equal(t, "BenchmarkX-a-b-c", profileBaseName("BenchmarkX/a b:c"))
+}
+
+// TestCaptureProfiles tests that a benchmark case writes its profiles and
+// an index entry referencing them
+func TestCaptureProfiles(t *testing.T) {
+	dir := t.TempDir()
+	old := *profileDir
+	*profileDir = dir
+	t.Cleanup(func() { *profileDir = old })
+
+	prefixes := referencePrefixes(1000)
+	addrs := referenceAddrs(prefixes, 100)
+	var name string
+	testing.Benchmark(func(b *testing.B) {
+		b.Run("ipv4/maptrie", func(b *testing.B) {
+			name = b.Name()
+			trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+			for _, prefix := range prefixes {
+				trie.InsertOrUpdate(prefix, onEmptyString("DC"), onUpdateString("DC"))
+			}
+			runtime.GC()
+
+			b.ReportAllocs()
+			captureProfiles(b)
+			idx := 0
+			for b.Loop() {
+				_, _, _ = trie.Lookup(addrs[idx])
+				idx = (idx + 1) % len(addrs)
+			}
+		})
+	})
+
+	f, err := os.Open(filepath.Join(dir, profileIndexName))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []ProfileIndexEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry ProfileIndexEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	require.NotEmpty(t, entries)
+
+	// Every run of the case overwrites the same files.
+	base := profileBaseName(name)
+	for _, entry := range entries {
+		assert.Equal(t, ProfileIndexEntry{
+			Benchmark: name,
+			CPU:       base + ".cpu.pprof",
+			Heap:      base + ".heap.pprof",
+			Allocs:    base + ".allocs.pprof",
+		}, entry)
+	}
+	for _, file := range []string{entries[0].CPU, entries[0].Heap, entries[0].Allocs} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		require.NoError(t, err)
+		require.Greater(t, len(data), 2, file)
+		assert.Equal(t, []byte{0x1f, 0x8b}, data[:2], "%s is a gzipped pprof profile", file)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"iter"
+	"math/bits"
+	"net/netip"
+)
+
+// commonPrefixLen returns the number of leading bits shared by both
+// prefixes, limited by the shorter prefix length.
+func commonPrefixLen(a, b netip.Prefix) int {
+	limit := min(a.Bits(), b.Bits())
+	x, y := addrBytes(a.Addr()), addrBytes(b.Addr())
+
+	common := 0
+	for idx := range x {
+		if diff := x[idx] ^ y[idx]; diff != 0 {
+			common += bits.LeadingZeros8(diff)
+			break
+		}
+		common += 8
+	}
+
+	return min(common, limit)
+}
+
+// radixNode is a node of the RadixTrie.
+//
+// Nodes without a value are glue nodes that only exist to join two
+// subtrees diverging at the node prefix length.
+type radixNode[V any] struct {
+	prefix   netip.Prefix
+	children [2]*radixNode[V]
+	value    V
+	ok       bool
+}
+
+// RadixTrie is a path-compressed binary radix trie over netip.Prefix.
+//
+// Unlike BinaryTrie it skips chains of single-child nodes, so every node
+// either holds a value or has exactly two children.
+//
+// The type parameter V represents the value type stored for each prefix.
+type RadixTrie[V any] struct {
+	v4   *radixNode[V]
+	v6   *radixNode[V]
+	size int
+}
+
+// NewRadixTrie returns an empty RadixTrie.
+func NewRadixTrie[V any]() *RadixTrie[V] {
+	return &RadixTrie[V]{}
+}
+
+// root returns a pointer to the root link for the family of the given
+// address.
+func (t *RadixTrie[V]) root(addr netip.Addr) **radixNode[V] {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// Insert adds a new prefix or replaces the value of an existing one.
+func (t *RadixTrie[V]) Insert(prefix netip.Prefix, value V) {
+	prefix = prefix.Masked()
+	a := addrBytes(prefix.Addr())
+
+	link := t.root(prefix.Addr())
+	for {
+		n := *link
+		if n == nil {
+			*link = &radixNode[V]{prefix: prefix, value: value, ok: true}
+			t.size++
+			return
+		}
+
+		common := commonPrefixLen(n.prefix, prefix)
+		switch {
+		case common == n.prefix.Bits() && common == prefix.Bits():
+			if !n.ok {
+				t.size++
+			}
+			n.value = value
+			n.ok = true
+			return
+
+		case common == n.prefix.Bits():
+			// The node covers the prefix, descend.
+			link = &n.children[addrBit(&a, common)]
+			continue
+
+		case common == prefix.Bits():
+			// The prefix covers the node, insert above it.
+			b := addrBytes(n.prefix.Addr())
+			node := &radixNode[V]{prefix: prefix, value: value, ok: true}
+			node.children[addrBit(&b, common)] = n
+			*link = node
+
+		default:
+			// The paths diverge, join them with a glue node.
+			glue := &radixNode[V]{prefix: netip.PrefixFrom(prefix.Addr(), common).Masked()}
+			glue.children[addrBit(&a, common)] = &radixNode[V]{prefix: prefix, value: value, ok: true}
+			glue.children[1-addrBit(&a, common)] = n
+			*link = glue
+		}
+
+		t.size++
+		return
+	}
+}
+
+// find returns the link pointing to the node of exactly the given prefix
+// and the link to its parent node, or nil links if there is no such node.
+func (t *RadixTrie[V]) find(prefix netip.Prefix) (link, parentLink **radixNode[V]) {
+	a := addrBytes(prefix.Addr())
+
+	link = t.root(prefix.Addr())
+	for *link != nil {
+		n := *link
+		if n.prefix.Bits() > prefix.Bits() || !n.prefix.Contains(prefix.Addr()) {
+			return nil, nil
+		}
+		if n.prefix.Bits() == prefix.Bits() {
+			return link, parentLink
+		}
+		parentLink = link
+		link = &n.children[addrBit(&a, n.prefix.Bits())]
+	}
+
+	return nil, nil
+}
+
+// Get returns the value stored for exactly the given prefix.
+func (t *RadixTrie[V]) Get(prefix netip.Prefix) (V, bool) {
+	if link, _ := t.find(prefix.Masked()); link != nil && (*link).ok {
+		return (*link).value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Delete removes the prefix from the trie, merging glue nodes that are no
+// longer needed.
+//
+// Returns false if the prefix was not found.
+func (t *RadixTrie[V]) Delete(prefix netip.Prefix) bool {
+	link, parentLink := t.find(prefix.Masked())
+	if link == nil || !(*link).ok {
+		return false
+	}
+
+	n := *link
+	t.size--
+
+	switch {
+	case n.children[0] != nil && n.children[1] != nil:
+		// Keep the node as glue.
+		var zero V
+		n.value = zero
+		n.ok = false
+		return true
+	case n.children[0] != nil:
+		*link = n.children[0]
+		return true
+	case n.children[1] != nil:
+		*link = n.children[1]
+		return true
+	}
+
+	*link = nil
+
+	// A glue parent left with a single child is replaced by that child.
+	if parentLink != nil {
+		parent := *parentLink
+		if !parent.ok {
+			if parent.children[0] != nil {
+				*parentLink = parent.children[0]
+			} else {
+				*parentLink = parent.children[1]
+			}
+		}
+	}
+
+	return true
+}
+
+// Lookup searches the trie for a value that matches the longest possible
+// prefix for the given address.
+//
+// If no match is found, the function returns an invalid prefix, the zero
+// value and false.
+func (t *RadixTrie[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	a := addrBytes(addr)
+
+	var best *radixNode[V]
+	n := *t.root(addr)
+	for n != nil && n.prefix.Contains(addr) {
+		if n.ok {
+			best = n
+		}
+		if n.prefix.Bits() == addr.BitLen() {
+			break
+		}
+		n = n.children[addrBit(&a, n.prefix.Bits())]
+	}
+
+	if best == nil {
+		var zero V
+		return netip.Prefix{}, zero, false
+	}
+
+	return best.prefix, best.value, true
+}
+
+// Len returns the total number of prefixes stored in the trie.
+func (t *RadixTrie[V]) Len() int {
+	return t.size
+}
+
+// All returns an iterator over all prefixes and values, IPv4 before IPv6
+// and each family in address order with covering prefixes first.
+func (t *RadixTrie[V]) All() iter.Seq2[netip.Prefix, V] {
+	var walk func(n *radixNode[V], yield func(netip.Prefix, V) bool) bool
+	walk = func(n *radixNode[V], yield func(netip.Prefix, V) bool) bool {
+		if n == nil {
+			return true
+		}
+		if n.ok && !yield(n.prefix, n.value) {
+			return false
+		}
+		return walk(n.children[0], yield) && walk(n.children[1], yield)
+	}
+
+	return func(yield func(netip.Prefix, V) bool) {
+		_ = walk(t.v4, yield) && walk(t.v6, yield)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// checkRadixTrieInvariants verifies that every node either holds a value
+// or joins two subtrees, and that children are covered by their parents.
+func checkRadixTrieInvariants[V any](t *testing.T, trie *RadixTrie[V]) {
+	t.Helper()
+
+	var walk func(n *radixNode[V])
+	walk = func(n *radixNode[V]) {
+		if !n.ok {
+			require.NotNil(t, n.children[0], "glue node %s without left child", n.prefix)
+			require.NotNil(t, n.children[1], "glue node %s without right child", n.prefix)
+		}
+		for bit, child := range n.children {
+			if child == nil {
+				continue
+			}
+			require.Greater(t, child.prefix.Bits(), n.prefix.Bits())
+			require.True(t, n.prefix.Contains(child.prefix.Addr()),
+				"%s is not covered by %s", child.prefix, n.prefix)
+			a := addrBytes(child.prefix.Addr())
+			require.Equal(t, bit, addrBit(&a, n.prefix.Bits()))
+			walk(child)
+		}
+	}
+
+	for _, root := range []*radixNode[V]{trie.v4, trie.v6} {
+		if root != nil {
+			walk(root)
+		}
+	}
+}
+
+func TestRadixTrieOperations(t *testing.T) {
+	testPrefixTableOperations(t, func() prefixTable[string] { return NewRadixTrie[string]() })
+}
+
+func TestRadixTrieMatchesMapTrie(t *testing.T) {
+	trie := NewRadixTrie[int]()
+	testPrefixTableMatchesMapTrie(t, trie)
+	checkRadixTrieInvariants(t, trie)
+}
+
+// TestRadixTrieStructure verifies glue nodes are created and merged back
+func TestRadixTrieStructure(t *testing.T) {
+	trie := NewRadixTrie[string]()
+	trie.Insert(netip.MustParsePrefix("10.1.0.0/16"), "A")
+	trie.Insert(netip.MustParsePrefix("10.2.0.0/16"), "B")
+	checkRadixTrieInvariants(t, trie)
+
+	// The two /16 prefixes diverge at bit 14 and are joined by glue.
+	require.False(t, trie.v4.ok)
+	require.Equal(t, netip.MustParsePrefix("10.0.0.0/14"), trie.v4.prefix)
+
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/14"), "GLUE")
+	checkRadixTrieInvariants(t, trie)
+	require.True(t, trie.v4.ok)
+	require.Equal(t, 3, trie.Len())
+
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/8"), "TOP")
+	checkRadixTrieInvariants(t, trie)
+	require.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), trie.v4.prefix)
+
+	require.True(t, trie.Delete(netip.MustParsePrefix("10.0.0.0/14")))
+	require.True(t, trie.Delete(netip.MustParsePrefix("10.1.0.0/16")))
+	checkRadixTrieInvariants(t, trie)
+
+	// The glue node is no longer needed and the /16 hangs off the /8.
+	require.Equal(t, netip.MustParsePrefix("10.2.0.0/16"), trie.v4.children[0].prefix)
+
+	value, ok := trie.Get(netip.MustParsePrefix("10.2.0.0/16"))
+	require.True(t, ok)
+	require.Equal(t, "B", value)
+	_, ok = trie.Get(netip.MustParsePrefix("10.0.0.0/14"))
+	require.False(t, ok)
+}
+
+// BenchmarkRadixTrieLookup benchmarks lookup performance
+func BenchmarkRadixTrieLookup(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []string
+		lookups  []string
+	}{
+		{
+			name:     "single_prefix_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"192.168.1.1"},
+		},
+		{
+			name: "100_prefixes_deep_lookup",
+			prefixes: func() []string {
+				var prefixes []string
+				for i := range 100 {
+					prefixes = append(prefixes,
+						fmt.Sprintf("10.%d.0.0/16", i%256))
+				}
+				return prefixes
+			}(),
+			lookups: []string{"10.50.0.1", "10.99.0.1", "10.0.0.1"},
+		},
+		{
+			name:     "ipv6_lookup",
+			prefixes: []string{"2001:db8::/32", "2001:db8:1::/48"},
+			lookups:  []string{"2001:db8:1::1"},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			trie := NewRadixTrie[string]()
+			for j, cidr := range bm.prefixes {
+				trie.Insert(netip.MustParsePrefix(cidr), fmt.Sprintf("DC%d", j))
+			}
+
+			addrs := make([]netip.Addr, len(bm.lookups))
+			for i, lookup := range bm.lookups {
+				addrs[i] = netip.MustParseAddr(lookup)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for b.Loop() {
+				for _, addr := range addrs {
+					_, _, _ = trie.Lookup(addr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"cmp"
+	"math/rand"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/kentik/patricia/string_tree"
+	"github.com/sakateka/lpm"
+	"github.com/stretchr/testify/require"
+)
+
+// prefixTable is the minimal table API shared by the in-repo reference
+// tries.
+type prefixTable[V any] interface {
+	Insert(prefix netip.Prefix, value V)
+	Delete(prefix netip.Prefix) bool
+	Lookup(addr netip.Addr) (netip.Prefix, V, bool)
+	Len() int
+}
+
+// referencePrefixes returns a mix of random IPv4 and IPv6 prefixes, with
+// short prefixes added so that lookups often fall back to covering routes.
+func referencePrefixes(n int) []netip.Prefix {
+	prefixes := append(randomIPv4Prefixes(n), randomIPv6Prefixes(n)...)
+
+	rng := rand.New(rand.NewSource(44))
+	for range n / 10 {
+		v4 := netip.AddrFrom4([4]byte{byte(rng.Intn(256)), byte(rng.Intn(256))})
+		prefixes = append(prefixes, netip.PrefixFrom(v4, rng.Intn(17)).Masked())
+
+		v6 := netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, byte(rng.Intn(256)), byte(rng.Intn(256))})
+		prefixes = append(prefixes, netip.PrefixFrom(v6, 16+rng.Intn(33)).Masked())
+	}
+
+	return prefixes
+}
+
+// referenceAddrs returns random lookup addresses together with the first
+// and last addresses of some of the given prefixes.
+func referenceAddrs(prefixes []netip.Prefix, n int) []netip.Addr {
+	addrs := append(randomIPv4Addrs(n), randomIPv6Addrs(n)...)
+	for idx := 0; idx < len(prefixes); idx += 7 {
+		addrs = append(addrs, prefixes[idx].Addr(), prefixLastAddr(prefixes[idx]))
+	}
+	return addrs
+}
+
+// lpmStaleEntryIssue describes the upstream lpm bug found by the
+// reference model, with its smallest known reproduction in
+// TestLPMStaleEntryIssue.
+const lpmStaleEntryIssue = "github.com/sakateka/lpm v0.0.0-20251005085919-028400854d56 keeps stale entries " +
+	"when a shorter prefix is inserted after a more specific one " +
+	"(0.0.0.0/0, 111.66.0.0/15, 96.0.0.0/4: 111.153.104.99 returns the default route)"
+
+// TestImplementationsMatchReference compares every benchmarked LPM
+// implementation against BinaryTrie used as the reference model
+func TestImplementationsMatchReference(t *testing.T) {
+	prefixes := referencePrefixes(5000)
+	values := datacenterValues(len(prefixes))
+	addrs := referenceAddrs(prefixes, 5000)
+
+	reference := NewBinaryTrie[string]()
+	for idx, prefix := range prefixes {
+		reference.Insert(prefix, values[idx])
+	}
+
+	implementations := []struct {
+		name   string
+		ipv6   bool
+		lookup func() func(netip.Addr) (string, bool)
+	}{
+		{
+			name: "MapTrie",
+			ipv6: true,
+			lookup: func() func(netip.Addr) (string, bool) {
+				trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+				for idx, prefix := range prefixes {
+					trie.InsertOrUpdate(prefix, onEmptyString(values[idx]), onUpdateString(values[idx]))
+				}
+				return func(addr netip.Addr) (string, bool) {
+					_, v, ok := trie.Lookup(addr)
+					return v, ok
+				}
+			},
+		},
+		{
+			name: "LPM",
+			ipv6: true,
+			lookup: func() func(netip.Addr) (string, bool) {
+				// Insert from the shortest prefix to the longest one to
+				// compare the lookup path only, see lpmStaleEntryIssue.
+				order := make([]int, len(prefixes))
+				for idx := range order {
+					order[idx] = idx
+				}
+				slices.SortStableFunc(order, func(a, b int) int {
+					return cmp.Compare(prefixes[a].Bits(), prefixes[b].Bits())
+				})
+
+				table := lpm.New()
+				for _, idx := range order {
+					table.Insert(prefixes[idx], values[idx])
+				}
+				return table.Lookup
+			},
+		},
+		{
+			name: "Patricia",
+			ipv6: true,
+			lookup: func() func(netip.Addr) (string, bool) {
+				v4, v6 := string_tree.NewTreeV4(), string_tree.NewTreeV6()
+				for idx, prefix := range prefixes {
+					if prefix.Addr().Is4() {
+						_, _ = v4.Set(patricia.NewIPv4AddressFromBytes(prefix.Addr().AsSlice(), uint(prefix.Bits())), values[idx])
+					} else {
+						_, _ = v6.Set(patricia.NewIPv6Address(prefix.Addr().AsSlice(), uint(prefix.Bits())), values[idx])
+					}
+				}
+				return func(addr netip.Addr) (string, bool) {
+					var ok bool
+					var v string
+					if addr.Is4() {
+						ok, v = v4.FindDeepestTag(patricia.NewIPv4AddressFromBytes(addr.AsSlice(), 32))
+					} else {
+						ok, v = v6.FindDeepestTag(patricia.NewIPv6Address(addr.AsSlice(), 128))
+					}
+					return v, ok
+				}
+			},
+		},
+		{
+			name: "RadixTrie",
+			ipv6: true,
+			lookup: func() func(netip.Addr) (string, bool) {
+				trie := NewRadixTrie[string]()
+				for idx, prefix := range prefixes {
+					trie.Insert(prefix, values[idx])
+				}
+				return func(addr netip.Addr) (string, bool) {
+					_, v, ok := trie.Lookup(addr)
+					return v, ok
+				}
+			},
+		},
+		{
+			name: "LCTrie",
+			lookup: func() func(netip.Addr) (string, bool) {
+				trie := NewLCTrie[string](DefaultLCTrieConfig())
+				for idx, prefix := range prefixes {
+					trie.InsertOrUpdate(prefix, onEmptyString(values[idx]), onUpdateString(values[idx]))
+				}
+				return func(addr netip.Addr) (string, bool) {
+					_, v, ok := trie.Lookup(addr)
+					return v, ok
+				}
+			},
+		},
+		{
+			name: "DXR",
+			lookup: func() func(netip.Addr) (string, bool) {
+				var v4Prefixes []netip.Prefix
+				var v4Values []string
+				for idx, prefix := range prefixes {
+					if prefix.Addr().Is4() {
+						v4Prefixes = append(v4Prefixes, prefix)
+						v4Values = append(v4Values, values[idx])
+					}
+				}
+				dxr, err := NewDXR(16, v4Prefixes, v4Values)
+				require.NoError(t, err)
+				return dxr.Lookup
+			},
+		},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			lookup := impl.lookup()
+			for _, addr := range addrs {
+				if addr.Is6() && !impl.ipv6 {
+					continue
+				}
+				_, want, wantOk := reference.Lookup(addr)
+				got, ok := lookup(addr)
+				require.Equal(t, wantOk, ok, "Lookup(%s)", addr)
+				require.Equal(t, want, got, "Lookup(%s)", addr)
+			}
+		})
+	}
+}
+
+// TestLPMStaleEntryIssue reproduces lpmStaleEntryIssue and fails once
+// upstream fixes it, so that the LPM case of
+// TestImplementationsMatchReference goes back to random insertion order
+func TestLPMStaleEntryIssue(t *testing.T) {
+	table := lpm.New()
+	table.Insert(netip.MustParsePrefix("0.0.0.0/0"), "default")
+	table.Insert(netip.MustParsePrefix("111.66.0.0/15"), "/15")
+	table.Insert(netip.MustParsePrefix("96.0.0.0/4"), "/4")
+
+	got, ok := table.Lookup(netip.MustParseAddr("111.153.104.99"))
+	require.True(t, ok)
+	require.Equal(t, "default", got, "the upstream bug is fixed: %s; "+
+		"drop the sorted insertion of the LPM case of TestImplementationsMatchReference, "+
+		"lpmStaleEntryIssue and this test", lpmStaleEntryIssue)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+// BenchmarkResolverChurn1M benchmarks route churn in a Resolver holding
+// 1M IPv4 BGP routes whose 1,000 next hops resolve through IGP /32 routes
+// inside a covering IGP /12. Every iteration changes one route;
+// fib-updates is the number of FIB updates per iteration.
+func BenchmarkResolverChurn1M(b *testing.B) {
+	const nextHops = 1000
+
+	covering := netip.MustParsePrefix("172.16.0.0/12")
+	coveringHop := netip.MustParseAddr("192.168.255.1")
+	bgpHops := make([]netip.Addr, nextHops)
+	igpRoutes := make([]netip.Prefix, nextHops)
+	for i := range bgpHops {
+		bgpHops[i] = netip.AddrFrom4([4]byte{172, 16, byte(i >> 8), byte(i)})
+		igpRoutes[i] = netip.PrefixFrom(bgpHops[i], 32)
+	}
+	igpHop := func(i int, alternate bool) netip.Addr {
+		if alternate {
+			return netip.AddrFrom4([4]byte{192, 168, 1, byte(i)})
+		}
+		return netip.AddrFrom4([4]byte{192, 168, 0, byte(i)})
+	}
+	prefixes := randomIPv4Prefixes(1000_000)
+
+	fibUpdates := 0
+
+	// Measure memory before insertion
+	runtime.GC()
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+
+	resolver := NewResolver(func(FIBUpdate) { fibUpdates++ })
+	resolver.Insert(covering, ResolverRoute{NextHop: coveringHop})
+	for i, prefix := range igpRoutes {
+		resolver.Insert(prefix, ResolverRoute{NextHop: igpHop(i, false)})
+	}
+	for i, prefix := range prefixes {
+		resolver.Insert(prefix, ResolverRoute{NextHop: bgpHops[i%nextHops], Recursive: true})
+	}
+
+	// Measure memory after insertion
+	runtime.GC()
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
+
+	allocDiff := memAfter.Alloc - memBefore.Alloc
+	b.Logf("Memory: Routes=%d NextHops=%d Alloc=%d bytes (%.2f MB)",
+		resolver.Len(), len(resolver.nextHops), allocDiff, float64(allocDiff)/(1024*1024))
+
+	benchmarks := []struct {
+		name   string
+		routes int
+		change func(i int, up bool)
+	}{
+		{
+			// The IGP route of a next hop goes away, so its BGP routes
+			// resolve through the covering route, and comes back.
+			name:   "igp_flap",
+			routes: nextHops,
+			change: func(i int, up bool) {
+				if up {
+					resolver.Insert(igpRoutes[i], ResolverRoute{NextHop: igpHop(i, false)})
+				} else {
+					resolver.Delete(igpRoutes[i])
+				}
+			},
+		},
+		{
+			name:   "igp_next_hop_change",
+			routes: nextHops,
+			change: func(i int, up bool) {
+				resolver.Insert(igpRoutes[i], ResolverRoute{NextHop: igpHop(i, !up)})
+			},
+		},
+		{
+			name:   "bgp_flap",
+			routes: len(prefixes),
+			change: func(i int, up bool) {
+				if up {
+					resolver.Insert(prefixes[i], ResolverRoute{NextHop: bgpHops[i%nextHops], Recursive: true})
+				} else {
+					resolver.Delete(prefixes[i])
+				}
+			},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run("ipv4_1M_prefixes/"+bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+			fibUpdates = 0
+
+			// Every route goes down in one round and up in the next.
+			idx := 0
+			up := false
+			for b.Loop() {
+				bm.change(idx, up)
+				if idx++; idx == bm.routes {
+					idx = 0
+					up = !up
+				}
+			}
+			b.ReportMetric(float64(fibUpdates)/float64(b.N), "fib-updates")
+
+			// Bring every route up again for the next benchmark.
+			for i := range bm.routes {
+				bm.change(i, true)
+			}
+
+			b.ReportMetric(float64(allocDiff), "heap-bytes")
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"net/netip"
+	"slices"
+)
+
+var (
+	// ErrUnresolved is the resolution error of a next hop without a route.
+	ErrUnresolved = errors.New("next hop is unresolved")
+	// ErrResolutionLoop is the resolution error of a next hop that
+	// resolves through the same route twice.
+	ErrResolutionLoop = errors.New("next hop resolution loop")
+)
+
+// ResolverRoute is the next hop of a route in a Resolver.
+type ResolverRoute struct {
+	NextHop netip.Addr
+	// Recursive routes, such as BGP routes, forward to the resolution of
+	// NextHop through the other routes of the table. Other routes, such
+	// as IGP or connected routes, forward to NextHop directly.
+	Recursive bool
+}
+
+// Resolution is the forwarding entry of a route or a next hop.
+type Resolution struct {
+	// NextHop is the directly reachable next hop, invalid if Err is set.
+	NextHop netip.Addr
+	// Via is the chain of routes the next hop was resolved through, from
+	// the longest match of the next hop to the non-recursive route.
+	Via []netip.Prefix
+	Err error
+}
+
+// equal reports whether both resolutions are the same.
+func (r Resolution) equal(other Resolution) bool {
+	return r.NextHop == other.NextHop && r.Err == other.Err && slices.Equal(r.Via, other.Via)
+}
+
+// nextHopState is the tracked resolution of a next hop of recursive
+// routes.
+type nextHopState struct {
+	resolution Resolution
+	// users are the recursive routes with this next hop.
+	users map[netip.Prefix]struct{}
+}
+
+// Resolver resolves the next hops of recursive routes through the routes
+// of the same MapTrie and keeps the resolutions up to date.
+//
+// Resolutions are tracked per next hop rather than per route, as there
+// are far fewer BGP next hops than BGP routes. A change of a route
+// re-resolves the next hops it contains, whose longest match may change,
+// and the next hops resolved through it. Changes of the forwarding next
+// hop of a route are reported to the FIB callback.
+type Resolver struct {
+	routes   MapTrie[netip.Prefix, netip.Addr, ResolverRoute]
+	nextHops map[netip.Addr]*nextHopState
+	// sorted holds the tracked next hops in address order, to find the
+	// ones inside a prefix.
+	sorted []netip.Addr
+	// dependents maps a route to the next hops resolved through it.
+	dependents map[netip.Prefix]map[netip.Addr]struct{}
+	fib        func(FIBUpdate)
+}
+
+// NewResolver returns an empty Resolver reporting forwarding changes to
+// fib.
+func NewResolver(fib func(FIBUpdate)) *Resolver {
+	return &Resolver{
+		routes:     NewMapTrie[netip.Prefix, netip.Addr, ResolverRoute](0),
+		nextHops:   map[netip.Addr]*nextHopState{},
+		dependents: map[netip.Prefix]map[netip.Addr]struct{}{},
+		fib:        fib,
+	}
+}
+
+// Insert adds the route or replaces the route of the prefix.
+func (r *Resolver) Insert(prefix netip.Prefix, route ResolverRoute) {
+	prefix = prefix.Masked()
+	old := r.Resolve(prefix)
+
+	if current, ok := r.routes[prefix.Bits()][prefix]; ok && current.Recursive {
+		r.untrack(prefix, current.NextHop)
+	}
+	r.routes.InsertOrUpdate(prefix, func() ResolverRoute { return route }, func(ResolverRoute) ResolverRoute { return route })
+	if route.Recursive {
+		r.track(prefix, route.NextHop)
+	}
+
+	r.notify(prefix, old, r.Resolve(prefix))
+	r.propagate(prefix)
+}
+
+// Delete removes the route of the prefix and reports whether there was
+// one.
+func (r *Resolver) Delete(prefix netip.Prefix) bool {
+	prefix = prefix.Masked()
+	route, ok := r.routes[prefix.Bits()][prefix]
+	if !ok {
+		return false
+	}
+	old := r.Resolve(prefix)
+
+	if route.Recursive {
+		r.untrack(prefix, route.NextHop)
+	}
+	delete(r.routes[prefix.Bits()], prefix)
+
+	r.notify(prefix, old, Resolution{Err: ErrUnresolved})
+	r.propagate(prefix)
+	return true
+}
+
+// Resolve returns the forwarding entry of the route of the prefix, with
+// ErrUnresolved if there is no such route.
+func (r *Resolver) Resolve(prefix netip.Prefix) Resolution {
+	prefix = prefix.Masked()
+	route, ok := r.routes[prefix.Bits()][prefix]
+	switch {
+	case !ok:
+		return Resolution{Err: ErrUnresolved}
+	case !route.Recursive:
+		return Resolution{NextHop: route.NextHop}
+	default:
+		return r.nextHops[route.NextHop].resolution
+	}
+}
+
+// Lookup returns the longest prefix containing the address and its
+// forwarding entry.
+func (r *Resolver) Lookup(addr netip.Addr) (netip.Prefix, Resolution, bool) {
+	prefix, _, ok := r.routes.Lookup(addr)
+	if !ok {
+		return prefix, Resolution{Err: ErrUnresolved}, false
+	}
+	return prefix, r.Resolve(prefix), true
+}
+
+// Len returns the number of routes.
+func (r *Resolver) Len() int {
+	return r.routes.Len()
+}
+
+// resolve resolves a next hop through the current routes.
+func (r *Resolver) resolve(addr netip.Addr) Resolution {
+	var via []netip.Prefix
+	for {
+		prefix, route, ok := r.routes.Lookup(addr)
+		if !ok {
+			return Resolution{Via: via, Err: ErrUnresolved}
+		}
+		if slices.Contains(via, prefix) {
+			return Resolution{Via: via, Err: ErrResolutionLoop}
+		}
+
+		via = append(via, prefix)
+		if !route.Recursive {
+			return Resolution{NextHop: route.NextHop, Via: via}
+		}
+		addr = route.NextHop
+	}
+}
+
+// track adds a recursive route to the users of its next hop, resolving
+// the next hop if it is new.
+func (r *Resolver) track(prefix netip.Prefix, addr netip.Addr) {
+	state, ok := r.nextHops[addr]
+	if !ok {
+		state = &nextHopState{users: map[netip.Prefix]struct{}{}}
+		r.nextHops[addr] = state
+
+		idx, _ := slices.BinarySearchFunc(r.sorted, addr, netip.Addr.Compare)
+		r.sorted = slices.Insert(r.sorted, idx, addr)
+		r.setResolution(addr, state, r.resolve(addr))
+	}
+	state.users[prefix] = struct{}{}
+}
+
+// untrack removes a recursive route from the users of its next hop and
+// forgets the next hop with its last user.
+func (r *Resolver) untrack(prefix netip.Prefix, addr netip.Addr) {
+	state := r.nextHops[addr]
+	delete(state.users, prefix)
+	if len(state.users) > 0 {
+		return
+	}
+
+	r.setResolution(addr, state, Resolution{})
+	delete(r.nextHops, addr)
+	idx, _ := slices.BinarySearchFunc(r.sorted, addr, netip.Addr.Compare)
+	r.sorted = slices.Delete(r.sorted, idx, idx+1)
+}
+
+// setResolution updates the resolution of a next hop and the dependents
+// of the routes it is resolved through.
+func (r *Resolver) setResolution(addr netip.Addr, state *nextHopState, resolution Resolution) {
+	for _, prefix := range state.resolution.Via {
+		delete(r.dependents[prefix], addr)
+		if len(r.dependents[prefix]) == 0 {
+			delete(r.dependents, prefix)
+		}
+	}
+
+	state.resolution = resolution
+	for _, prefix := range resolution.Via {
+		if r.dependents[prefix] == nil {
+			r.dependents[prefix] = map[netip.Addr]struct{}{}
+		}
+		r.dependents[prefix][addr] = struct{}{}
+	}
+}
+
+// propagate re-resolves the next hops affected by a change of the route
+// or the forwarding entry of the prefix, and so on for the routes using
+// the next hops whose resolution changed.
+func (r *Resolver) propagate(prefix netip.Prefix) {
+	queue := []netip.Prefix{prefix}
+	for len(queue) > 0 {
+		prefix, queue = queue[0], queue[1:]
+
+		for _, addr := range r.affected(prefix) {
+			state := r.nextHops[addr]
+			resolution := r.resolve(addr)
+			if resolution.equal(state.resolution) {
+				continue
+			}
+
+			old := state.resolution
+			r.setResolution(addr, state, resolution)
+			for _, user := range slices.SortedFunc(maps.Keys(state.users), comparePrefixes) {
+				r.notify(user, old, resolution)
+				queue = append(queue, user)
+			}
+		}
+	}
+}
+
+// affected returns the tracked next hops inside the prefix and the ones
+// resolved through its route, sorted so that updates are reported in a
+// reproducible order.
+func (r *Resolver) affected(prefix netip.Prefix) []netip.Addr {
+	first, _ := slices.BinarySearchFunc(r.sorted, prefix.Addr(), netip.Addr.Compare)
+	last, found := slices.BinarySearchFunc(r.sorted, prefixLastAddr(prefix), netip.Addr.Compare)
+	if found {
+		last++
+	}
+
+	addrs := slices.Clone(r.sorted[first:last])
+	for addr := range r.dependents[prefix] {
+		if !prefix.Contains(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	return addrs
+}
+
+// notify reports a change of the forwarding next hop of the prefix.
+func (r *Resolver) notify(prefix netip.Prefix, old, next Resolution) {
+	if update, ok := nextHopChange(prefix, old.NextHop, next.NextHop); ok && r.fib != nil {
+		r.fib(update)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolverNestedRecursion tests resolution through recursive routes
+// and re-resolution after changes of the covering routes
+func TestResolverNestedRecursion(t *testing.T) {
+	var updates []FIBUpdate
+	resolver := NewResolver(func(u FIBUpdate) { updates = append(updates, u) })
+	takeUpdates := func() map[netip.Prefix]FIBUpdate {
+		out := map[netip.Prefix]FIBUpdate{}
+		for _, u := range updates {
+			out[u.Prefix] = u
+		}
+		updates = nil
+		return out
+	}
+
+	igp := netip.MustParsePrefix("10.0.0.0/24")
+	bgp1 := netip.MustParsePrefix("203.0.113.0/24")
+	bgp2 := netip.MustParsePrefix("198.51.100.0/24")
+	hop1, hop2, hop3 := netip.MustParseAddr("192.168.0.1"), netip.MustParseAddr("192.168.0.2"), netip.MustParseAddr("192.168.0.3")
+
+	// The second BGP route resolves through the first one, which is not
+	// resolved yet.
+	resolver.Insert(bgp2, ResolverRoute{NextHop: netip.MustParseAddr("203.0.113.7"), Recursive: true})
+	resolver.Insert(bgp1, ResolverRoute{NextHop: netip.MustParseAddr("10.0.0.5"), Recursive: true})
+	assert.ErrorIs(t, resolver.Resolve(bgp1).Err, ErrUnresolved)
+	assert.ErrorIs(t, resolver.Resolve(bgp2).Err, ErrUnresolved)
+	assert.Empty(t, takeUpdates())
+
+	resolver.Insert(igp, ResolverRoute{NextHop: hop1})
+	assert.Equal(t, Resolution{NextHop: hop1, Via: []netip.Prefix{igp}}, resolver.Resolve(bgp1))
+	assert.Equal(t, Resolution{NextHop: hop1, Via: []netip.Prefix{bgp1, igp}}, resolver.Resolve(bgp2))
+	assert.Equal(t, map[netip.Prefix]FIBUpdate{
+		igp:  {Kind: DiffAdded, Prefix: igp, New: hop1},
+		bgp1: {Kind: DiffAdded, Prefix: bgp1, New: hop1},
+		bgp2: {Kind: DiffAdded, Prefix: bgp2, New: hop1},
+	}, takeUpdates())
+
+	prefix, resolution, ok := resolver.Lookup(netip.MustParseAddr("198.51.100.1"))
+	require.True(t, ok)
+	assert.Equal(t, bgp2, prefix)
+	assert.Equal(t, hop1, resolution.NextHop)
+
+	// A change of the covering IGP route re-resolves both BGP routes.
+	resolver.Insert(igp, ResolverRoute{NextHop: hop2})
+	assert.Equal(t, map[netip.Prefix]FIBUpdate{
+		igp:  {Kind: DiffChanged, Prefix: igp, Old: hop1, New: hop2},
+		bgp1: {Kind: DiffChanged, Prefix: bgp1, Old: hop1, New: hop2},
+		bgp2: {Kind: DiffChanged, Prefix: bgp2, Old: hop1, New: hop2},
+	}, takeUpdates())
+
+	// So does a more specific route to the next hop.
+	specific := netip.MustParsePrefix("10.0.0.4/30")
+	resolver.Insert(specific, ResolverRoute{NextHop: hop3})
+	assert.Equal(t, Resolution{NextHop: hop3, Via: []netip.Prefix{bgp1, specific}}, resolver.Resolve(bgp2))
+	assert.Len(t, takeUpdates(), 3)
+
+	// A route next to the next hop changes nothing.
+	resolver.Insert(netip.MustParsePrefix("10.0.0.8/30"), ResolverRoute{NextHop: hop1})
+	assert.Len(t, takeUpdates(), 1)
+
+	require.True(t, resolver.Delete(specific))
+	assert.Equal(t, Resolution{NextHop: hop2, Via: []netip.Prefix{bgp1, igp}}, resolver.Resolve(bgp2))
+	takeUpdates()
+
+	// Withdrawing the IGP route leaves both BGP routes unresolved.
+	require.True(t, resolver.Delete(igp))
+	assert.False(t, resolver.Delete(igp))
+	assert.ErrorIs(t, resolver.Resolve(bgp1).Err, ErrUnresolved)
+	assert.ErrorIs(t, resolver.Resolve(bgp2).Err, ErrUnresolved)
+	assert.Equal(t, map[netip.Prefix]FIBUpdate{
+		igp:  {Kind: DiffRemoved, Prefix: igp, Old: hop2},
+		bgp1: {Kind: DiffRemoved, Prefix: bgp1, Old: hop2},
+		bgp2: {Kind: DiffRemoved, Prefix: bgp2, Old: hop2},
+	}, takeUpdates())
+
+	// A BGP route using a next hop tracked for other routes resolves at
+	// once.
+	resolver.Insert(igp, ResolverRoute{NextHop: hop1})
+	bgp3 := netip.MustParsePrefix("2001:db8::/32")
+	resolver.Insert(bgp3, ResolverRoute{NextHop: netip.MustParseAddr("10.0.0.5"), Recursive: true})
+	assert.Equal(t, hop1, resolver.Resolve(bgp3).NextHop)
+
+	// Replacing a recursive route with a direct one stops tracking its
+	// next hop.
+	resolver.Insert(bgp1, ResolverRoute{NextHop: hop3})
+	assert.Equal(t, Resolution{NextHop: hop3, Via: []netip.Prefix{bgp1}}, resolver.Resolve(bgp2))
+	require.True(t, resolver.Delete(bgp3))
+	assert.NotContains(t, resolver.nextHops, netip.MustParseAddr("10.0.0.5"))
+	assert.Equal(t, 4, resolver.Len())
+}
+
+// TestResolverUpdateOrder tests that the same route changes always report
+// the same updates in the same order
+func TestResolverUpdateOrder(t *testing.T) {
+	igp := netip.MustParsePrefix("10.0.0.0/24")
+	run := func() []FIBUpdate {
+		var updates []FIBUpdate
+		resolver := NewResolver(func(u FIBUpdate) { updates = append(updates, u) })
+		resolver.Insert(igp, ResolverRoute{NextHop: netip.MustParseAddr("192.168.0.1")})
+		for i := range 64 {
+			prefix := netip.PrefixFrom(netip.AddrFrom4([4]byte{203, 0, byte(i), 0}), 24)
+			nextHop := netip.AddrFrom4([4]byte{10, 0, 0, byte(i % 16)})
+			resolver.Insert(prefix, ResolverRoute{NextHop: nextHop, Recursive: true})
+		}
+		resolver.Insert(igp, ResolverRoute{NextHop: netip.MustParseAddr("192.168.0.2")})
+		return updates
+	}
+
+	want := run()
+	require.Len(t, want, 2*65)
+	for range 5 {
+		require.Equal(t, want, run())
+	}
+}
+
+// TestResolverLoops tests that resolution loops are detected and resolved
+// once the loop is broken
+func TestResolverLoops(t *testing.T) {
+	var updates []FIBUpdate
+	resolver := NewResolver(func(u FIBUpdate) { updates = append(updates, u) })
+
+	a, b := netip.MustParsePrefix("1.0.0.0/8"), netip.MustParsePrefix("2.0.0.0/8")
+	resolver.Insert(a, ResolverRoute{NextHop: netip.MustParseAddr("2.2.2.2"), Recursive: true})
+	resolver.Insert(b, ResolverRoute{NextHop: netip.MustParseAddr("1.1.1.1"), Recursive: true})
+	assert.ErrorIs(t, resolver.Resolve(a).Err, ErrResolutionLoop)
+	assert.ErrorIs(t, resolver.Resolve(b).Err, ErrResolutionLoop)
+
+	// A route resolving through itself is a loop as well.
+	self := netip.MustParsePrefix("3.0.0.0/8")
+	resolver.Insert(self, ResolverRoute{NextHop: netip.MustParseAddr("3.3.3.3"), Recursive: true})
+	assert.ErrorIs(t, resolver.Resolve(self).Err, ErrResolutionLoop)
+	assert.Empty(t, updates)
+
+	// A more specific route to the next hop of a breaks the loop.
+	hop := netip.MustParseAddr("192.168.0.1")
+	resolver.Insert(netip.MustParsePrefix("2.2.2.0/24"), ResolverRoute{NextHop: hop})
+	assert.Equal(t, hop, resolver.Resolve(a).NextHop)
+	assert.Equal(t, hop, resolver.Resolve(b).NextHop)
+	assert.ErrorIs(t, resolver.Resolve(self).Err, ErrResolutionLoop)
+	assert.Len(t, updates, 3)
+}
+
+// TestResolverRandomChurn checks that the tracked resolutions and the FIB
+// built from the updates match a resolver built from scratch after random
+// route changes
+func TestResolverRandomChurn(t *testing.T) {
+	rng := rand.New(rand.NewSource(52))
+
+	// Routes and next hops share a small address space, so that routes
+	// often resolve through each other and form loops. Next hops in
+	// 12.0.0.0/8 are never covered.
+	randomPrefix := func() netip.Prefix {
+		addr := netip.AddrFrom4([4]byte{byte(10 + rng.Intn(2)), 0, byte(rng.Intn(4)), byte(rng.Intn(16))})
+		return netip.PrefixFrom(addr, 8+rng.Intn(25)).Masked()
+	}
+	randomAddr := func() netip.Addr {
+		first := byte(10 + rng.Intn(2))
+		if rng.Intn(8) == 0 {
+			first = 12
+		}
+		return netip.AddrFrom4([4]byte{first, 0, byte(rng.Intn(4)), byte(rng.Intn(16))})
+	}
+
+	fib := map[netip.Prefix]netip.Addr{}
+	resolver := NewResolver(func(u FIBUpdate) {
+		assert.Equal(t, fib[u.Prefix], u.Old, "%s %s", u.Kind, u.Prefix)
+		if u.Kind == DiffRemoved {
+			delete(fib, u.Prefix)
+		} else {
+			fib[u.Prefix] = u.New
+		}
+	})
+	routes := map[netip.Prefix]ResolverRoute{}
+
+	for round := range 3000 {
+		prefix := randomPrefix()
+		if rng.Intn(4) == 0 {
+			_, want := routes[prefix]
+			require.Equal(t, want, resolver.Delete(prefix), "round %d", round)
+			delete(routes, prefix)
+			continue
+		}
+
+		route := ResolverRoute{NextHop: randomAddr(), Recursive: rng.Intn(4) != 0}
+		resolver.Insert(prefix, route)
+		routes[prefix] = route
+	}
+
+	fresh := NewResolver(nil)
+	for prefix, route := range routes {
+		fresh.Insert(prefix, route)
+	}
+
+	want := map[netip.Prefix]netip.Addr{}
+	errs := map[error]int{}
+	for prefix := range routes {
+		resolution := resolver.Resolve(prefix)
+		require.Equal(t, fresh.Resolve(prefix), resolution, "%s", prefix)
+		if !routes[prefix].Recursive {
+			require.Equal(t, Resolution{NextHop: routes[prefix].NextHop}, resolution, "%s", prefix)
+		}
+		if resolution.Err == nil {
+			want[prefix] = resolution.NextHop
+		}
+		errs[resolution.Err]++
+	}
+	assert.Equal(t, want, fib)
+	assert.Positive(t, errs[nil])
+	assert.Positive(t, errs[ErrUnresolved])
+	assert.Positive(t, errs[ErrResolutionLoop])
+
+	// Dependents are exactly the routes in the tracked resolutions.
+	dependents := map[netip.Prefix]map[netip.Addr]struct{}{}
+	for addr, state := range resolver.nextHops {
+		for _, prefix := range state.resolution.Via {
+			if dependents[prefix] == nil {
+				dependents[prefix] = map[netip.Addr]struct{}{}
+			}
+			dependents[prefix][addr] = struct{}{}
+		}
+	}
+	assert.Equal(t, dependents, resolver.dependents)
+	assert.Len(t, resolver.sorted, len(resolver.nextHops))
+}
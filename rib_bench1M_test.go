@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+// BenchmarkRIBChurn1M benchmarks path churn on a RIB holding 1M prefixes
+// with a primary and a backup path each. Every iteration flaps one path
+// of the next prefix; fib-updates is the number of FIB updates per
+// iteration, below 1 for best path flaps because the random datasets
+// repeat prefixes once masked.
+func BenchmarkRIBChurn1M(b *testing.B) {
+	primaryHop, backupHop := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+	primary := Path{Source: "peer1", Preference: 200, Metric: 10, NextHop: primaryHop}
+	backup := Path{Source: "peer2", Preference: 100, Metric: 10, NextHop: backupHop}
+
+	for _, ds := range prefixDatasets() {
+		prefixes := ds.prefixes(1000_000)
+
+		fibUpdates := 0
+		countUpdates := func(FIBUpdate) { fibUpdates++ }
+
+		// Measure memory before insertion
+		runtime.GC()
+		var memBefore runtime.MemStats
+		runtime.ReadMemStats(&memBefore)
+
+		rib := NewRIB(countUpdates)
+		for _, prefix := range prefixes {
+			rib.InsertOrUpdate(prefix, primary)
+			rib.InsertOrUpdate(prefix, backup)
+		}
+
+		// Measure memory after insertion
+		runtime.GC()
+		var memAfter runtime.MemStats
+		runtime.ReadMemStats(&memAfter)
+
+		allocDiff := memAfter.Alloc - memBefore.Alloc
+		b.Logf("Memory: Prefixes=%d Alloc=%d bytes (%.2f MB)", rib.Len(), allocDiff, float64(allocDiff)/(1024*1024))
+
+		benchmarks := []struct {
+			name string
+			flap func(prefix netip.Prefix, up bool)
+		}{
+			{
+				// The best path goes away and comes back, so the FIB
+				// switches to the backup next hop and back.
+				name: "best_path_flap",
+				flap: func(prefix netip.Prefix, up bool) {
+					if up {
+						rib.InsertOrUpdate(prefix, primary)
+					} else {
+						rib.UpdateOrDelete(prefix, primary.Source)
+					}
+				},
+			},
+			{
+				name: "backup_path_flap",
+				flap: func(prefix netip.Prefix, up bool) {
+					if up {
+						rib.InsertOrUpdate(prefix, backup)
+					} else {
+						rib.UpdateOrDelete(prefix, backup.Source)
+					}
+				},
+			},
+			{
+				// The metric of the best path changes without changing
+				// the next hop.
+				name: "best_path_metric",
+				flap: func(prefix netip.Prefix, up bool) {
+					path := primary
+					if !up {
+						path.Metric++
+					}
+					rib.InsertOrUpdate(prefix, path)
+				},
+			},
+		}
+
+		for _, bm := range benchmarks {
+			b.Run(ds.name+"/"+bm.name, func(b *testing.B) {
+				b.ReportAllocs()
+				captureProfiles(b)
+				fibUpdates = 0
+
+				// Every prefix goes down in one round and up in the next.
+				idx := 0
+				up := false
+				for b.Loop() {
+					bm.flap(prefixes[idx], up)
+					if idx++; idx == len(prefixes) {
+						idx = 0
+						up = !up
+					}
+				}
+				b.ReportMetric(float64(fibUpdates)/float64(b.N), "fib-updates")
+
+				// Bring every path up again for the next benchmark.
+				for _, prefix := range prefixes {
+					bm.flap(prefix, true)
+				}
+
+				b.ReportMetric(float64(allocDiff), "heap-bytes")
+			})
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+)
+
+// Path is a route to a prefix learned from one source.
+type Path struct {
+	// Source identifies the path within its prefix, e.g. a BGP peer or a
+	// static route.
+	Source string
+	// Preference is compared first, the higher the better.
+	Preference uint32
+	// Metric breaks ties between paths of the same preference, the lower
+	// the better.
+	Metric uint32
+	// NextHop must be a valid address, the invalid one stands for no
+	// route in FIB updates.
+	NextHop netip.Addr
+}
+
+// comparePaths orders paths from the best to the worst: by preference,
+// then by metric and then by source, so that the order is total.
+func comparePaths(a, b Path) int {
+	if c := cmp.Compare(b.Preference, a.Preference); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Metric, b.Metric); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Source, b.Source)
+}
+
+// FIBUpdate is a change of the next hop of a prefix caused by a new best
+// path. Old is invalid for added prefixes and New for removed ones.
+type FIBUpdate = PrefixChange[netip.Prefix, netip.Addr]
+
+// RIB is a routing information base on top of MapTrie where every prefix
+// holds the paths of all its sources, ordered from the best to the worst.
+//
+// Changes of the best path are reported to the FIB callback, but only if
+// they change the next hop, which is all the FIB forwards on.
+type RIB struct {
+	trie MapTrie[netip.Prefix, netip.Addr, []Path]
+	fib  func(FIBUpdate)
+}
+
+// NewRIB returns an empty RIB reporting best path changes to fib.
+func NewRIB(fib func(FIBUpdate)) *RIB {
+	return &RIB{
+		trie: NewMapTrie[netip.Prefix, netip.Addr, []Path](0),
+		fib:  fib,
+	}
+}
+
+// InsertOrUpdate adds the path to the prefix, replacing the previous path
+// of the same source.
+func (r *RIB) InsertOrUpdate(prefix netip.Prefix, path Path) {
+	prefix = prefix.Masked()
+
+	var old netip.Addr
+	var paths []Path
+	r.trie.InsertOrUpdate(prefix, func() []Path {
+		paths = []Path{path}
+		return paths
+	}, func(current []Path) []Path {
+		old = current[0].NextHop
+		if idx := slices.IndexFunc(current, func(p Path) bool { return p.Source == path.Source }); idx >= 0 {
+			current = slices.Delete(current, idx, idx+1)
+		}
+		idx, _ := slices.BinarySearchFunc(current, path, comparePaths)
+		paths = slices.Insert(current, idx, path)
+		return paths
+	})
+
+	r.notify(prefix, old, paths[0].NextHop)
+}
+
+// UpdateOrDelete withdraws the path of the source from the prefix and
+// reports whether there was one. The prefix is removed with its last
+// path.
+func (r *RIB) UpdateOrDelete(prefix netip.Prefix, source string) bool {
+	prefix = prefix.Masked()
+
+	var old, next netip.Addr
+	withdrawn := false
+	r.trie.UpdateOrDelete(prefix, func(current []Path) ([]Path, bool) {
+		idx := slices.IndexFunc(current, func(p Path) bool { return p.Source == source })
+		if idx < 0 {
+			return current, false
+		}
+
+		withdrawn = true
+		old = current[0].NextHop
+		current = slices.Delete(current, idx, idx+1)
+		if len(current) == 0 {
+			return nil, true
+		}
+		next = current[0].NextHop
+		return current, false
+	})
+
+	if withdrawn {
+		r.notify(prefix, old, next)
+	}
+	return withdrawn
+}
+
+// notify reports a change of the next hop of the prefix.
+func (r *RIB) notify(prefix netip.Prefix, old, next netip.Addr) {
+	if update, ok := nextHopChange(prefix, old, next); ok && r.fib != nil {
+		r.fib(update)
+	}
+}
+
+// nextHopChange returns the FIB update for a change of the next hop of the
+// prefix, where the invalid address stands for no route, and reports
+// whether the next hop changed.
+func nextHopChange(prefix netip.Prefix, old, next netip.Addr) (FIBUpdate, bool) {
+	var kind DiffKind
+	switch {
+	case old == next:
+		return FIBUpdate{}, false
+	case !old.IsValid():
+		kind = DiffAdded
+	case !next.IsValid():
+		kind = DiffRemoved
+	default:
+		kind = DiffChanged
+	}
+	return FIBUpdate{Kind: kind, Prefix: prefix, Old: old, New: next}, true
+}
+
+// Lookup returns the longest prefix containing the address and its best
+// path.
+func (r *RIB) Lookup(addr netip.Addr) (netip.Prefix, Path, bool) {
+	prefix, paths, ok := r.trie.Lookup(addr)
+	if !ok {
+		return prefix, Path{}, false
+	}
+	return prefix, paths[0], true
+}
+
+// Paths returns the paths of the prefix from the best to the worst.
+func (r *RIB) Paths(prefix netip.Prefix) []Path {
+	prefix = prefix.Masked()
+	return slices.Clone(r.trie[prefix.Bits()][prefix])
+}
+
+// Len returns the number of prefixes with at least one path.
+func (r *RIB) Len() int {
+	return r.trie.Len()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math/rand"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRIBBestPath tests best path selection and the emitted FIB updates
+func TestRIBBestPath(t *testing.T) {
+	var updates []FIBUpdate
+	rib := NewRIB(func(u FIBUpdate) { updates = append(updates, u) })
+
+	prefix := netip.MustParsePrefix("10.0.0.0/8")
+	hop1, hop2, hop3 := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("192.0.2.3")
+	takeUpdates := func() []FIBUpdate {
+		out := updates
+		updates = nil
+		return out
+	}
+
+	rib.InsertOrUpdate(prefix, Path{Source: "ospf", Preference: 110, Metric: 20, NextHop: hop1})
+	assert.Equal(t, []FIBUpdate{{Kind: DiffAdded, Prefix: prefix, New: hop1}}, takeUpdates())
+
+	// A worse path does not change forwarding.
+	rib.InsertOrUpdate(prefix, Path{Source: "rip", Preference: 100, Metric: 1, NextHop: hop2})
+	assert.Empty(t, takeUpdates())
+
+	// A better path does.
+	rib.InsertOrUpdate(prefix, Path{Source: "bgp", Preference: 200, Metric: 5, NextHop: hop3})
+	assert.Equal(t, []FIBUpdate{{Kind: DiffChanged, Prefix: prefix, Old: hop1, New: hop3}}, takeUpdates())
+	assert.Equal(t, []string{"bgp", "ospf", "rip"}, pathSources(rib.Paths(prefix)))
+
+	// Replacing the path of a source reorders the paths.
+	rib.InsertOrUpdate(prefix, Path{Source: "bgp", Preference: 110, Metric: 30, NextHop: hop3})
+	assert.Equal(t, []FIBUpdate{{Kind: DiffChanged, Prefix: prefix, Old: hop3, New: hop1}}, takeUpdates())
+	assert.Equal(t, []string{"ospf", "bgp", "rip"}, pathSources(rib.Paths(prefix)))
+
+	// A new best path with the same next hop is invisible to the FIB.
+	rib.InsertOrUpdate(prefix, Path{Source: "static", Preference: 250, NextHop: hop1})
+	assert.Empty(t, takeUpdates())
+	_, best, ok := rib.Lookup(netip.MustParseAddr("10.1.2.3"))
+	require.True(t, ok)
+	assert.Equal(t, "static", best.Source)
+
+	// Equal preference falls back to the metric.
+	more := netip.MustParsePrefix("10.1.0.0/16")
+	rib.InsertOrUpdate(more, Path{Source: "a", Preference: 100, Metric: 10, NextHop: hop1})
+	rib.InsertOrUpdate(more, Path{Source: "b", Preference: 100, Metric: 5, NextHop: hop2})
+	assert.Equal(t, []FIBUpdate{
+		{Kind: DiffAdded, Prefix: more, New: hop1},
+		{Kind: DiffChanged, Prefix: more, Old: hop1, New: hop2},
+	}, takeUpdates())
+	matched, best, ok := rib.Lookup(netip.MustParseAddr("10.1.2.3"))
+	require.True(t, ok)
+	assert.Equal(t, more, matched)
+	assert.Equal(t, "b", best.Source)
+	require.Equal(t, 2, rib.Len())
+
+	// Withdrawals.
+	assert.False(t, rib.UpdateOrDelete(prefix, "isis"))
+	assert.False(t, rib.UpdateOrDelete(netip.MustParsePrefix("11.0.0.0/8"), "bgp"))
+	assert.Empty(t, takeUpdates())
+
+	require.True(t, rib.UpdateOrDelete(more, "b"))
+	assert.Equal(t, []FIBUpdate{{Kind: DiffChanged, Prefix: more, Old: hop2, New: hop1}}, takeUpdates())
+	require.True(t, rib.UpdateOrDelete(more, "a"))
+	assert.Equal(t, []FIBUpdate{{Kind: DiffRemoved, Prefix: more, Old: hop1}}, takeUpdates())
+	assert.Nil(t, rib.Paths(more))
+	require.Equal(t, 1, rib.Len())
+
+	require.True(t, rib.UpdateOrDelete(netip.MustParsePrefix("10.9.9.9/8"), "static"))
+	assert.Empty(t, takeUpdates())
+	_, best, _ = rib.Lookup(netip.MustParseAddr("10.1.2.3"))
+	assert.Equal(t, "ospf", best.Source)
+}
+
+// pathSources returns the sources of the paths
+func pathSources(paths []Path) []string {
+	sources := make([]string, len(paths))
+	for idx, path := range paths {
+		sources[idx] = path.Source
+	}
+	return sources
+}
+
+// TestRIBChurnMatchesModel applies random announcements and withdrawals
+// and checks that the FIB built from the updates forwards like the best
+// paths of a naive model
+func TestRIBChurnMatchesModel(t *testing.T) {
+	prefixes := referencePrefixes(500)
+	sources := []string{"peer1", "peer2", "peer3", "static"}
+	hops := []netip.Addr{
+		netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2"),
+		netip.MustParseAddr("192.0.2.3"), netip.MustParseAddr("2001:db8::1"),
+	}
+	rng := rand.New(rand.NewSource(49))
+
+	fib := NewMapTrie[netip.Prefix, netip.Addr, netip.Addr](0)
+	rib := NewRIB(func(u FIBUpdate) {
+		current, ok := fib[u.Prefix.Bits()][u.Prefix]
+		switch u.Kind {
+		case DiffAdded:
+			require.False(t, ok, "%s added twice", u.Prefix)
+		default:
+			require.True(t, ok, "%s %s without a route", u.Prefix, u.Kind)
+			require.Equal(t, current, u.Old, "%s", u.Prefix)
+		}
+		if u.Kind == DiffRemoved {
+			fib.UpdateOrDelete(u.Prefix, func(netip.Addr) (netip.Addr, bool) { return netip.Addr{}, true })
+		} else {
+			fib.InsertOrUpdate(u.Prefix, func() netip.Addr { return u.New }, func(netip.Addr) netip.Addr { return u.New })
+		}
+	})
+	model := map[netip.Prefix]map[string]Path{}
+
+	for range 20_000 {
+		prefix := prefixes[rng.Intn(len(prefixes))].Masked()
+		source := sources[rng.Intn(len(sources))]
+
+		if rng.Intn(3) == 0 {
+			_, want := model[prefix][source]
+			require.Equal(t, want, rib.UpdateOrDelete(prefix, source))
+			delete(model[prefix], source)
+			continue
+		}
+
+		path := Path{
+			Source:     source,
+			Preference: uint32(rng.Intn(3)),
+			Metric:     uint32(rng.Intn(3)),
+			NextHop:    hops[rng.Intn(len(hops))],
+		}
+		rib.InsertOrUpdate(prefix, path)
+		if model[prefix] == nil {
+			model[prefix] = map[string]Path{}
+		}
+		model[prefix][source] = path
+	}
+
+	want := map[netip.Prefix]netip.Addr{}
+	for prefix, paths := range model {
+		if len(paths) == 0 {
+			continue
+		}
+		all := make([]Path, 0, len(paths))
+		for _, path := range paths {
+			all = append(all, path)
+		}
+		slices.SortFunc(all, comparePaths)
+		want[prefix] = all[0].NextHop
+		require.Equal(t, all, rib.Paths(prefix), "%s", prefix)
+	}
+	assert.Equal(t, want, fib.Dump())
+	assert.Equal(t, len(want), rib.Len())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+// sailBenchmarks returns the 1M datasets for SAIL. IPv6 prefixes longer
+// than 64 bits are outside the SAIL scope and are dropped, which leaves
+// roughly a third of the IPv6 dataset.
+func sailBenchmarks() []struct {
+	name     string
+	newSAIL  func() *SAIL[string]
+	prefixes []netip.Prefix
+	addrs    []netip.Addr
+} {
+	v6 := []netip.Prefix{}
+	for _, prefix := range randomIPv6Prefixes(1000_000) {
+		if prefix.Bits() <= 64 {
+			v6 = append(v6, prefix)
+		}
+	}
+
+	return []struct {
+		name     string
+		newSAIL  func() *SAIL[string]
+		prefixes []netip.Prefix
+		addrs    []netip.Addr
+	}{
+		{"ipv4_1M_prefixes", NewSAILv4[string], randomIPv4Prefixes(1000_000), randomIPv4Addrs(1000)},
+		{"ipv6_1M_prefixes_upto_64", NewSAILv6[string], v6, randomIPv6Addrs(1000)},
+	}
+}
+
+// BenchmarkSAILInsert1M benchmarks insertion of 1M prefixes
+func BenchmarkSAILInsert1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	for _, bm := range sailBenchmarks() {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			sail := bm.newSAIL()
+			idx := 0
+
+			for b.Loop() {
+				if err := sail.Insert(bm.prefixes[idx], values[idx]); err != nil {
+					b.Fatalf("Insert: %v", err)
+				}
+				idx = (idx + 1) % len(bm.prefixes)
+			}
+		})
+	}
+}
+
+// BenchmarkSAILChurn1M benchmarks updates of a SAIL holding 1M prefixes:
+// every iteration withdraws a prefix and announces it again
+func BenchmarkSAILChurn1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	for _, bm := range sailBenchmarks() {
+		b.Run(bm.name, func(b *testing.B) {
+			sail := bm.newSAIL()
+			for i, prefix := range bm.prefixes {
+				_ = sail.Insert(prefix, values[i])
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			for b.Loop() {
+				sail.Delete(bm.prefixes[idx])
+				_ = sail.Insert(bm.prefixes[idx], values[idx])
+				idx = (idx + 1) % len(bm.prefixes)
+			}
+		})
+	}
+}
+
+// BenchmarkSAILLookup1M benchmarks lookups in a SAIL with 1M prefixes
+func BenchmarkSAILLookup1M(b *testing.B) {
+	values := datacenterValues(1000_000)
+
+	for _, bm := range sailBenchmarks() {
+		b.Run(bm.name, func(b *testing.B) {
+			// Measure memory before insertion
+			runtime.GC()
+			var memBefore runtime.MemStats
+			runtime.ReadMemStats(&memBefore)
+
+			// Setup: Insert 1M prefixes
+			sail := bm.newSAIL()
+			for i, prefix := range bm.prefixes {
+				_ = sail.Insert(prefix, values[i])
+			}
+
+			// Measure memory after insertion
+			runtime.GC()
+			var memAfter runtime.MemStats
+			runtime.ReadMemStats(&memAfter)
+
+			allocDiff := memAfter.Alloc - memBefore.Alloc
+			totalAllocDiff := memAfter.TotalAlloc - memBefore.TotalAlloc
+
+			b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB), TotalAlloc=%d bytes (%.2f MB)",
+				len(bm.prefixes), allocDiff, float64(allocDiff)/(1024*1024),
+				totalAllocDiff, float64(totalAllocDiff)/(1024*1024))
+			stats := sail.Stats()
+			b.Logf("sail.prefixes: %d, sail.chunks: %v, arrays size: %d", stats.Prefixes, stats.Chunks, stats.SizeBytes)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			idx := 0
+			foundCount := 0
+			for b.Loop() {
+				val, ok := sail.Lookup(bm.addrs[idx])
+				if ok && val != "" {
+					foundCount++
+				}
+				idx = (idx + 1) % len(bm.addrs)
+			}
+
+			if foundCount == 0 {
+				b.Fatalf("No successful lookups in %d iterations", b.N)
+			}
+
+			b.ReportMetric(float64(stats.SizeBytes), "table-bytes")
+		})
+	}
+}
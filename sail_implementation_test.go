@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// sailChunkSize is the number of entries in a chunk of every SAIL level
+// below the first one, each level consumes one more address byte.
+const sailChunkSize = 256
+
+// sailLevel holds the arrays of a single SAIL level.
+//
+// Entries of the first level are indexed by the top 16 address bits. The
+// entries of deeper levels are grouped in chunks of 256, one chunk per
+// entry of the previous level that has longer prefixes below it.
+type sailLevel struct {
+	// nextHop holds the value index plus one, zero means no route.
+	nextHop []uint32
+	// length holds the length of the prefix that provides the next hop.
+	// It is only needed to apply updates incrementally.
+	length []uint8
+	// chunk holds the next level chunk index plus one, zero means that
+	// the lookup finishes at this level. A non-zero chunk id plays the role
+	// of the per-level bitmap bit in SAIL_B.
+	chunk []uint32
+}
+
+// SAIL is an implementation of the SAIL_L lookup algorithm ("SAIL:
+// Splitting Lookup into Levels", Yang et al.).
+//
+// Prefixes are pushed to fixed pivot levels: lengths 0-16 to level 16,
+// 17-24 to level 24, 25-32 to level 32 and so on. A lookup reads at most
+// one entry per level and never backtracks, so its cost is bounded by the
+// number of levels. For IPv6 the levels end at 64 bits, like in the
+// original paper, and longer prefixes are rejected.
+//
+// The type parameter V represents the value type stored for each prefix.
+type SAIL[V any] struct {
+	maxBits int
+	levels  []sailLevel
+	// control holds value indices of the inserted prefixes and is used to
+	// find the covering prefix on deletion.
+	control MapTrie[netip.Prefix, netip.Addr, uint32]
+	values  []V
+	free    []uint32
+}
+
+// SAILStats describes the memory layout of a SAIL instance.
+type SAILStats struct {
+	// Prefixes is the number of stored prefixes.
+	Prefixes int
+	// Chunks is the number of chunks allocated at each level below the
+	// first one.
+	Chunks []int
+	// SizeBytes is the size of the lookup arrays, excluding values and the
+	// control plane.
+	SizeBytes int
+}
+
+// NewSAILv4 returns an empty IPv4 SAIL with levels 16, 24 and 32.
+func NewSAILv4[V any]() *SAIL[V] {
+	return newSAIL[V](32)
+}
+
+// NewSAILv6 returns an empty IPv6 SAIL with levels 16, 24, ..., 64.
+func NewSAILv6[V any]() *SAIL[V] {
+	return newSAIL[V](64)
+}
+
+func newSAIL[V any](maxBits int) *SAIL[V] {
+	s := &SAIL[V]{
+		maxBits: maxBits,
+		levels:  make([]sailLevel, 1+(maxBits-16)/8),
+		control: NewMapTrie[netip.Prefix, netip.Addr, uint32](0),
+	}
+
+	s.levels[0] = sailLevel{
+		nextHop: make([]uint32, 1<<16),
+		length:  make([]uint8, 1<<16),
+		chunk:   make([]uint32, 1<<16),
+	}
+
+	return s
+}
+
+// sailPivot returns the level a prefix of the given length is pushed to.
+func sailPivot(bits int) int {
+	if bits <= 16 {
+		return 0
+	}
+	return (bits - 16 + 7) / 8
+}
+
+// sailLevelBits returns the number of address bits resolved at the level.
+func sailLevelBits(level int) int {
+	return 16 + 8*level
+}
+
+// sailTopIndex returns the entry index of the address at the first level.
+func sailTopIndex(a *[16]byte) uint32 {
+	return uint32(a[0])<<8 | uint32(a[1])
+}
+
+// Lookup searches the SAIL for the value of the longest prefix matching
+// the given address.
+//
+// If no match is found, the function returns the zero value and false.
+func (s *SAIL[V]) Lookup(addr netip.Addr) (V, bool) {
+	if addr.Is4() != (s.maxBits == 32) {
+		var zero V
+		return zero, false
+	}
+
+	a := addrBytes(addr)
+	idx := sailTopIndex(&a)
+	level := &s.levels[0]
+	for depth := 1; level.chunk[idx] != 0; depth++ {
+		idx = (level.chunk[idx]-1)*sailChunkSize + uint32(a[depth+1])
+		level = &s.levels[depth]
+	}
+
+	if nh := level.nextHop[idx]; nh != 0 {
+		return s.values[nh-1], true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Insert adds a new prefix or replaces the value of an existing one.
+//
+// Returns an error if the prefix family does not match the SAIL or the
+// prefix is longer than the last level.
+func (s *SAIL[V]) Insert(prefix netip.Prefix, value V) error {
+	if err := s.check(prefix); err != nil {
+		return err
+	}
+
+	prefix = prefix.Masked()
+	bits := prefix.Bits()
+
+	if idx, ok := s.control[bits][prefix]; ok {
+		s.values[idx] = value
+		return nil
+	}
+
+	var idx uint32
+	if n := len(s.free); n > 0 {
+		idx = s.free[n-1]
+		s.free = s.free[:n-1]
+		s.values[idx] = value
+	} else {
+		idx = uint32(len(s.values))
+		s.values = append(s.values, value)
+	}
+	s.control[bits][prefix] = idx
+
+	s.update(prefix, func(nh uint32, length uint8) bool {
+		return length <= uint8(bits)
+	}, idx+1, uint8(bits), true)
+
+	return nil
+}
+
+// Delete removes the prefix from the SAIL. Entries covered by the prefix
+// fall back to the longest remaining covering prefix.
+//
+// Returns false if the prefix was not found.
+func (s *SAIL[V]) Delete(prefix netip.Prefix) bool {
+	if s.check(prefix) != nil {
+		return false
+	}
+
+	prefix = prefix.Masked()
+	bits := prefix.Bits()
+
+	idx, ok := s.control[bits][prefix]
+	if !ok {
+		return false
+	}
+	delete(s.control[bits], prefix)
+
+	var zero V
+	s.values[idx] = zero
+	s.free = append(s.free, idx)
+
+	// Find the covering prefix that takes over the deleted range.
+	var nh uint32
+	var length uint8
+	for shorter := bits - 1; shorter >= 0; shorter-- {
+		covering, _ := prefix.Addr().Prefix(shorter)
+		if cidx, ok := s.control[shorter][covering]; ok {
+			nh, length = cidx+1, uint8(shorter)
+			break
+		}
+	}
+
+	s.update(prefix, func(_ uint32, current uint8) bool {
+		return current == uint8(bits)
+	}, nh, length, false)
+
+	return true
+}
+
+// check verifies that the prefix can be stored in the SAIL.
+func (s *SAIL[V]) check(prefix netip.Prefix) error {
+	if prefix.Addr().Is4() != (s.maxBits == 32) {
+		return fmt.Errorf("prefix %s family does not match SAIL", prefix)
+	}
+	if prefix.Bits() > s.maxBits {
+		return fmt.Errorf("prefix %s is longer than %d bits", prefix, s.maxBits)
+	}
+	return nil
+}
+
+// update walks the entries covered by the prefix at its pivot level and
+// below, and sets the next hop of every entry accepted by match. When
+// grow is set, missing chunks on the path to the pivot level are created.
+func (s *SAIL[V]) update(prefix netip.Prefix, match func(uint32, uint8) bool, nh uint32, length uint8, grow bool) {
+	a := addrBytes(prefix.Addr())
+	pivot := sailPivot(prefix.Bits())
+
+	// Descend to the pivot level.
+	idx := sailTopIndex(&a)
+	for depth := range pivot {
+		level := &s.levels[depth]
+		if level.chunk[idx] == 0 {
+			if !grow {
+				return
+			}
+			s.pushChunk(depth, idx)
+		}
+		idx = (level.chunk[idx]-1)*sailChunkSize + uint32(a[depth+2])
+	}
+
+	count := uint32(1) << (sailLevelBits(pivot) - prefix.Bits())
+	s.apply(pivot, idx, count, match, nh, length)
+}
+
+// apply updates count consecutive entries of the level starting at idx
+// and recursively the chunks below them.
+func (s *SAIL[V]) apply(depth int, idx, count uint32, match func(uint32, uint8) bool, nh uint32, length uint8) {
+	level := &s.levels[depth]
+	for e := idx; e < idx+count; e++ {
+		if !match(level.nextHop[e], level.length[e]) {
+			// Entries below were pushed from this or longer prefixes.
+			continue
+		}
+		level.nextHop[e] = nh
+		level.length[e] = length
+		if chunk := level.chunk[e]; chunk != 0 {
+			s.apply(depth+1, (chunk-1)*sailChunkSize, sailChunkSize, match, nh, length)
+		}
+	}
+}
+
+// pushChunk allocates a chunk at the next level for the entry and pushes
+// the entry next hop into all of its slots.
+func (s *SAIL[V]) pushChunk(depth int, idx uint32) {
+	level := &s.levels[depth]
+	next := &s.levels[depth+1]
+
+	chunk := uint32(len(next.nextHop) / sailChunkSize)
+	for range sailChunkSize {
+		next.nextHop = append(next.nextHop, level.nextHop[idx])
+		next.length = append(next.length, level.length[idx])
+		next.chunk = append(next.chunk, 0)
+	}
+	level.chunk[idx] = chunk + 1
+}
+
+// Len returns the total number of prefixes stored in the SAIL.
+func (s *SAIL[V]) Len() int {
+	return s.control.Len()
+}
+
+// Stats returns the memory layout statistics of the SAIL.
+func (s *SAIL[V]) Stats() SAILStats {
+	stats := SAILStats{Prefixes: s.Len()}
+	for depth, level := range s.levels {
+		if depth > 0 {
+			stats.Chunks = append(stats.Chunks, len(level.nextHop)/sailChunkSize)
+		}
+		// nextHop and chunk are 4 bytes, length is 1 byte per entry.
+		stats.SizeBytes += len(level.nextHop) * 9
+	}
+	return stats
+}
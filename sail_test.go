@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSAILBasicOperations tests basic insert and lookup operations
+func TestSAILBasicOperations(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []struct{ cidr, value string }
+		lookups  []struct{ addr, want string }
+	}{
+		{
+			name: "overlapping IPv4 prefixes across levels",
+			prefixes: []struct{ cidr, value string }{
+				{"10.0.0.0/8", "DC1"},
+				{"10.1.0.0/16", "DC2"},
+				{"10.1.1.0/24", "DC3"},
+				{"10.1.1.128/25", "DC4"},
+				{"10.1.1.255/32", "DC5"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"10.0.0.1", "DC1"},
+				{"10.1.0.1", "DC2"},
+				{"10.1.1.1", "DC3"},
+				{"10.1.1.129", "DC4"},
+				{"10.1.1.255", "DC5"},
+				{"11.0.0.1", ""},
+			},
+		},
+		{
+			name: "reverse insertion order",
+			prefixes: []struct{ cidr, value string }{
+				{"10.1.1.255/32", "DC5"},
+				{"10.1.1.128/25", "DC4"},
+				{"10.1.1.0/24", "DC3"},
+				{"10.1.0.0/16", "DC2"},
+				{"10.0.0.0/8", "DC1"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"10.0.0.1", "DC1"},
+				{"10.1.0.1", "DC2"},
+				{"10.1.1.1", "DC3"},
+				{"10.1.1.129", "DC4"},
+				{"10.1.1.255", "DC5"},
+			},
+		},
+		{
+			name: "default route and non-pivot lengths",
+			prefixes: []struct{ cidr, value string }{
+				{"0.0.0.0/0", "DEFAULT"},
+				{"192.168.0.0/20", "DC1"},
+				{"192.168.4.0/30", "DC2"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"8.8.8.8", "DEFAULT"},
+				{"192.168.15.255", "DC1"},
+				{"192.168.16.0", "DEFAULT"},
+				{"192.168.4.3", "DC2"},
+				{"192.168.4.4", "DC1"},
+			},
+		},
+		{
+			name: "IPv6 prefixes",
+			prefixes: []struct{ cidr, value string }{
+				{"2001:db8::/32", "DC1"},
+				{"2001:db8:1::/48", "DC2"},
+				{"2001:db8:1:1::/64", "DC3"},
+				{"2001:db8:1:2::/63", "DC4"},
+			},
+			lookups: []struct{ addr, want string }{
+				{"2001:db8::1", "DC1"},
+				{"2001:db8:1::1", "DC2"},
+				{"2001:db8:1:1::1", "DC3"},
+				{"2001:db8:1:3::1", "DC4"},
+				{"2001:db9::1", ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sail *SAIL[string]
+			if netip.MustParsePrefix(tt.prefixes[0].cidr).Addr().Is4() {
+				sail = NewSAILv4[string]()
+			} else {
+				sail = NewSAILv6[string]()
+			}
+
+			for _, p := range tt.prefixes {
+				require.NoError(t, sail.Insert(netip.MustParsePrefix(p.cidr), p.value))
+			}
+
+			for _, lookup := range tt.lookups {
+				got, found := sail.Lookup(netip.MustParseAddr(lookup.addr))
+				if lookup.want == "" {
+					assert.False(t, found, "Lookup(%s) = %q, want not found", lookup.addr, got)
+					continue
+				}
+				assert.True(t, found, "Lookup(%s) not found", lookup.addr)
+				assert.Equal(t, lookup.want, got, "Lookup(%s)", lookup.addr)
+			}
+		})
+	}
+}
+
+// TestSAILInvalidPrefixes tests that unsupported prefixes are rejected
+func TestSAILInvalidPrefixes(t *testing.T) {
+	v4 := NewSAILv4[string]()
+	assert.Error(t, v4.Insert(netip.MustParsePrefix("2001:db8::/32"), "DC1"))
+
+	v6 := NewSAILv6[string]()
+	assert.Error(t, v6.Insert(netip.MustParsePrefix("10.0.0.0/8"), "DC1"))
+	assert.Error(t, v6.Insert(netip.MustParsePrefix("2001:db8::/65"), "DC1"))
+	assert.False(t, v6.Delete(netip.MustParsePrefix("2001:db8::/65")))
+
+	_, found := v4.Lookup(netip.MustParseAddr("2001:db8::1"))
+	assert.False(t, found)
+}
+
+// TestSAILMatchesMapTrie runs random inserts and deletes against SAIL and
+// MapTrie and compares lookups after every phase
+func TestSAILMatchesMapTrie(t *testing.T) {
+	rng := rand.New(rand.NewSource(44))
+	v6Prefixes := []netip.Prefix{}
+	for _, prefix := range referencePrefixes(5000) {
+		if prefix.Addr().Is6() && prefix.Bits() <= 64 {
+			v6Prefixes = append(v6Prefixes, prefix)
+		}
+	}
+
+	families := []struct {
+		name     string
+		sail     *SAIL[int]
+		prefixes []netip.Prefix
+		addrs    []netip.Addr
+	}{
+		{"ipv4", NewSAILv4[int](), randomIPv4Prefixes(20_000), randomIPv4Addrs(10_000)},
+		{"ipv6", NewSAILv6[int](), v6Prefixes, randomIPv6Addrs(10_000)},
+	}
+
+	for _, f := range families {
+		t.Run(f.name, func(t *testing.T) {
+			// Add short prefixes so that deletes fall back to covering routes.
+			prefixes := f.prefixes
+			for idx := range 500 {
+				covering, _ := prefixes[idx].Addr().Prefix(rng.Intn(prefixes[idx].Bits() + 1))
+				prefixes = append(prefixes, covering)
+			}
+			addrs := f.addrs
+			for _, prefix := range prefixes[:2000] {
+				addrs = append(addrs, prefix.Addr(), prefixLastAddr(prefix))
+			}
+
+			reference := NewMapTrie[netip.Prefix, netip.Addr, int](0)
+			compare := func(phase string) {
+				require.Equal(t, reference.Len(), f.sail.Len(), phase)
+				for _, addr := range addrs {
+					_, want, wantOk := reference.Lookup(addr)
+					got, ok := f.sail.Lookup(addr)
+					require.Equal(t, wantOk, ok, "%s: Lookup(%s)", phase, addr)
+					require.Equal(t, want, got, "%s: Lookup(%s)", phase, addr)
+				}
+			}
+
+			for idx, prefix := range prefixes {
+				require.NoError(t, f.sail.Insert(prefix, idx))
+				reference.InsertOrUpdate(prefix, onEmpty(idx), onUpdate(idx))
+			}
+			compare("insert")
+
+			deleted := func(int) (int, bool) { return 0, true }
+			for idx, prefix := range prefixes {
+				if idx%3 != 0 {
+					f.sail.Delete(prefix)
+					reference.UpdateOrDelete(prefix, deleted)
+				}
+			}
+			compare("delete")
+
+			// Reinsert to reuse freed value slots.
+			for idx, prefix := range prefixes {
+				if idx%3 == 1 {
+					require.NoError(t, f.sail.Insert(prefix, -idx))
+					reference.InsertOrUpdate(prefix, onEmpty(-idx), onUpdate(-idx))
+				}
+			}
+			compare("reinsert")
+		})
+	}
+}
+
+// BenchmarkSAILInsert benchmarks insertion performance
+func BenchmarkSAILInsert(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []string
+	}{
+		{
+			name: "10_prefixes",
+			prefixes: []string{
+				"10.0.0.0/8", "10.1.0.0/16", "10.1.1.0/24",
+				"192.168.0.0/16", "192.168.1.0/24",
+				"172.16.0.0/12", "172.16.1.0/24",
+				"8.8.8.0/24", "1.1.1.0/24", "4.4.4.0/24",
+			},
+		},
+		{
+			name: "overlapping_prefixes",
+			prefixes: []string{
+				"10.0.0.0/8",
+				"10.1.0.0/16", "10.2.0.0/16", "10.3.0.0/16",
+				"10.1.1.0/24", "10.1.2.0/24", "10.1.3.0/24",
+				"10.1.1.1/32", "10.1.1.2/32", "10.1.1.3/32",
+			},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				sail := NewSAILv4[string]()
+				for j, cidr := range bm.prefixes {
+					_ = sail.Insert(netip.MustParsePrefix(cidr), fmt.Sprintf("DC%d", j))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSAILLookup benchmarks lookup performance
+func BenchmarkSAILLookup(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		prefixes []string
+		lookups  []string
+	}{
+		{
+			name:     "single_prefix_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"192.168.1.1"},
+		},
+		{
+			name: "longest_prefix_match",
+			prefixes: []string{
+				"10.0.0.0/8",
+				"10.1.0.0/16",
+				"10.1.1.0/24",
+				"10.1.1.128/25",
+			},
+			lookups: []string{"10.1.1.129"},
+		},
+		{
+			name:     "no_match",
+			prefixes: []string{"192.168.1.0/24"},
+			lookups:  []string{"8.8.8.8"},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			sail := NewSAILv4[string]()
+			for j, cidr := range bm.prefixes {
+				_ = sail.Insert(netip.MustParsePrefix(cidr), fmt.Sprintf("DC%d", j))
+			}
+
+			addrs := make([]netip.Addr, len(bm.lookups))
+			for i, lookup := range bm.lookups {
+				addrs[i] = netip.MustParseAddr(lookup)
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for b.Loop() {
+				for _, addr := range addrs {
+					_, _ = sail.Lookup(addr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var snapshotDir = flag.String("snapshot-dir", "", "directory to cache 1M MapTrie snapshots between runs, empty disables the cache")
+
+// buildMapTrie generates n prefixes and inserts them into a new MapTrie.
+func buildMapTrie(generate func(n int) []netip.Prefix, n int) MapTrie[netip.Prefix, netip.Addr, string] {
+	prefixes := generate(n)
+	values := datacenterValues(n)
+
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for i, prefix := range prefixes {
+		trie.InsertOrUpdate(prefix, onEmptyString(values[i]), onUpdateString(values[i]))
+	}
+	return trie
+}
+
+// loadMapTrie returns the MapTrie for the dataset, reading it from the
+// -snapshot-dir cache when possible and storing it there otherwise.
+func loadMapTrie(tb testing.TB, name string, generate func(n int) []netip.Prefix, n int) MapTrie[netip.Prefix, netip.Addr, string] {
+	tb.Helper()
+
+	if *snapshotDir == "" {
+		return buildMapTrie(generate, n)
+	}
+
+	path := filepath.Join(*snapshotDir, fmt.Sprintf("%s_%d.lpmt", name, n))
+	snapshot := MapTrieSnapshot[string]{Values: StringCodec{}}
+	if f, err := os.Open(path); err == nil {
+		_, err = snapshot.ReadFrom(f)
+		_ = f.Close()
+		if err == nil {
+			return snapshot.Trie
+		}
+		tb.Logf("ignoring snapshot %s: %v", path, err)
+	}
+
+	snapshot.Trie = buildMapTrie(generate, n)
+
+	// Write to a temporary file first, so that concurrent runs never see a
+	// partial snapshot.
+	if err := os.MkdirAll(*snapshotDir, 0o755); err != nil {
+		tb.Fatalf("create snapshot dir: %v", err)
+	}
+	f, err := os.CreateTemp(*snapshotDir, filepath.Base(path)+".*")
+	if err != nil {
+		tb.Fatalf("create snapshot: %v", err)
+	}
+	if _, err := snapshot.WriteTo(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		tb.Fatalf("write snapshot: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		tb.Fatalf("close snapshot: %v", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		tb.Fatalf("rename snapshot: %v", err)
+	}
+
+	return snapshot.Trie
+}
+
+// BenchmarkMapTrieSnapshotWrite1M benchmarks encoding of a MapTrie with 1M
+// prefixes
+func BenchmarkMapTrieSnapshotWrite1M(b *testing.B) {
+	for _, ds := range prefixDatasets() {
+		b.Run(ds.name, func(b *testing.B) {
+			snapshot := MapTrieSnapshot[string]{
+				Trie:   loadMapTrie(b, ds.name, ds.prefixes, 1000_000),
+				Values: StringCodec{},
+			}
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			var size int64
+			for b.Loop() {
+				n, err := snapshot.WriteTo(io.Discard)
+				if err != nil {
+					b.Fatalf("WriteTo: %v", err)
+				}
+				size = n
+			}
+
+			b.ReportMetric(float64(size), "snapshot-bytes")
+		})
+	}
+}
+
+// BenchmarkMapTrieLoad1M compares restoring a MapTrie with 1M prefixes
+// from a snapshot against generating and inserting the prefixes again
+func BenchmarkMapTrieLoad1M(b *testing.B) {
+	for _, ds := range prefixDatasets() {
+		b.Run(ds.name+"/rebuild", func(b *testing.B) {
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			for b.Loop() {
+				if trie := buildMapTrie(ds.prefixes, 1000_000); trie.Len() == 0 {
+					b.Fatal("empty trie")
+				}
+			}
+		})
+
+		b.Run(ds.name+"/snapshot", func(b *testing.B) {
+			var buf bytes.Buffer
+			snapshot := MapTrieSnapshot[string]{
+				Trie:   loadMapTrie(b, ds.name, ds.prefixes, 1000_000),
+				Values: StringCodec{},
+			}
+			if _, err := snapshot.WriteTo(&buf); err != nil {
+				b.Fatalf("WriteTo: %v", err)
+			}
+			data := buf.Bytes()
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			b.ReportAllocs()
+			captureProfiles(b)
+
+			for b.Loop() {
+				restored := MapTrieSnapshot[string]{Values: StringCodec{}}
+				if _, err := restored.ReadFrom(bytes.NewReader(data)); err != nil {
+					b.Fatalf("ReadFrom: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"maps"
+	"net/netip"
+	"slices"
+)
+
+// Snapshot binary format, all integers are little endian:
+//
+//	header:  magic "LPMT", version uint16, reserved uint16, count uint64
+//	record:  family uint8 (4 or 6), bits uint8, address (4 or 16 bytes),
+//	         value length uvarint, value bytes
+//	trailer: CRC-32C of the header and all records
+//
+// Records are sorted by prefix length and address, so equal tries always
+// produce identical snapshots.
+const (
+	snapshotMagic   = "LPMT"
+	snapshotVersion = 1
+	// snapshotMaxValue bounds the value length accepted on read, so that a
+	// corrupted length cannot trigger a huge allocation.
+	snapshotMaxValue = 1 << 20
+)
+
+// ErrSnapshotChecksum is returned when the snapshot trailer does not match
+// its contents.
+var ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+
+var snapshotCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ValueCodec encodes values of a snapshot.
+type ValueCodec[V any] interface {
+	// AppendValue appends the encoded value to dst.
+	AppendValue(dst []byte, value V) []byte
+	// DecodeValue decodes a value encoded by AppendValue.
+	DecodeValue(src []byte) (V, error)
+}
+
+// StringCodec stores string values as raw bytes.
+type StringCodec struct{}
+
+func (StringCodec) AppendValue(dst []byte, value string) []byte {
+	return append(dst, value...)
+}
+
+func (StringCodec) DecodeValue(src []byte) (string, error) {
+	return string(src), nil
+}
+
+// Uint32Codec stores uint32 values as uvarints.
+type Uint32Codec struct{}
+
+func (Uint32Codec) AppendValue(dst []byte, value uint32) []byte {
+	return binary.AppendUvarint(dst, uint64(value))
+}
+
+func (Uint32Codec) DecodeValue(src []byte) (uint32, error) {
+	value, n := binary.Uvarint(src)
+	if n != len(src) || value > 1<<32-1 {
+		return 0, fmt.Errorf("invalid uint32 value %x", src)
+	}
+	return uint32(value), nil
+}
+
+// MapTrieSnapshot persists and restores a MapTrie over netip prefixes.
+//
+// It implements io.WriterTo and io.ReaderFrom. ReadFrom replaces Trie
+// only when the whole snapshot is read and its checksum is valid.
+type MapTrieSnapshot[V any] struct {
+	Trie   MapTrie[netip.Prefix, netip.Addr, V]
+	Values ValueCodec[V]
+}
+
+// WriteTo writes the snapshot of the trie to w.
+func (s *MapTrieSnapshot[V]) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	crc := crc32.New(snapshotCRCTable)
+	out := io.MultiWriter(bw, crc)
+
+	header := make([]byte, 0, 16)
+	header = append(header, snapshotMagic...)
+	header = binary.LittleEndian.AppendUint16(header, snapshotVersion)
+	header = binary.LittleEndian.AppendUint16(header, 0)
+	header = binary.LittleEndian.AppendUint64(header, uint64(s.Trie.Len()))
+	if _, err := out.Write(header); err != nil {
+		return cw.n, err
+	}
+
+	var record, value []byte
+	for bits := range s.Trie {
+		prefixes := slices.SortedFunc(maps.Keys(s.Trie[bits]), func(a, b netip.Prefix) int {
+			return a.Addr().Compare(b.Addr())
+		})
+
+		for _, prefix := range prefixes {
+			record = record[:0]
+			if prefix.Addr().Is4() {
+				record = append(record, 4, byte(bits))
+			} else {
+				record = append(record, 6, byte(bits))
+			}
+			record = append(record, prefix.Addr().AsSlice()...)
+
+			value = s.Values.AppendValue(value[:0], s.Trie[bits][prefix])
+			record = binary.AppendUvarint(record, uint64(len(value)))
+			record = append(record, value...)
+
+			if _, err := out.Write(record); err != nil {
+				return cw.n, err
+			}
+		}
+	}
+
+	if err := binary.Write(bw, binary.LittleEndian, crc.Sum32()); err != nil {
+		return cw.n, err
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ReadFrom reads a snapshot from r until EOF and replaces the trie with
+// its contents.
+func (s *MapTrieSnapshot[V]) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	src := &snapshotReader{r: bufio.NewReader(cr), crc: crc32.New(snapshotCRCTable)}
+
+	header := src.next(16)
+	if src.err != nil {
+		return cr.n, fmt.Errorf("read snapshot header: %w", src.err)
+	}
+	if string(header[:4]) != snapshotMagic {
+		return cr.n, fmt.Errorf("invalid snapshot magic %q", header[:4])
+	}
+	if version := binary.LittleEndian.Uint16(header[4:]); version != snapshotVersion {
+		return cr.n, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	count := binary.LittleEndian.Uint64(header[8:])
+
+	trie := NewMapTrie[netip.Prefix, netip.Addr, V](0)
+	for idx := range count {
+		head := src.next(2)
+		family, bits := head[0], int(head[1])
+
+		var addr netip.Addr
+		switch {
+		case src.err != nil:
+			return cr.n, fmt.Errorf("read record %d: %w", idx, src.err)
+		case family == 4:
+			addr = netip.AddrFrom4([4]byte(src.next(4)))
+		case family == 6:
+			addr = netip.AddrFrom16([16]byte(src.next(16)))
+		default:
+			return cr.n, fmt.Errorf("record %d: invalid address family %d", idx, family)
+		}
+
+		size := src.uvarint()
+		if src.err == nil && size > snapshotMaxValue {
+			return cr.n, fmt.Errorf("record %d: value length %d exceeds %d", idx, size, snapshotMaxValue)
+		}
+		raw := src.next(int(size))
+		if src.err != nil {
+			return cr.n, fmt.Errorf("read record %d: %w", idx, src.err)
+		}
+
+		prefix := netip.PrefixFrom(addr, bits)
+		if !prefix.IsValid() || prefix.Masked() != prefix {
+			return cr.n, fmt.Errorf("record %d: invalid prefix %s", idx, prefix)
+		}
+		value, err := s.Values.DecodeValue(raw)
+		if err != nil {
+			return cr.n, fmt.Errorf("record %d: %w", idx, err)
+		}
+		trie[bits][prefix] = value
+	}
+
+	sum := src.crc.Sum32()
+	trailer := src.next(4)
+	if src.err != nil {
+		return cr.n, fmt.Errorf("read snapshot trailer: %w", src.err)
+	}
+	if binary.LittleEndian.Uint32(trailer) != sum {
+		return cr.n, ErrSnapshotChecksum
+	}
+	if _, err := src.r.ReadByte(); err != io.EOF {
+		return cr.n, errors.New("unexpected data after snapshot trailer")
+	}
+	if trie.Len() != int(count) {
+		return cr.n, fmt.Errorf("snapshot holds %d unique prefixes, header says %d", trie.Len(), count)
+	}
+
+	s.Trie = trie
+	return cr.n, nil
+}
+
+// snapshotReader reads snapshot fields, feeds them to the checksum and
+// remembers the first error.
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	buf []byte
+	err error
+}
+
+// next returns the next n bytes. The slice is valid until the next call.
+func (r *snapshotReader) next(n int) []byte {
+	r.buf = slices.Grow(r.buf[:0], n)[:n]
+	if r.err != nil {
+		return r.buf
+	}
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		r.err = noEOF(err)
+		return r.buf
+	}
+	r.crc.Write(r.buf)
+	return r.buf
+}
+
+func (r *snapshotReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, err := binary.ReadUvarint(r)
+	r.err = noEOF(err)
+	return value
+}
+
+// ReadByte makes snapshotReader an io.ByteReader for binary.ReadUvarint.
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+// noEOF reports a truncated snapshot as io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSnapshot encodes the trie and checks the reported size
+func writeSnapshot[V any](t *testing.T, trie MapTrie[netip.Prefix, netip.Addr, V], codec ValueCodec[V]) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	snapshot := MapTrieSnapshot[V]{Trie: trie, Values: codec}
+	n, err := snapshot.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+	return buf.Bytes()
+}
+
+// TestMapTrieSnapshotRoundTrip tests that a restored trie holds the same
+// prefixes and answers lookups like the original one
+func TestMapTrieSnapshotRoundTrip(t *testing.T) {
+	prefixes := referencePrefixes(2000)
+	values := datacenterValues(len(prefixes))
+	addrs := referenceAddrs(prefixes, 2000)
+
+	t.Run("string values", func(t *testing.T) {
+		trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+		for idx, prefix := range prefixes {
+			trie.InsertOrUpdate(prefix, onEmptyString(values[idx]), onUpdateString(values[idx]))
+		}
+		data := writeSnapshot(t, trie, StringCodec{})
+
+		restored := MapTrieSnapshot[string]{Values: StringCodec{}}
+		n, err := restored.ReadFrom(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), n)
+		assert.Equal(t, trie.Dump(), restored.Trie.Dump())
+
+		for _, addr := range addrs {
+			wantPrefix, want, wantOk := trie.Lookup(addr)
+			prefix, got, ok := restored.Trie.Lookup(addr)
+			require.Equal(t, wantOk, ok, "Lookup(%s)", addr)
+			require.Equal(t, wantPrefix, prefix, "Lookup(%s)", addr)
+			require.Equal(t, want, got, "Lookup(%s)", addr)
+		}
+
+		// Encoding is deterministic regardless of map iteration order.
+		assert.Equal(t, data, writeSnapshot(t, restored.Trie, StringCodec{}))
+	})
+
+	t.Run("uint32 values", func(t *testing.T) {
+		trie := NewMapTrie[netip.Prefix, netip.Addr, uint32](0)
+		for idx, prefix := range prefixes {
+			value := uint32(idx) * 2654435761
+			trie.InsertOrUpdate(prefix, func() uint32 { return value }, func(uint32) uint32 { return value })
+		}
+		data := writeSnapshot(t, trie, Uint32Codec{})
+
+		restored := MapTrieSnapshot[uint32]{Values: Uint32Codec{}}
+		_, err := restored.ReadFrom(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, trie.Dump(), restored.Trie.Dump())
+	})
+
+	t.Run("empty trie", func(t *testing.T) {
+		data := writeSnapshot(t, NewMapTrie[netip.Prefix, netip.Addr, string](0), StringCodec{})
+		assert.Len(t, data, 20)
+
+		restored := MapTrieSnapshot[string]{Values: StringCodec{}}
+		_, err := restored.ReadFrom(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 0, restored.Trie.Len())
+	})
+}
+
+// TestMapTrieSnapshotCorruption tests that damaged snapshots are rejected
+// and leave the current trie untouched
+func TestMapTrieSnapshotCorruption(t *testing.T) {
+	trie := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+	for idx, prefix := range referencePrefixes(100) {
+		trie.InsertOrUpdate(prefix, onEmptyString("DC"), onUpdateString(string(rune('A'+idx%26))))
+	}
+	data := writeSnapshot(t, trie, StringCodec{})
+
+	modify := func(fn func([]byte) []byte) []byte {
+		return fn(bytes.Clone(data))
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+		errText string
+	}{
+		{
+			name:    "flipped value byte",
+			data:    modify(func(b []byte) []byte { b[len(b)-5] ^= 0x01; return b }),
+			wantErr: ErrSnapshotChecksum,
+		},
+		{
+			name:    "flipped checksum byte",
+			data:    modify(func(b []byte) []byte { b[len(b)-1] ^= 0x80; return b }),
+			wantErr: ErrSnapshotChecksum,
+		},
+		{
+			name:    "truncated record",
+			data:    data[:len(data)/2],
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "truncated trailer",
+			data:    data[:len(data)-2],
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "empty input",
+			data:    nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "bad magic",
+			data:    modify(func(b []byte) []byte { copy(b, "LPMX"); return b }),
+			errText: "invalid snapshot magic",
+		},
+		{
+			name:    "unsupported version",
+			data:    modify(func(b []byte) []byte { binary.LittleEndian.PutUint16(b[4:], 2); return b }),
+			errText: "unsupported snapshot version 2",
+		},
+		{
+			name:    "invalid family",
+			data:    modify(func(b []byte) []byte { b[16] = 5; return b }),
+			errText: "invalid address family 5",
+		},
+		{
+			name:    "trailing data",
+			data:    append(bytes.Clone(data), 0),
+			errText: "unexpected data after snapshot trailer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := NewMapTrie[netip.Prefix, netip.Addr, string](0)
+			previous.InsertOrUpdate(netip.MustParsePrefix("10.0.0.0/8"), onEmptyString("DC1"), onUpdateString("DC1"))
+			snapshot := MapTrieSnapshot[string]{Trie: previous, Values: StringCodec{}}
+
+			_, err := snapshot.ReadFrom(bytes.NewReader(tt.data))
+			require.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if tt.errText != "" {
+				assert.ErrorContains(t, err, tt.errText)
+			}
+			assert.Equal(t, 1, snapshot.Trie.Len(), "failed read must keep the previous trie")
+		})
+	}
+}
+
+// TestUint32CodecRejectsInvalid tests value codec error reporting
+func TestUint32CodecRejectsInvalid(t *testing.T) {
+	codec := Uint32Codec{}
+
+	_, err := codec.DecodeValue(binary.AppendUvarint(nil, 1<<32))
+	assert.Error(t, err)
+	_, err = codec.DecodeValue(append(codec.AppendValue(nil, 7), 0))
+	assert.Error(t, err)
+
+	value, err := codec.DecodeValue(codec.AppendValue(nil, 1<<32-1))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1<<32-1), value)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sakateka/lpm"
+)
+
+var (
+	sweepMin        = flag.Int("sweep-min", 1000, "smallest table size of BenchmarkScalingSweep")
+	sweepMax        = flag.Int("sweep-max", 10_000_000, "largest table size of BenchmarkScalingSweep")
+	sweepLPMIPv6Max = flag.Int("sweep-lpm-ipv6-max", 1000_000, "largest IPv6 table size of lpm in BenchmarkScalingSweep, 1M IPv6 prefixes take 3 GB")
+	sweepPerDecade  = flag.Int("sweep-per-decade", 2, "table sizes per power of ten in BenchmarkScalingSweep")
+	sweepOut        = flag.String("sweep-out", "", "CSV file to write the series of BenchmarkScalingSweep to")
+)
+
+// sweepImplementation is an implementation of the sweep. load returns a
+// lookup and, for lpm, the table statistics.
+type sweepImplementation struct {
+	name     string
+	ipv4Only bool
+	load     func(prefixes []netip.Prefix, values []string) (func(netip.Addr) bool, *lpm.Stats, error)
+}
+
+// sweepImplementations returns the implementations of the sweep.
+func sweepImplementations() []sweepImplementation {
+	implementations := []sweepImplementation{
+		{
+			name: "lpm",
+			load: func(prefixes []netip.Prefix, values []string) (func(netip.Addr) bool, *lpm.Stats, error) {
+				table := lpm.New()
+				for i, prefix := range prefixes {
+					table.Insert(prefix, values[i])
+				}
+				stats := table.Stats()
+				return func(addr netip.Addr) bool {
+					_, ok := table.Lookup(addr)
+					return ok
+				}, &stats, nil
+			},
+		},
+	}
+	for _, impl := range valueTypeImplementations[string]() {
+		implementations = append(implementations, sweepImplementation{impl.name, impl.ipv4Only,
+			func(prefixes []netip.Prefix, values []string) (func(netip.Addr) bool, *lpm.Stats, error) {
+				lookup, err := impl.load(prefixes, values)
+				return lookup, nil, err
+			}})
+	}
+	return implementations
+}
+
+// sweepAddrs returns 1,000 lookup addresses, the first and last addresses
+// of prefixes spread over the table, so that every table size has the
+// same hit rate.
+func sweepAddrs(prefixes []netip.Prefix) []netip.Addr {
+	addrs := make([]netip.Addr, 1000)
+	for i := range addrs {
+		prefix := prefixes[i*len(prefixes)/len(addrs)]
+		if i%2 == 0 {
+			addrs[i] = prefix.Addr()
+		} else {
+			addrs[i] = prefixLastAddr(prefix)
+		}
+	}
+	return addrs
+}
+
+// BenchmarkScalingSweep benchmarks lookups of every implementation at
+// table sizes from -sweep-min to -sweep-max prefixes, spaced evenly on a
+// logarithmic scale. IPv6 tables of lpm stop at -sweep-lpm-ipv6-max.
+// build-ns/prefix is the build time and heap-bytes/prefix the heap growth
+// per prefix; lpm also reports lpm.Stats(). With -sweep-out the points,
+// averaged over -count runs, are written as CSV and the crossovers
+// between implementations are printed, as the log of a benchmark with
+// sub-benchmarks is not shown.
+func BenchmarkScalingSweep(b *testing.B) {
+	datasets := []struct {
+		name     string
+		ipv4     bool
+		prefixes func(n int) []netip.Prefix
+	}{
+		{"ipv4", true, randomIPv4Prefixes},
+		{"ipv6", false, randomIPv6Prefixes},
+	}
+	sizes := SweepSizes(*sweepMin, *sweepMax, *sweepPerDecade)
+
+	var points []SweepPoint
+	for _, ds := range datasets {
+		all := ds.prefixes(sizes[len(sizes)-1])
+		for _, n := range sizes {
+			prefixes := all[:n]
+			addrs := sweepAddrs(prefixes)
+
+			for _, impl := range sweepImplementations() {
+				if impl.ipv4Only && !ds.ipv4 {
+					continue
+				}
+				if impl.name == "lpm" && !ds.ipv4 && n > *sweepLPMIPv6Max {
+					continue
+				}
+				b.Run(fmt.Sprintf("%s/%d/%s", ds.name, n, impl.name), func(b *testing.B) {
+					values := datacenterValues(n)
+
+					// Measure memory before insertion
+					runtime.GC()
+					var memBefore runtime.MemStats
+					runtime.ReadMemStats(&memBefore)
+
+					start := time.Now()
+					lookup, stats, err := impl.load(prefixes, values)
+					build := time.Since(start)
+					if err != nil {
+						b.Fatalf("load: %v", err)
+					}
+
+					// Measure memory after insertion
+					runtime.GC()
+					var memAfter runtime.MemStats
+					runtime.ReadMemStats(&memAfter)
+
+					allocDiff := memAfter.Alloc - memBefore.Alloc
+					b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB), build: %v",
+						n, allocDiff, float64(allocDiff)/(1024*1024), build)
+
+					b.ResetTimer()
+					b.ReportAllocs()
+					captureProfiles(b)
+
+					idx := 0
+					foundCount := 0
+					for b.Loop() {
+						if lookup(addrs[idx]) {
+							foundCount++
+						}
+						idx = (idx + 1) % len(addrs)
+					}
+
+					if foundCount == 0 {
+						b.Fatalf("No successful lookups in %d iterations", b.N)
+					}
+
+					point := SweepPoint{
+						Dataset:        ds.name,
+						Implementation: impl.name,
+						Prefixes:       n,
+						BuildNs:        float64(build.Nanoseconds()) / float64(n),
+						LookupNs:       float64(b.Elapsed().Nanoseconds()) / float64(b.N),
+						HeapBytes:      float64(allocDiff) / float64(n),
+						LPMStats:       stats,
+					}
+					points = append(points, point)
+
+					b.ReportMetric(point.BuildNs, "build-ns/prefix")
+					b.ReportMetric(point.HeapBytes, "heap-bytes/prefix")
+					if stats != nil {
+						b.Logf("lpm.v4Blocks: %d, lpm.v6Blocks: %d, total size: %d", stats.IPv4Blocks, stats.IPv6Blocks, stats.TotalSize)
+						b.ReportMetric(float64(stats.TotalSize), "table-bytes")
+						b.ReportMetric(float64(stats.IPv4Blocks+stats.IPv6Blocks), "lpm-blocks")
+					}
+				})
+			}
+		}
+	}
+
+	if *sweepOut == "" || len(points) == 0 {
+		return
+	}
+	f, err := os.Create(*sweepOut)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	points = AverageSweepPoints(points)
+	if err := WriteSweepCSV(f, points); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, metric := range []struct {
+		name  string
+		value func(SweepPoint) float64
+	}{
+		{"lookup-ns", func(p SweepPoint) float64 { return p.LookupNs }},
+		{"build-ns/prefix", func(p SweepPoint) float64 { return p.BuildNs }},
+		{"heap-bytes/prefix", func(p SweepPoint) float64 { return p.HeapBytes }},
+	} {
+		for _, c := range SweepCrossovers(points, metric.name, metric.value) {
+			fmt.Printf("crossover: %s %s: %s overtakes %s between %d and %d prefixes\n",
+				c.Dataset, c.Metric, c.Leader, c.Trailer, c.From, c.To)
+		}
+	}
+	fmt.Printf("sweep: wrote %d points to %s\n", len(points), *sweepOut)
+}
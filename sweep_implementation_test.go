@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/sakateka/lpm"
+)
+
+// SweepPoint is the measurement of an implementation at one table size.
+type SweepPoint struct {
+	Dataset        string
+	Implementation string
+	Prefixes       int
+	BuildNs        float64    // Build time per prefix
+	LookupNs       float64    // Time per lookup
+	HeapBytes      float64    // Heap bytes per prefix
+	LPMStats       *lpm.Stats // Structure of the table, for lpm only
+}
+
+// SweepSizes returns table sizes from minN to maxN, spaced evenly on a
+// logarithmic scale with perDecade sizes per power of ten. maxN is always
+// included.
+func SweepSizes(minN, maxN, perDecade int) []int {
+	var sizes []int
+	for i := 0; ; i++ {
+		n := int(math.Round(float64(minN) * math.Pow(10, float64(i)/float64(perDecade))))
+		if n >= maxN {
+			break
+		}
+		if len(sizes) == 0 || sizes[len(sizes)-1] != n {
+			sizes = append(sizes, n)
+		}
+	}
+	return append(sizes, maxN)
+}
+
+// AverageSweepPoints merges the points of the same dataset,
+// implementation and size, as produced by -count, into one with the mean
+// of their measurements. The order of first appearance is kept.
+func AverageSweepPoints(points []SweepPoint) []SweepPoint {
+	type key struct {
+		dataset, implementation string
+		prefixes                int
+	}
+	index := map[key]int{}
+	var merged []SweepPoint
+	var counts []float64
+	for _, p := range points {
+		k := key{p.Dataset, p.Implementation, p.Prefixes}
+		idx, ok := index[k]
+		if !ok {
+			index[k] = len(merged)
+			merged = append(merged, p)
+			counts = append(counts, 1)
+			continue
+		}
+		m := &merged[idx]
+		m.BuildNs += p.BuildNs
+		m.LookupNs += p.LookupNs
+		m.HeapBytes += p.HeapBytes
+		counts[idx]++
+	}
+	for idx := range merged {
+		merged[idx].BuildNs /= counts[idx]
+		merged[idx].LookupNs /= counts[idx]
+		merged[idx].HeapBytes /= counts[idx]
+	}
+	return merged
+}
+
+// sweepCSVHeader are the columns written by WriteSweepCSV.
+var sweepCSVHeader = []string{
+	"dataset", "implementation", "prefixes", "build_ns_per_prefix", "lookup_ns", "heap_bytes_per_prefix",
+	"lpm_total_size", "lpm_ipv4_blocks", "lpm_ipv6_blocks",
+}
+
+// WriteSweepCSV writes the points as CSV, one row per point, for plotting
+// a metric against the number of prefixes per dataset and
+// implementation. The lpm columns are empty for other implementations.
+func WriteSweepCSV(w io.Writer, points []SweepPoint) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(sweepCSVHeader); err != nil {
+		return err
+	}
+
+	float := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, p := range points {
+		row := []string{p.Dataset, p.Implementation, strconv.Itoa(p.Prefixes), float(p.BuildNs), float(p.LookupNs), float(p.HeapBytes), "", "", ""}
+		if p.LPMStats != nil {
+			row[6] = strconv.Itoa(p.LPMStats.TotalSize)
+			row[7] = strconv.Itoa(p.LPMStats.IPv4Blocks)
+			row[8] = strconv.Itoa(p.LPMStats.IPv6Blocks)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// SweepCrossover is a pair of implementations whose order by a metric,
+// lower being better, changes between two consecutive table sizes.
+type SweepCrossover struct {
+	Dataset string
+	Metric  string
+	From    int
+	To      int
+	// Leader has the lower value at To and had the higher one at From.
+	Leader  string
+	Trailer string
+}
+
+// SweepCrossovers returns the crossovers of every pair of implementations
+// by the metric, in order of dataset, size and implementation names.
+// Only sizes measured for both implementations are compared.
+func SweepCrossovers(points []SweepPoint, metric string, value func(SweepPoint) float64) []SweepCrossover {
+	type key struct {
+		dataset, implementation string
+	}
+	values := map[key]map[int]float64{}
+	var datasets, implementations []string
+	var sizes []int
+	for _, p := range points {
+		k := key{p.Dataset, p.Implementation}
+		if values[k] == nil {
+			values[k] = map[int]float64{}
+		}
+		values[k][p.Prefixes] = value(p)
+		datasets = append(datasets, p.Dataset)
+		implementations = append(implementations, p.Implementation)
+		sizes = append(sizes, p.Prefixes)
+	}
+	slices.Sort(datasets)
+	slices.Sort(implementations)
+	slices.Sort(sizes)
+	datasets, implementations, sizes = slices.Compact(datasets), slices.Compact(implementations), slices.Compact(sizes)
+
+	var crossovers []SweepCrossover
+	for _, dataset := range datasets {
+		for i, a := range implementations {
+			for _, b := range implementations[i+1:] {
+				va, vb := values[key{dataset, a}], values[key{dataset, b}]
+
+				// prevSign is the sign of a - b at the previous size
+				// where they differ.
+				prev, prevSign := 0, 0
+				for _, n := range sizes {
+					x, okA := va[n]
+					y, okB := vb[n]
+					if !okA || !okB || x == y {
+						continue
+					}
+					sign := cmp.Compare(x, y)
+					if prevSign != 0 && sign != prevSign {
+						c := SweepCrossover{Dataset: dataset, Metric: metric, From: prev, To: n, Leader: a, Trailer: b}
+						if sign > 0 {
+							c.Leader, c.Trailer = b, a
+						}
+						crossovers = append(crossovers, c)
+					}
+					prev, prevSign = n, sign
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(crossovers, func(x, y SweepCrossover) int {
+		return cmp.Or(cmp.Compare(x.Dataset, y.Dataset), cmp.Compare(x.To, y.To))
+	})
+	return crossovers
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/sakateka/lpm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSweepSizes tests logarithmically spaced table sizes
+func TestSweepSizes(t *testing.T) {
+	assert.Equal(t, []int{1000, 10000, 100000, 1000000}, SweepSizes(1000, 1000_000, 1))
+	assert.Equal(t, []int{1000, 3162, 10000, 31623, 100000}, SweepSizes(1000, 100_000, 2))
+	assert.Equal(t, []int{1000, 3162, 10000, 31623, 100000, 200000}, SweepSizes(1000, 200_000, 2), "the maximum is always included")
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 8, 10}, SweepSizes(1, 10, 10), "rounded duplicates are dropped")
+	assert.Equal(t, []int{500}, SweepSizes(1000, 500, 2))
+}
+
+// TestSweepCrossovers tests detection of changes of the order of two
+// implementations
+func TestSweepCrossovers(t *testing.T) {
+	var points []SweepPoint
+	add := func(dataset, impl string, values ...float64) {
+		for i, v := range values {
+			points = append(points, SweepPoint{Dataset: dataset, Implementation: impl, Prefixes: []int{1000, 10000, 100000, 1000000}[i], LookupNs: v})
+		}
+	}
+	// fast wins at small sizes, flat wins from 100000 on; equal values at
+	// 10000 do not hide the change.
+	add("ipv4", "fast", 10, 20, 40, 80)
+	add("ipv4", "flat", 30, 20, 30, 30)
+	// slow is always behind.
+	add("ipv4", "slow", 100, 100, 100, 100)
+	add("ipv6", "fast", 10, 20)
+	add("ipv6", "flat", 30, 10)
+
+	crossovers := SweepCrossovers(points, "lookup-ns", func(p SweepPoint) float64 { return p.LookupNs })
+	assert.Equal(t, []SweepCrossover{
+		{Dataset: "ipv4", Metric: "lookup-ns", From: 1000, To: 100000, Leader: "flat", Trailer: "fast"},
+		{Dataset: "ipv6", Metric: "lookup-ns", From: 1000, To: 10000, Leader: "flat", Trailer: "fast"},
+	}, crossovers)
+
+	assert.Empty(t, SweepCrossovers(points, "heap-bytes", func(SweepPoint) float64 { return 1 }))
+}
+
+// TestWriteSweepCSV tests the CSV series
+func TestWriteSweepCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSweepCSV(&buf, []SweepPoint{
+		{Dataset: "ipv4", Implementation: "lpm", Prefixes: 1000, BuildNs: 900.5, LookupNs: 5.25, HeapBytes: 420,
+			LPMStats: &lpm.Stats{TotalSize: 394595, IPv4Blocks: 324, IPv6Blocks: 1}},
+		{Dataset: "ipv4", Implementation: "maptrie", Prefixes: 1000, BuildNs: 111, LookupNs: 741.5, HeapBytes: 52.125},
+	}))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		sweepCSVHeader,
+		{"ipv4", "lpm", "1000", "900.50", "5.25", "420.00", "394595", "324", "1"},
+		{"ipv4", "maptrie", "1000", "111.00", "741.50", "52.12", "", "", ""},
+	}, rows)
+}
+
+// TestAverageSweepPoints tests merging of repeated measurements
+func TestAverageSweepPoints(t *testing.T) {
+	stats := &lpm.Stats{TotalSize: 100}
+	points := AverageSweepPoints([]SweepPoint{
+		{Dataset: "ipv4", Implementation: "lpm", Prefixes: 1000, BuildNs: 10, LookupNs: 4, HeapBytes: 100, LPMStats: stats},
+		{Dataset: "ipv4", Implementation: "maptrie", Prefixes: 1000, BuildNs: 5, LookupNs: 50, HeapBytes: 60},
+		{Dataset: "ipv4", Implementation: "lpm", Prefixes: 1000, BuildNs: 20, LookupNs: 6, HeapBytes: 100, LPMStats: stats},
+		{Dataset: "ipv4", Implementation: "lpm", Prefixes: 10000, BuildNs: 30, LookupNs: 8, HeapBytes: 90, LPMStats: stats},
+		{Dataset: "ipv4", Implementation: "lpm", Prefixes: 1000, BuildNs: 30, LookupNs: 8, HeapBytes: 100, LPMStats: stats},
+	})
+	assert.Equal(t, []SweepPoint{
+		{Dataset: "ipv4", Implementation: "lpm", Prefixes: 1000, BuildNs: 20, LookupNs: 6, HeapBytes: 100, LPMStats: stats},
+		{Dataset: "ipv4", Implementation: "maptrie", Prefixes: 1000, BuildNs: 5, LookupNs: 50, HeapBytes: 60},
+		{Dataset: "ipv4", Implementation: "lpm", Prefixes: 10000, BuildNs: 30, LookupNs: 8, HeapBytes: 90, LPMStats: stats},
+	}, points)
+	assert.Empty(t, AverageSweepPoints(nil))
+}
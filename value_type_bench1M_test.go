@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kentik/patricia"
+	"github.com/kentik/patricia/generics_tree"
+	"github.com/sakateka/lpm"
+)
+
+// routeAttrs is a pointer-free value larger than a next hop index, close
+// to the attributes a RIB keeps for a route.
+type routeAttrs struct {
+	NextHop     [16]byte
+	IfIndex     uint32
+	Metric      uint32
+	LocalPref   uint32
+	MED         uint32
+	Communities [4]uint32
+}
+
+// newRouteAttrs returns distinct attributes for the i-th prefix.
+func newRouteAttrs(i int) routeAttrs {
+	attrs := routeAttrs{IfIndex: uint32(i % 64), Metric: uint32(i), LocalPref: 100}
+	attrs.NextHop[0], attrs.NextHop[15] = 10, byte(i)
+	return attrs
+}
+
+// tableImplementation is a benchmarked table with values of type V. load
+// returns a lookup reporting whether the address matched, or an error if
+// the table cannot be built.
+type tableImplementation[V any] struct {
+	name     string
+	ipv4Only bool
+	load     func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error)
+}
+
+// valueTypeImplementations returns the implementations that can store any
+// value type.
+func valueTypeImplementations[V any]() []tableImplementation[V] {
+	return []tableImplementation[V]{
+		{
+			name: "maptrie",
+			load: func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error) {
+				trie := NewMapTrie[netip.Prefix, netip.Addr, V](0)
+				for i, prefix := range prefixes {
+					value := values[i]
+					trie.InsertOrUpdate(prefix, func() V { return value }, func(V) V { return value })
+				}
+				return func(addr netip.Addr) bool {
+					_, _, ok := trie.Lookup(addr)
+					return ok
+				}, nil
+			},
+		},
+		{
+			name: "patricia",
+			load: func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error) {
+				tree4, tree6 := generics_tree.NewTreeV4[V](), generics_tree.NewTreeV6[V]()
+				for i, prefix := range prefixes {
+					addr := prefix.Addr()
+					if addr.Is4() {
+						_, _ = tree4.Set(patricia.NewIPv4AddressFromBytes(addr.AsSlice(), uint(prefix.Bits())), values[i])
+					} else {
+						_, _ = tree6.Set(patricia.NewIPv6Address(addr.AsSlice(), uint(prefix.Bits())), values[i])
+					}
+				}
+				return func(addr netip.Addr) bool {
+					if addr.Is4() {
+						ok, _ := tree4.FindDeepestTag(patricia.NewIPv4AddressFromBytes(addr.AsSlice(), 32))
+						return ok
+					}
+					ok, _ := tree6.FindDeepestTag(patricia.NewIPv6Address(addr.AsSlice(), 128))
+					return ok
+				}, nil
+			},
+		},
+		{
+			name: "radix_trie",
+			load: func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error) {
+				trie := NewRadixTrie[V]()
+				for i, prefix := range prefixes {
+					trie.Insert(prefix, values[i])
+				}
+				return func(addr netip.Addr) bool {
+					_, _, ok := trie.Lookup(addr)
+					return ok
+				}, nil
+			},
+		},
+		{
+			name: "binary_trie",
+			load: func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error) {
+				trie := NewBinaryTrie[V]()
+				for i, prefix := range prefixes {
+					trie.Insert(prefix, values[i])
+				}
+				return func(addr netip.Addr) bool {
+					_, _, ok := trie.Lookup(addr)
+					return ok
+				}, nil
+			},
+		},
+		{
+			// The IPv6 tables of SAIL stop at /64, so a 1M IPv6 table would
+			// be partial; see sailBenchmarks.
+			name:     "sail",
+			ipv4Only: true,
+			load: func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error) {
+				sail := NewSAILv4[V]()
+				for i, prefix := range prefixes {
+					if err := sail.Insert(prefix, values[i]); err != nil {
+						return nil, fmt.Errorf("Insert: %w", err)
+					}
+				}
+				return func(addr netip.Addr) bool {
+					_, ok := sail.Lookup(addr)
+					return ok
+				}, nil
+			},
+		},
+		{
+			name:     "lc_trie",
+			ipv4Only: true,
+			load: func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error) {
+				trie := NewLCTrie[V](DefaultLCTrieConfig())
+				for i, prefix := range prefixes {
+					value := values[i]
+					trie.InsertOrUpdate(prefix, func() V { return value }, func(V) V { return value })
+				}
+				return func(addr netip.Addr) bool {
+					_, _, ok := trie.Lookup(addr)
+					return ok
+				}, nil
+			},
+		},
+		{
+			name:     "dxr",
+			ipv4Only: true,
+			load: func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error) {
+				dxr, err := NewDXR(16, prefixes, values)
+				if err != nil {
+					return nil, fmt.Errorf("NewDXR: %w", err)
+				}
+				return func(addr netip.Addr) bool {
+					_, ok := dxr.Lookup(addr)
+					return ok
+				}, nil
+			},
+		},
+	}
+}
+
+// benchmarkValueType loads the prefixes with values produced by newValue
+// and benchmarks lookups.
+//
+// The values are created after the first measurement and only the table
+// keeps them alive, so heap-bytes includes memory referenced by values.
+// gc-cycles and gc-pause-ns cover the load, full-gc-ns is the duration
+// of a forced collection with the loaded table, which grows with the
+// number of pointers the collector has to scan.
+func benchmarkValueType[V any](b *testing.B, prefixes []netip.Prefix, addrs []netip.Addr, newValue func(int) V,
+	load func(prefixes []netip.Prefix, values []V) (func(netip.Addr) bool, error)) {
+	// Measure memory before insertion
+	runtime.GC()
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+
+	lookup, err := func() (func(netip.Addr) bool, error) {
+		values := make([]V, len(prefixes))
+		for i := range values {
+			values[i] = newValue(i)
+		}
+		return load(prefixes, values)
+	}()
+	if err != nil {
+		b.Fatalf("load: %v", err)
+	}
+
+	// GC statistics of the load, before the forced collections below
+	var memLoaded runtime.MemStats
+	runtime.ReadMemStats(&memLoaded)
+
+	// Measure memory after insertion
+	runtime.GC()
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
+
+	start := time.Now()
+	runtime.GC()
+	fullGC := time.Since(start)
+
+	allocDiff := memAfter.Alloc - memBefore.Alloc
+	gcCycles := memLoaded.NumGC - memBefore.NumGC
+	gcPause := memLoaded.PauseTotalNs - memBefore.PauseTotalNs
+
+	b.Logf("Memory usage after %d inserts: Alloc=%d bytes (%.2f MB), GC cycles: %d, GC pause: %v, full GC: %v",
+		len(prefixes), allocDiff, float64(allocDiff)/(1024*1024), gcCycles, time.Duration(gcPause), fullGC)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	captureProfiles(b)
+
+	idx := 0
+	foundCount := 0
+	for b.Loop() {
+		if lookup(addrs[idx]) {
+			foundCount++
+		}
+		idx = (idx + 1) % len(addrs)
+	}
+
+	if foundCount == 0 {
+		b.Fatalf("No successful lookups in %d iterations", b.N)
+	}
+
+	b.ReportMetric(float64(allocDiff), "heap-bytes")
+	b.ReportMetric(float64(gcCycles), "gc-cycles")
+	b.ReportMetric(float64(gcPause), "gc-pause-ns")
+	b.ReportMetric(float64(fullGC.Nanoseconds()), "full-gc-ns")
+}
+
+// runValueTypeImplementations runs benchmarkValueType for every
+// implementation with values of type V.
+func runValueTypeImplementations[V any](b *testing.B, dataset string, ipv4 bool, prefixes []netip.Prefix, addrs []netip.Addr,
+	valueType string, newValue func(int) V) {
+	for _, impl := range valueTypeImplementations[V]() {
+		if impl.ipv4Only && !ipv4 {
+			continue
+		}
+		b.Run(dataset+"/"+impl.name+"/"+valueType, func(b *testing.B) {
+			benchmarkValueType(b, prefixes, addrs, newValue, impl.load)
+		})
+	}
+}
+
+// BenchmarkValueTypeLookup1M benchmarks every implementation with 1M
+// prefixes holding uint32 next hop indexes, strings and routeAttrs
+// structs. lpm only stores strings.
+func BenchmarkValueTypeLookup1M(b *testing.B) {
+	datasets := []struct {
+		name     string
+		ipv4     bool
+		prefixes []netip.Prefix
+		addrs    []netip.Addr
+	}{
+		{"ipv4_1M_prefixes", true, randomIPv4Prefixes(1000_000), randomIPv4Addrs(1000)},
+		{"ipv6_1M_prefixes", false, randomIPv6Prefixes(1000_000), randomIPv6Addrs(1000)},
+	}
+
+	nextHopIndex := func(i int) uint32 { return uint32(i) }
+	datacenter := func(i int) string { return fmt.Sprintf("DC%d", i) }
+
+	for _, ds := range datasets {
+		runValueTypeImplementations(b, ds.name, ds.ipv4, ds.prefixes, ds.addrs, "uint32", nextHopIndex)
+		runValueTypeImplementations(b, ds.name, ds.ipv4, ds.prefixes, ds.addrs, "string", datacenter)
+		runValueTypeImplementations(b, ds.name, ds.ipv4, ds.prefixes, ds.addrs, "struct", newRouteAttrs)
+
+		b.Run(ds.name+"/lpm/string", func(b *testing.B) {
+			benchmarkValueType(b, ds.prefixes, ds.addrs, datacenter, func(prefixes []netip.Prefix, values []string) (func(netip.Addr) bool, error) {
+				table := lpm.New()
+				for i, prefix := range prefixes {
+					table.Insert(prefix, values[i])
+				}
+				return func(addr netip.Addr) bool {
+					_, ok := table.Lookup(addr)
+					return ok
+				}, nil
+			})
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// vrfLayouts are the ways of spreading 1M prefixes over VRFs: many small
+// VRFs as on a PE router with customer VRFs, and a few large ones.
+var vrfLayouts = []struct {
+	name   string
+	vrfs   int
+	perVRF int
+}{
+	{"1000x1000", 1000, 1000},
+	{"4x250000", 4, 250_000},
+}
+
+// vrfRoutes returns distinct IPv4 prefixes for every VRF. Half of the
+// prefixes of a VRF are common to all VRFs, like shared services, and the
+// other half are its own.
+func vrfRoutes(vrfs, perVRF int) ([][]netip.Prefix, error) {
+	common := perVRF / 2
+	own := perVRF - common
+
+	// Short random prefixes repeat once masked, so draw more than needed.
+	need := common + vrfs*own
+	all := make([]netip.Prefix, 0, need)
+	seen := make(map[netip.Prefix]struct{}, need)
+	for _, prefix := range randomIPv4Prefixes(3 * need) {
+		if _, ok := seen[prefix]; ok {
+			continue
+		}
+		seen[prefix] = struct{}{}
+		if all = append(all, prefix); len(all) == need {
+			break
+		}
+	}
+	if len(all) < need {
+		return nil, fmt.Errorf("%d distinct prefixes out of %d needed", len(all), need)
+	}
+
+	routes := make([][]netip.Prefix, vrfs)
+	for vrf := range routes {
+		start := common + vrf*own
+		routes[vrf] = append(all[:common:common], all[start:start+own]...)
+	}
+	return routes, nil
+}
+
+// BenchmarkVRFTable1M benchmarks memory and lookups of 1M IPv4 prefixes
+// spread over VRFs in one shared MapTrie keyspace versus one table per
+// VRF. delete-vrf-ns is the duration of one DeleteVRF after the loop.
+func BenchmarkVRFTable1M(b *testing.B) {
+	for _, layout := range vrfLayouts {
+		routes, err := vrfRoutes(layout.vrfs, layout.perVRF)
+		if err != nil {
+			b.Fatalf("vrfRoutes: %v", err)
+		}
+
+		// Half of the queries hit a prefix of the queried VRF.
+		rng := rand.New(rand.NewSource(48))
+		randomAddrs := randomIPv4Addrs(500)
+		type query struct {
+			vrf  VRFID
+			addr netip.Addr
+		}
+		queries := make([]query, 0, 1000)
+		for idx := range 500 {
+			vrf := rng.Intn(layout.vrfs)
+			queries = append(queries,
+				query{VRFID(vrf), routes[vrf][rng.Intn(len(routes[vrf]))].Addr()},
+				query{VRFID(vrf), randomAddrs[idx]},
+			)
+		}
+
+		for _, impl := range vrfTableImplementations[uint32]() {
+			b.Run(layout.name+"/"+impl.name, func(b *testing.B) {
+				// Measure memory before insertion
+				runtime.GC()
+				var memBefore runtime.MemStats
+				runtime.ReadMemStats(&memBefore)
+
+				table := impl.newTable()
+				for vrf, prefixes := range routes {
+					for idx, prefix := range prefixes {
+						table.Insert(VRFID(vrf), prefix, uint32(idx))
+					}
+				}
+
+				// Measure memory after insertion
+				runtime.GC()
+				var memAfter runtime.MemStats
+				runtime.ReadMemStats(&memAfter)
+
+				allocDiff := memAfter.Alloc - memBefore.Alloc
+				b.Logf("Memory: VRFs=%d Prefixes=%d Alloc=%d bytes (%.2f MB)",
+					layout.vrfs, table.Len(), allocDiff, float64(allocDiff)/(1024*1024))
+
+				b.ResetTimer()
+				b.ReportAllocs()
+				captureProfiles(b)
+
+				idx := 0
+				foundCount := 0
+				for b.Loop() {
+					q := queries[idx]
+					if _, _, ok := table.Lookup(q.vrf, q.addr); ok {
+						foundCount++
+					}
+					idx = (idx + 1) % len(queries)
+				}
+
+				if foundCount == 0 {
+					b.Fatalf("No prefixes found in %d iterations", b.N)
+				}
+
+				start := time.Now()
+				deleted := table.DeleteVRF(VRFID(layout.vrfs / 2))
+				deleteVRF := time.Since(start)
+				if deleted != len(routes[layout.vrfs/2]) {
+					b.Fatalf("DeleteVRF removed %d prefixes, want %d", deleted, len(routes[layout.vrfs/2]))
+				}
+
+				b.ReportMetric(float64(allocDiff), "heap-bytes")
+				b.ReportMetric(float64(deleteVRF.Nanoseconds()), "delete-vrf-ns")
+			})
+		}
+	}
+}
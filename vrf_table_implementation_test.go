@@ -0,0 +1,245 @@
+package main
+
+import (
+	"net/netip"
+)
+
+// VRFID identifies a VRF (virtual routing and forwarding instance).
+type VRFID uint32
+
+// VRFTable is a routing table holding the prefixes of many VRFs. The same
+// prefix may be present in several VRFs with different values, and
+// lookups never fall back to another VRF.
+type VRFTable[V any] interface {
+	Insert(vrf VRFID, prefix netip.Prefix, value V)
+	Delete(vrf VRFID, prefix netip.Prefix) bool
+	Lookup(vrf VRFID, addr netip.Addr) (netip.Prefix, V, bool)
+	// DeleteVRF removes all prefixes of the VRF and returns their number.
+	DeleteVRF(vrf VRFID) int
+	Len() int
+}
+
+// VRFPrefix is a MapTrie key made of a VRF and a prefix, which puts all
+// VRFs into one shared keyspace.
+type VRFPrefix struct {
+	VRF    VRFID
+	Prefix netip.Prefix
+}
+
+// Masked returns the key with the host bits of the prefix cleared.
+func (p VRFPrefix) Masked() VRFPrefix {
+	p.Prefix = p.Prefix.Masked()
+	return p
+}
+
+// Bits returns the prefix length.
+func (p VRFPrefix) Bits() int {
+	return p.Prefix.Bits()
+}
+
+// VRFAddr is the MapTrie query matching VRFPrefix keys.
+type VRFAddr struct {
+	VRF  VRFID
+	Addr netip.Addr
+}
+
+// BitLen returns the bit length of the address.
+func (a VRFAddr) BitLen() int {
+	return a.Addr.BitLen()
+}
+
+// Prefix returns the key of the VRF and the address masked to bits.
+func (a VRFAddr) Prefix(bits int) (VRFPrefix, error) {
+	prefix, err := a.Addr.Prefix(bits)
+	return VRFPrefix{VRF: a.VRF, Prefix: prefix}, err
+}
+
+// SharedVRFTable keeps all VRFs in one MapTrie keyed by VRFPrefix.
+//
+// There is no per-VRF overhead, but DeleteVRF has to scan the whole
+// table, and the maps do not shrink after deletions.
+type SharedVRFTable[V any] struct {
+	trie MapTrie[VRFPrefix, VRFAddr, V]
+	// counts is the number of prefixes per VRF, so that DeleteVRF stops
+	// as soon as the last prefix of the VRF is gone.
+	counts map[VRFID]int
+}
+
+// NewSharedVRFTable returns an empty SharedVRFTable.
+func NewSharedVRFTable[V any]() *SharedVRFTable[V] {
+	return &SharedVRFTable[V]{
+		trie:   NewMapTrie[VRFPrefix, VRFAddr, V](0),
+		counts: map[VRFID]int{},
+	}
+}
+
+// Insert adds the prefix to the VRF or replaces its value.
+func (t *SharedVRFTable[V]) Insert(vrf VRFID, prefix netip.Prefix, value V) {
+	t.trie.InsertOrUpdate(VRFPrefix{VRF: vrf, Prefix: prefix}, func() V {
+		t.counts[vrf]++
+		return value
+	}, func(V) V { return value })
+}
+
+// Delete removes the prefix from the VRF and reports whether it was
+// present.
+func (t *SharedVRFTable[V]) Delete(vrf VRFID, prefix netip.Prefix) bool {
+	key := VRFPrefix{VRF: vrf, Prefix: prefix.Masked()}
+	if _, ok := t.trie[key.Bits()][key]; !ok {
+		return false
+	}
+
+	delete(t.trie[key.Bits()], key)
+	if t.counts[vrf]--; t.counts[vrf] == 0 {
+		delete(t.counts, vrf)
+	}
+	return true
+}
+
+// Lookup returns the longest prefix of the VRF containing the address.
+func (t *SharedVRFTable[V]) Lookup(vrf VRFID, addr netip.Addr) (netip.Prefix, V, bool) {
+	key, value, ok := t.trie.Lookup(VRFAddr{VRF: vrf, Addr: addr})
+	return key.Prefix, value, ok
+}
+
+// DeleteVRF removes all prefixes of the VRF and returns their number.
+func (t *SharedVRFTable[V]) DeleteVRF(vrf VRFID) int {
+	count := t.counts[vrf]
+	delete(t.counts, vrf)
+
+	left := count
+	for bits := range t.trie {
+		if left == 0 {
+			break
+		}
+		for key := range t.trie[bits] {
+			if key.VRF == vrf {
+				delete(t.trie[bits], key)
+				left--
+			}
+		}
+	}
+
+	return count
+}
+
+// Len returns the number of prefixes of all VRFs.
+func (t *SharedVRFTable[V]) Len() int {
+	return t.trie.Len()
+}
+
+// PerVRFTable keeps a separate prefixTable per VRF.
+//
+// DeleteVRF drops the whole table of the VRF, but every VRF pays for the
+// fixed size of an empty table.
+type PerVRFTable[V any] struct {
+	tables   map[VRFID]prefixTable[V]
+	newTable func() prefixTable[V]
+	len      int
+}
+
+// NewPerVRFTable returns an empty PerVRFTable creating the table of each
+// VRF with newTable.
+func NewPerVRFTable[V any](newTable func() prefixTable[V]) *PerVRFTable[V] {
+	return &PerVRFTable[V]{
+		tables:   map[VRFID]prefixTable[V]{},
+		newTable: newTable,
+	}
+}
+
+// Insert adds the prefix to the VRF or replaces its value.
+func (t *PerVRFTable[V]) Insert(vrf VRFID, prefix netip.Prefix, value V) {
+	table, ok := t.tables[vrf]
+	if !ok {
+		table = t.newTable()
+		t.tables[vrf] = table
+	}
+
+	n := table.Len()
+	table.Insert(prefix, value)
+	t.len += table.Len() - n
+}
+
+// Delete removes the prefix from the VRF and reports whether it was
+// present. The table of the VRF is dropped with its last prefix.
+func (t *PerVRFTable[V]) Delete(vrf VRFID, prefix netip.Prefix) bool {
+	table, ok := t.tables[vrf]
+	if !ok || !table.Delete(prefix) {
+		return false
+	}
+
+	t.len--
+	if table.Len() == 0 {
+		delete(t.tables, vrf)
+	}
+	return true
+}
+
+// Lookup returns the longest prefix of the VRF containing the address.
+func (t *PerVRFTable[V]) Lookup(vrf VRFID, addr netip.Addr) (netip.Prefix, V, bool) {
+	table, ok := t.tables[vrf]
+	if !ok {
+		var zero V
+		return netip.Prefix{}, zero, false
+	}
+	return table.Lookup(addr)
+}
+
+// DeleteVRF removes all prefixes of the VRF and returns their number.
+func (t *PerVRFTable[V]) DeleteVRF(vrf VRFID) int {
+	table, ok := t.tables[vrf]
+	if !ok {
+		return 0
+	}
+
+	delete(t.tables, vrf)
+	t.len -= table.Len()
+	return table.Len()
+}
+
+// Len returns the number of prefixes of all VRFs.
+func (t *PerVRFTable[V]) Len() int {
+	return t.len
+}
+
+// mapTrieTable adapts MapTrie to the prefixTable API.
+type mapTrieTable[V any] struct {
+	trie MapTrie[netip.Prefix, netip.Addr, V]
+}
+
+// newMapTrieTable returns an empty MapTrie behind the prefixTable API.
+func newMapTrieTable[V any]() *mapTrieTable[V] {
+	return &mapTrieTable[V]{trie: NewMapTrie[netip.Prefix, netip.Addr, V](0)}
+}
+
+// Insert adds the prefix or replaces its value.
+func (t *mapTrieTable[V]) Insert(prefix netip.Prefix, value V) {
+	t.trie.InsertOrUpdate(prefix, func() V { return value }, func(V) V { return value })
+}
+
+// Get returns the value of the exact prefix.
+func (t *mapTrieTable[V]) Get(prefix netip.Prefix) (V, bool) {
+	prefix = prefix.Masked()
+	value, ok := t.trie[prefix.Bits()][prefix]
+	return value, ok
+}
+
+// Delete removes the prefix and reports whether it was present.
+func (t *mapTrieTable[V]) Delete(prefix netip.Prefix) bool {
+	prefix = prefix.Masked()
+	if _, ok := t.trie[prefix.Bits()][prefix]; !ok {
+		return false
+	}
+	delete(t.trie[prefix.Bits()], prefix)
+	return true
+}
+
+// Lookup returns the longest prefix containing the address.
+func (t *mapTrieTable[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	return t.trie.Lookup(addr)
+}
+
+// Len returns the number of prefixes.
+func (t *mapTrieTable[V]) Len() int {
+	return t.trie.Len()
+}
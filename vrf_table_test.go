@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vrfTableImplementations returns the VRF table layouts: one shared
+// MapTrie keyspace and one table per VRF for each prefixTable.
+func vrfTableImplementations[V any]() []struct {
+	name     string
+	newTable func() VRFTable[V]
+} {
+	return []struct {
+		name     string
+		newTable func() VRFTable[V]
+	}{
+		{"shared_maptrie", func() VRFTable[V] { return NewSharedVRFTable[V]() }},
+		{"per_vrf_maptrie", func() VRFTable[V] {
+			return NewPerVRFTable(func() prefixTable[V] { return newMapTrieTable[V]() })
+		}},
+		{"per_vrf_radix_trie", func() VRFTable[V] {
+			return NewPerVRFTable(func() prefixTable[V] { return NewRadixTrie[V]() })
+		}},
+		{"per_vrf_binary_trie", func() VRFTable[V] {
+			return NewPerVRFTable(func() prefixTable[V] { return NewBinaryTrie[V]() })
+		}},
+	}
+}
+
+func TestMapTrieTableOperations(t *testing.T) {
+	testPrefixTableOperations(t, func() prefixTable[string] { return newMapTrieTable[string]() })
+}
+
+// TestVRFTableOperations tests that VRFs are isolated from each other
+func TestVRFTableOperations(t *testing.T) {
+	for _, impl := range vrfTableImplementations[string]() {
+		t.Run(impl.name, func(t *testing.T) {
+			table := impl.newTable()
+			for _, r := range []struct {
+				vrf   VRFID
+				cidr  string
+				value string
+			}{
+				{1, "10.0.0.0/8", "red-10/8"},
+				{1, "10.1.0.0/16", "red-10.1/16"},
+				{1, "2001:db8::/32", "red-db8"},
+				{2, "10.0.0.0/8", "blue-10/8"},
+				{2, "0.0.0.0/0", "blue-default"},
+				{3, "10.1.2.3/16", "green-10.1/16"},
+			} {
+				table.Insert(r.vrf, netip.MustParsePrefix(r.cidr), r.value)
+			}
+			table.Insert(1, netip.MustParsePrefix("10.0.0.0/8"), "red-10/8-updated")
+			require.Equal(t, 6, table.Len())
+
+			tests := []struct {
+				vrf    VRFID
+				addr   string
+				prefix string
+				want   string
+			}{
+				{1, "10.1.2.3", "10.1.0.0/16", "red-10.1/16"},
+				{1, "10.2.0.1", "10.0.0.0/8", "red-10/8-updated"},
+				{1, "11.0.0.1", "", ""},
+				{1, "2001:db8::1", "2001:db8::/32", "red-db8"},
+				{2, "10.1.2.3", "10.0.0.0/8", "blue-10/8"},
+				{2, "11.0.0.1", "0.0.0.0/0", "blue-default"},
+				{2, "2001:db8::1", "", ""},
+				{3, "10.1.0.1", "10.1.0.0/16", "green-10.1/16"},
+				{3, "10.2.0.1", "", ""},
+				{4, "10.1.2.3", "", ""},
+			}
+			for _, tt := range tests {
+				prefix, got, ok := table.Lookup(tt.vrf, netip.MustParseAddr(tt.addr))
+				if tt.want == "" {
+					assert.False(t, ok, "Lookup(%d, %s) = %q", tt.vrf, tt.addr, got)
+					continue
+				}
+				require.True(t, ok, "Lookup(%d, %s)", tt.vrf, tt.addr)
+				assert.Equal(t, tt.want, got, "Lookup(%d, %s)", tt.vrf, tt.addr)
+				assert.Equal(t, tt.prefix, prefix.String(), "Lookup(%d, %s)", tt.vrf, tt.addr)
+			}
+
+			assert.False(t, table.Delete(3, netip.MustParsePrefix("10.0.0.0/8")))
+			assert.False(t, table.Delete(4, netip.MustParsePrefix("10.0.0.0/8")))
+			require.True(t, table.Delete(2, netip.MustParsePrefix("10.0.0.0/8")))
+			_, got, _ := table.Lookup(2, netip.MustParseAddr("10.1.2.3"))
+			assert.Equal(t, "blue-default", got)
+			_, got, _ = table.Lookup(1, netip.MustParseAddr("10.2.0.1"))
+			assert.Equal(t, "red-10/8-updated", got)
+			require.Equal(t, 5, table.Len())
+
+			assert.Equal(t, 3, table.DeleteVRF(1))
+			assert.Equal(t, 0, table.DeleteVRF(1))
+			assert.Equal(t, 0, table.DeleteVRF(4))
+			require.Equal(t, 2, table.Len())
+			_, _, ok := table.Lookup(1, netip.MustParseAddr("10.1.2.3"))
+			assert.False(t, ok)
+			_, got, _ = table.Lookup(3, netip.MustParseAddr("10.1.0.1"))
+			assert.Equal(t, "green-10.1/16", got)
+
+			// A deleted VRF can be populated again.
+			table.Insert(1, netip.MustParsePrefix("10.0.0.0/8"), "red-again")
+			_, got, _ = table.Lookup(1, netip.MustParseAddr("10.1.2.3"))
+			assert.Equal(t, "red-again", got)
+			require.Equal(t, 3, table.Len())
+		})
+	}
+}
+
+// TestVRFTableRandom compares the VRF tables with one BinaryTrie per VRF
+// on random inserts, deletes and VRF deletions
+func TestVRFTableRandom(t *testing.T) {
+	prefixes := referencePrefixes(2000)
+	rng := rand.New(rand.NewSource(47))
+
+	const vrfs = 8
+	type route struct {
+		vrf    VRFID
+		prefix netip.Prefix
+	}
+	routes := make([]route, len(prefixes))
+	for idx, prefix := range prefixes {
+		routes[idx] = route{vrf: VRFID(rng.Intn(vrfs)), prefix: prefix}
+	}
+	addrs := referenceAddrs(prefixes, 1000)
+
+	for _, impl := range vrfTableImplementations[int]() {
+		t.Run(impl.name, func(t *testing.T) {
+			table := impl.newTable()
+			reference := map[VRFID]*BinaryTrie[int]{}
+			for vrf := range VRFID(vrfs) {
+				reference[vrf] = NewBinaryTrie[int]()
+			}
+
+			compare := func(phase string) {
+				n := 0
+				for _, trie := range reference {
+					n += trie.Len()
+				}
+				require.Equal(t, n, table.Len(), phase)
+
+				for idx, addr := range addrs {
+					vrf := VRFID(idx % vrfs)
+					wantPrefix, want, wantOk := reference[vrf].Lookup(addr)
+					gotPrefix, got, ok := table.Lookup(vrf, addr)
+					require.Equal(t, wantOk, ok, "%s: Lookup(%d, %s)", phase, vrf, addr)
+					require.Equal(t, want, got, "%s: Lookup(%d, %s)", phase, vrf, addr)
+					require.Equal(t, wantPrefix, gotPrefix, "%s: Lookup(%d, %s)", phase, vrf, addr)
+				}
+			}
+
+			for idx, r := range routes {
+				table.Insert(r.vrf, r.prefix, idx)
+				reference[r.vrf].Insert(r.prefix, idx)
+			}
+			compare("insert")
+
+			for idx, r := range routes {
+				if idx%3 == 0 {
+					require.Equal(t, reference[r.vrf].Delete(r.prefix), table.Delete(r.vrf, r.prefix))
+				}
+			}
+			compare("delete")
+
+			for _, vrf := range []VRFID{2, 5} {
+				require.Equal(t, reference[vrf].Len(), table.DeleteVRF(vrf))
+				reference[vrf] = NewBinaryTrie[int]()
+			}
+			compare("delete vrf")
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"testing"
+	"unsafe"
+)
+
+var (
+	workingSetMin       = flag.Int("working-set-min", 1000, "smallest number of lookup addresses of BenchmarkWorkingSet1M")
+	workingSetMax       = flag.Int("working-set-max", 100_000_000, "largest number of lookup addresses of BenchmarkWorkingSet1M, 100M addresses take 2.4 GB")
+	workingSetColdBatch = flag.Int("working-set-cold-batch", 1000, "smallest number of lookups between cache evictions in the cold mode of BenchmarkWorkingSet1M")
+)
+
+// BenchmarkWorkingSet1M benchmarks lookups streamed from pre-generated
+// buffers of -working-set-min to -working-set-max random addresses, in
+// powers of ten, on 1M prefixes loaded into every implementation. The
+// buffer only grows to the largest working set run. In the
+// warm mode the buffer is cycled through; in the cold mode the caches are
+// evicted, with the timer stopped, once per pass over the working set but
+// at most every -working-set-cold-batch lookups, by writing a buffer of
+// twice the last level cache size. Every eviction stops the world to read
+// the memory statistics and writes the buffer, so cold cases of small
+// working sets should be run with -benchtime=Nx.
+//
+// working-set-bytes is the size of the address buffer, llc-ratio that
+// size relative to the last level cache and slowdown the lookup time
+// relative to the smallest warm working set of the same table.
+func BenchmarkWorkingSet1M(b *testing.B) {
+	llc, err := LastLevelCacheSize()
+	if err != nil {
+		b.Logf("Last level cache size unknown, assuming %d bytes: %v", defaultLastLevelCacheSize, err)
+		llc = defaultLastLevelCacheSize
+	}
+	sizes := SweepSizes(*workingSetMin, *workingSetMax, 1)
+
+	var evict []byte
+	for _, ds := range prefixDatasets() {
+		prefixes := ds.prefixes(1000_000)
+		ipv4 := prefixes[0].Addr().Is4()
+		workingSet := NewWorkingSet(prefixes)
+
+		for _, impl := range stringTableImplementations() {
+			if impl.ipv4Only && !ipv4 {
+				continue
+			}
+
+			var lookup func(netip.Addr) bool
+			var base float64
+			for _, mode := range []string{"warm", "cold"} {
+				for _, n := range sizes {
+					b.Run(fmt.Sprintf("%s/%s/%s/%d", ds.name, impl.name, mode, n), func(b *testing.B) {
+						if mode == "cold" && evict == nil {
+							evict = make([]byte, 2*llc)
+						}
+						if lookup == nil {
+							lookup, _ = loadTable(b, impl, prefixes)
+						}
+						addrs := workingSet.Addrs(n)
+						coldBatch := max(*workingSetColdBatch, n)
+						if mode == "cold" {
+							evictCaches(evict)
+						}
+
+						b.ResetTimer()
+						b.ReportAllocs()
+						captureProfiles(b)
+
+						idx := 0
+						batch := 0
+						foundCount := 0
+						for b.Loop() {
+							if lookup(addrs[idx]) {
+								foundCount++
+							}
+							idx = (idx + 1) % len(addrs)
+							if batch++; mode == "cold" && batch == coldBatch {
+								b.StopTimer()
+								evictCaches(evict)
+								b.StartTimer()
+								batch = 0
+							}
+						}
+
+						if foundCount == 0 {
+							b.Fatalf("No successful lookups in %d iterations", b.N)
+						}
+
+						nsPerLookup := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
+						if mode == "warm" && n == sizes[0] {
+							base = nsPerLookup
+						}
+						bytes := float64(n) * float64(unsafe.Sizeof(netip.Addr{}))
+						b.ReportMetric(bytes, "working-set-bytes")
+						b.ReportMetric(bytes/float64(llc), "llc-ratio")
+						if base != 0 {
+							b.ReportMetric(nsPerLookup/base, "slowdown")
+						}
+					})
+				}
+			}
+		}
+	}
+}
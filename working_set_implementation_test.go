@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultLastLevelCacheSize is assumed when the cache sizes are not
+// available from sysfs.
+const defaultLastLevelCacheSize = 32 << 20
+
+// LastLevelCacheSize returns the size of the highest level data or unified
+// cache of CPU 0 from /sys/devices/system/cpu/cpu0/cache (Linux only).
+func LastLevelCacheSize() (int64, error) {
+	dirs, err := filepath.Glob("/sys/devices/system/cpu/cpu0/cache/index*")
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	bestLevel := 0
+	for _, dir := range dirs {
+		typ, err := os.ReadFile(filepath.Join(dir, "type"))
+		if err != nil {
+			return 0, err
+		}
+		if strings.TrimSpace(string(typ)) == "Instruction" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "level"))
+		if err != nil {
+			return 0, err
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", dir, err)
+		}
+		if level <= bestLevel {
+			continue
+		}
+		data, err = os.ReadFile(filepath.Join(dir, "size"))
+		if err != nil {
+			return 0, err
+		}
+		if size, err = parseCacheSize(string(data)); err != nil {
+			return 0, fmt.Errorf("%s: %w", dir, err)
+		}
+		bestLevel = level
+	}
+	if bestLevel == 0 {
+		return 0, fmt.Errorf("no data caches in sysfs")
+	}
+	return size, nil
+}
+
+// parseCacheSize parses a sysfs cache size such as "48K" or "105M".
+func parseCacheSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	shift := 0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cache size: %w", err)
+	}
+	return n << shift, nil
+}
+
+// randomAddrIn returns a random address inside the prefix.
+func randomAddrIn(rng *rand.Rand, prefix netip.Prefix) netip.Addr {
+	if prefix.Addr().Is4() {
+		bytes := prefix.Addr().As4()
+		randomizeHostBits(rng, bytes[:], prefix.Bits())
+		return netip.AddrFrom4(bytes)
+	}
+	bytes := prefix.Addr().As16()
+	randomizeHostBits(rng, bytes[:], prefix.Bits())
+	return netip.AddrFrom16(bytes)
+}
+
+// randomizeHostBits randomizes the bits of bytes below the prefix length
+// bits.
+func randomizeHostBits(rng *rand.Rand, bytes []byte, bits int) {
+	for i := range bytes {
+		hostBits := min(max(8*(i+1)-bits, 0), 8)
+		mask := byte(1<<hostBits - 1)
+		bytes[i] = bytes[i]&^mask | byte(rng.Intn(256))&mask
+	}
+}
+
+// WorkingSet generates lookup addresses inside random prefixes, in random
+// order, so that consecutive lookups touch unrelated parts of the table.
+// Addresses are generated as larger working sets are requested, and every
+// working set is a prefix of the larger ones.
+type WorkingSet struct {
+	prefixes []netip.Prefix
+	rng      *rand.Rand
+	addrs    []netip.Addr
+}
+
+// NewWorkingSet returns a generator of working sets for the prefixes.
+func NewWorkingSet(prefixes []netip.Prefix) *WorkingSet {
+	return &WorkingSet{prefixes: prefixes, rng: rand.New(rand.NewSource(42))}
+}
+
+// Addrs returns a working set of n addresses.
+func (w *WorkingSet) Addrs(n int) []netip.Addr {
+	if n > len(w.addrs) {
+		w.addrs = slices.Grow(w.addrs, n-len(w.addrs))
+		for len(w.addrs) < n {
+			w.addrs = append(w.addrs, randomAddrIn(w.rng, w.prefixes[w.rng.Intn(len(w.prefixes))]))
+		}
+	}
+	return w.addrs[:n]
+}
+
+// evictCaches writes one byte of every cache line of buf, which must be
+// larger than the last level cache, to evict the table from the caches.
+func evictCaches(buf []byte) {
+	for i := 0; i < len(buf); i += 64 {
+		buf[i]++
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseCacheSize tests parsing of sysfs cache sizes
+func TestParseCacheSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"48K\n":   48 << 10,
+		"107520K": 107520 << 10,
+		"2M":      2 << 20,
+		"1G":      1 << 30,
+		"4096":    4096,
+	} {
+		got, err := parseCacheSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	_, err := parseCacheSize("large")
+	assert.Error(t, err)
+}
+
+// TestLastLevelCacheSize tests reading the last level cache size from
+// sysfs
+func TestLastLevelCacheSize(t *testing.T) {
+	size, err := LastLevelCacheSize()
+	if err != nil {
+		t.Skipf("cache sizes not available: %v", err)
+	}
+	assert.Positive(t, size)
+}
+
+// TestRandomAddrIn tests that random addresses stay inside the prefix
+func TestRandomAddrIn(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, prefix := range []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.128/27"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+		netip.MustParsePrefix("0.0.0.0/0"),
+		netip.MustParsePrefix("2001:db8::/45"),
+		netip.MustParsePrefix("2001:db8:1:2::/64"),
+	} {
+		seen := map[netip.Addr]bool{}
+		for range 100 {
+			addr := randomAddrIn(rng, prefix)
+			require.True(t, prefix.Contains(addr), "%s not in %s", addr, prefix)
+			seen[addr] = true
+		}
+		assert.Zero(t, testing.AllocsPerRun(100, func() { randomAddrIn(rng, prefix) }))
+		if prefix.Bits() < prefix.Addr().BitLen()-4 {
+			assert.Greater(t, len(seen), 10, "host bits of %s are random", prefix)
+		} else if prefix.Bits() == prefix.Addr().BitLen() {
+			assert.Len(t, seen, 1)
+		}
+	}
+}
+
+// TestWorkingSet tests that working set addresses all hit the table
+func TestWorkingSet(t *testing.T) {
+	prefixes := referencePrefixes(1000)
+	addrs := NewWorkingSet(prefixes).Addrs(5000)
+	require.Len(t, addrs, 5000)
+
+	w := NewWorkingSet(prefixes)
+	assert.Equal(t, addrs[:100], w.Addrs(100), "smaller working sets are prefixes of larger ones")
+	assert.Equal(t, addrs[:3000], w.Addrs(3000), "working sets grow as requested")
+	assert.Equal(t, addrs[:1000], w.Addrs(1000))
+
+	trie := NewBinaryTrie[int]()
+	for i, prefix := range prefixes {
+		trie.Insert(prefix, i)
+	}
+	for _, addr := range addrs {
+		_, _, ok := trie.Lookup(addr)
+		require.True(t, ok, addr)
+	}
+}